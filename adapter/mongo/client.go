@@ -3,10 +3,19 @@ package mongo
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
 
+	"github.com/y7ls8i/kart/config"
+	"github.com/y7ls8i/kart/tracing"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // DefaultPerPage is the default number of products per page.
@@ -14,50 +23,223 @@ const DefaultPerPage = 20
 
 // Client represents a mongo client.
 type Client struct {
-	client *mongo.Client
-	db     string
+	client    *mongo.Client
+	db        string
+	opTimeout time.Duration
 }
 
 // NewClient returns a new mongo client.
-func NewClient(uri, db string) (*Client, error) {
-	mc, err := mongo.Connect(options.Client().ApplyURI(uri))
+// It pings the server until it answers, retrying StartupRetries times with an exponential backoff starting at
+// StartupBackoff, and ensures the indexes.
+func NewClient(conf config.MongoDB) (*Client, error) {
+	opts, err := clientOptions(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	mc, err := mongo.Connect(opts)
 	if err != nil {
 		return nil, fmt.Errorf("error connecting to mongo: %w", err)
 	}
 
-	client := &Client{client: mc, db: db}
+	client := &Client{client: mc, db: conf.DB, opTimeout: conf.OperationTimeout}
+
+	if err := client.pingWithRetry(conf); err != nil {
+		_ = mc.Disconnect(context.Background())
+		return nil, err
+	}
 
 	if err := client.EnsureIndexes(); err != nil {
+		_ = mc.Disconnect(context.Background())
 		return nil, err
 	}
 
 	return client, nil
 }
 
+// clientOptions returns the driver options for conf. Zero values keep the driver defaults.
+func clientOptions(conf config.MongoDB) (*options.ClientOptions, error) {
+	opts := options.Client().ApplyURI(conf.URI)
+	if conf.AppName != "" {
+		opts.SetAppName(conf.AppName)
+	}
+	if conf.MinPoolSize > 0 {
+		opts.SetMinPoolSize(conf.MinPoolSize)
+	}
+	if conf.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(conf.MaxPoolSize)
+	}
+	if conf.MaxConnIdleTime > 0 {
+		opts.SetMaxConnIdleTime(conf.MaxConnIdleTime)
+	}
+	if conf.ConnectTimeout > 0 {
+		opts.SetConnectTimeout(conf.ConnectTimeout)
+	}
+	if conf.ServerSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(conf.ServerSelectionTimeout)
+	}
+
+	if conf.ReadPreference != "" {
+		mode, err := readpref.ModeFromString(conf.ReadPreference)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mongo read preference: %w", err)
+		}
+		rp, err := readpref.New(mode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mongo read preference: %w", err)
+		}
+		opts.SetReadPreference(rp)
+	}
+
+	if conf.WriteConcern != "" {
+		wc := &writeconcern.WriteConcern{W: conf.WriteConcern}
+		if n, err := strconv.Atoi(conf.WriteConcern); err == nil {
+			wc.W = n
+		}
+		opts.SetWriteConcern(wc)
+	}
+
+	if conf.TLSCAFile != "" || conf.TLSCertFile != "" {
+		tlsConfig, err := conf.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	return opts, nil
+}
+
+// pingWithRetry pings the server until it answers or the retries are exhausted.
+func (c *Client) pingWithRetry(conf config.MongoDB) error {
+	backoff := conf.StartupBackoff
+	for attempt := 0; ; attempt++ {
+		err := c.Ping(context.Background())
+		if err == nil {
+			return nil
+		}
+		if attempt >= conf.StartupRetries {
+			return fmt.Errorf("mongo is not reachable after %d attempts: %w", attempt+1, err)
+		}
+		slog.Warn("Mongo is not reachable, retrying", "error", err, "attempt", attempt+1, "backoff", backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// withTimeout bounds ctx with the operation timeout, so that a slow database cannot hang the callers forever.
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.opTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.opTimeout)
+}
+
+// Close disconnects from MongoDB, waiting for the in-progress operations until ctx is done.
+func (c *Client) Close(ctx context.Context) error {
+	if err := c.client.Disconnect(ctx); err != nil {
+		return fmt.Errorf("error disconnecting from mongo: %w", err)
+	}
+	return nil
+}
+
+// index is an index that the application requires.
+type index struct {
+	name       string
+	collection string
+	keys       bson.D
+	unique     bool
+}
+
+// indexes are the indexes that the application requires.
+var indexes = []index{
+	{name: "products", collection: CollectionNameProducts, keys: bson.D{{Key: "name", Value: 1}}},
+	{name: "coupons", collection: CollectionNameCoupons, keys: bson.D{{Key: "code", Value: 1}}, unique: true},
+}
+
 // EnsureIndexes ensures that the indexes are created in DB.
 func (c *Client) EnsureIndexes() error {
-	{
-		coll := c.client.Database(c.db).Collection("products")
-		if _, err := coll.Indexes().CreateOne(
-			context.Background(),
-			mongo.IndexModel{
-				Keys: bson.D{{Key: "name", Value: 1}},
-			}); err != nil {
-			return fmt.Errorf("error creating products index: %w", err)
+	ctx, cancel := c.withTimeout(context.Background())
+	defer cancel()
+
+	for _, idx := range indexes {
+		model := mongo.IndexModel{Keys: idx.keys}
+		if idx.unique {
+			model.Options = options.Index().SetUnique(true)
+		}
+		coll := c.client.Database(c.db).Collection(idx.collection)
+		if _, err := coll.Indexes().CreateOne(ctx, model); err != nil {
+			return fmt.Errorf("error creating %s index: %w", idx.name, err)
 		}
 	}
 
-	{
-		coll := c.client.Database(c.db).Collection("coupons")
-		if _, err := coll.Indexes().CreateOne(
-			context.Background(),
-			mongo.IndexModel{
-				Keys:    bson.D{{Key: "code", Value: 1}},
-				Options: options.Index().SetUnique(true),
-			}); err != nil {
-			return fmt.Errorf("error creating coupons index: %w", err)
-		}
+	return nil
+}
+
+// Ping checks that the MongoDB server is reachable.
+func (c *Client) Ping(ctx context.Context) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	if err := c.client.Ping(ctx, nil); err != nil {
+		return fmt.Errorf("failed to ping mongo: %w", err)
 	}
+	return nil
+}
+
+// CheckIndexes checks that the indexes created by EnsureIndexes exist in DB.
+func (c *Client) CheckIndexes(ctx context.Context) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
 
+	for _, idx := range indexes {
+		coll := c.client.Database(c.db).Collection(idx.collection)
+		specs, err := coll.Indexes().ListSpecifications(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list %s indexes: %w", idx.name, err)
+		}
+		if !hasIndex(specs, idx) {
+			return fmt.Errorf("%s index is missing", idx.name)
+		}
+	}
 	return nil
 }
+
+// hasIndex reports whether specs contains an index with the keys and the uniqueness of idx.
+func hasIndex(specs []mongo.IndexSpecification, idx index) bool {
+	for _, spec := range specs {
+		var keys bson.D
+		if err := bson.Unmarshal(spec.KeysDocument, &keys); err != nil || len(keys) != len(idx.keys) {
+			continue
+		}
+		unique := spec.Unique != nil && *spec.Unique
+		if unique != idx.unique {
+			continue
+		}
+		match := true
+		for i := range keys {
+			// the server may return the key direction as int32, int64 or double
+			if keys[i].Key != idx.keys[i].Key || fmt.Sprint(keys[i].Value) != fmt.Sprint(idx.keys[i].Value) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// startSpan starts the client span of an adapter method.
+func (c *Client) startSpan(ctx context.Context, operation, collection string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "mongo."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemMongoDB,
+			semconv.DBNamespace(c.db),
+			semconv.DBCollectionName(collection),
+			semconv.DBOperationName(operation),
+		),
+	)
+}
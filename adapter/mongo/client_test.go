@@ -0,0 +1,165 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/config"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+)
+
+func TestPing(t *testing.T) {
+	t.Parallel()
+
+	c := newTestClient(t)
+	if c == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, c.Ping(ctx))
+}
+
+func TestCheckIndexes(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		c := newTestClient(t)
+		if c == nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		require.NoError(t, c.CheckIndexes(ctx))
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		t.Parallel()
+
+		c := newTestClient(t)
+		if c == nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := c.client.Database(c.db).Collection(CollectionNameCoupons).Indexes().DropOne(ctx, "code_1")
+		require.NoError(t, err)
+
+		err = c.CheckIndexes(ctx)
+		require.Error(t, err)
+		assert.Equal(t, "coupons index is missing", err.Error())
+	})
+}
+
+func TestHasIndex(t *testing.T) {
+	mustMarshal := func(v any) bson.Raw {
+		b, err := bson.Marshal(v)
+		require.NoError(t, err)
+		return b
+	}
+	unique := true
+	idx := index{name: "coupons", collection: CollectionNameCoupons, keys: bson.D{{Key: "code", Value: 1}}, unique: true}
+
+	testCases := []struct {
+		name     string
+		specs    []mongo.IndexSpecification
+		expected bool
+	}{
+		{
+			name: "found",
+			specs: []mongo.IndexSpecification{
+				{Name: "_id_", KeysDocument: mustMarshal(bson.D{{Key: "_id", Value: int32(1)}})},
+				{Name: "code_1", KeysDocument: mustMarshal(bson.D{{Key: "code", Value: int64(1)}}), Unique: &unique},
+			},
+			expected: true,
+		},
+		{
+			name: "not unique",
+			specs: []mongo.IndexSpecification{
+				{Name: "code_1", KeysDocument: mustMarshal(bson.D{{Key: "code", Value: int32(1)}})},
+			},
+			expected: false,
+		},
+		{
+			name: "other direction",
+			specs: []mongo.IndexSpecification{
+				{Name: "code_-1", KeysDocument: mustMarshal(bson.D{{Key: "code", Value: int32(-1)}}), Unique: &unique},
+			},
+			expected: false,
+		},
+		{
+			name:     "no indexes",
+			specs:    nil,
+			expected: false,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, hasIndex(test.specs, idx))
+		})
+	}
+}
+
+func TestClientOptions(t *testing.T) {
+	t.Run("tuned", func(t *testing.T) {
+		opts, err := clientOptions(config.MongoDB{
+			URI:                    testMongoURI,
+			AppName:                "kart-test",
+			MinPoolSize:            2,
+			MaxPoolSize:            50,
+			ConnectTimeout:         3 * time.Second,
+			ServerSelectionTimeout: 4 * time.Second,
+			ReadPreference:         "secondaryPreferred",
+			WriteConcern:           "2",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "kart-test", *opts.AppName)
+		assert.Equal(t, uint64(2), *opts.MinPoolSize)
+		assert.Equal(t, uint64(50), *opts.MaxPoolSize)
+		assert.Equal(t, 3*time.Second, *opts.ConnectTimeout)
+		assert.Equal(t, 4*time.Second, *opts.ServerSelectionTimeout)
+		assert.Equal(t, readpref.SecondaryPreferredMode, opts.ReadPreference.Mode())
+		assert.Equal(t, 2, opts.WriteConcern.W)
+	})
+
+	t.Run("majority", func(t *testing.T) {
+		opts, err := clientOptions(config.MongoDB{URI: testMongoURI, WriteConcern: "majority"})
+		require.NoError(t, err)
+		assert.Equal(t, "majority", opts.WriteConcern.W)
+		assert.Nil(t, opts.ReadPreference)
+	})
+
+	t.Run("invalid read preference", func(t *testing.T) {
+		_, err := clientOptions(config.MongoDB{URI: testMongoURI, ReadPreference: "fastest"})
+		require.Error(t, err)
+		assert.Equal(t, "invalid mongo read preference: unknown read preference fastest", err.Error())
+	})
+}
+
+func TestNewClient_unreachable(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	c, err := NewClient(config.MongoDB{
+		URI:                    "mongodb://127.0.0.1:1",
+		DB:                     "kart",
+		ServerSelectionTimeout: 100 * time.Millisecond,
+		StartupRetries:         2,
+		StartupBackoff:         10 * time.Millisecond,
+	})
+	require.Error(t, err)
+	assert.Nil(t, c)
+	assert.Contains(t, err.Error(), "mongo is not reachable after 3 attempts")
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -4,37 +4,259 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/logger"
+	"github.com/y7ls8i/kart/metrics"
+	"github.com/y7ls8i/kart/tracing"
+	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 // CollectionNameCoupons is the name of the collection for coupons.
 const CollectionNameCoupons = "coupons"
 
 // Coupon represents a coupon in DB.
+// DeactivatedAt is when the coupon stopped being valid, nil if it is valid; a deactivated coupon is kept but not
+// found by FindOneCoupon. Generation is set on the coupons generated by kart coupons generate, nil on the coupons of
+// the coupon bases.
 type Coupon struct {
-	Code string `json:"code" bson:"code"`
+	Code          string            `json:"code" bson:"code"`
+	DeactivatedAt *time.Time        `json:"deactivatedAt,omitempty" bson:"deactivatedAt,omitempty"`
+	Generation    *CouponGeneration `json:"generation,omitempty" bson:"generation,omitempty"`
+}
+
+// CouponGeneration is the metadata of a generated coupon: the Batch of codes generated together, when, for which
+// Campaign, and with which Prefix.
+type CouponGeneration struct {
+	Batch       string    `json:"batch" bson:"batch"`
+	GeneratedAt time.Time `json:"generatedAt" bson:"generatedAt"`
+	Campaign    string    `json:"campaign,omitempty" bson:"campaign,omitempty"`
+	Prefix      string    `json:"prefix,omitempty" bson:"prefix,omitempty"`
 }
 
 // InsertCoupons inserts the coupons into DB.
-func (c *Client) InsertCoupons(ctx context.Context, coupons []Coupon) error {
+func (c *Client) InsertCoupons(ctx context.Context, coupons []Coupon) (err error) {
+	defer metrics.ObserveMongo("InsertCoupons", time.Now())
+	ctx, span := c.startSpan(ctx, "InsertCoupons", CollectionNameCoupons)
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
 	coll := c.client.Database(c.db).Collection(CollectionNameCoupons)
 	if _, err := coll.InsertMany(ctx, coupons); err != nil {
 		return fmt.Errorf("failed to insert coupons: %w", err)
 	}
+	logger.FromContext(ctx).Debug("Mongo coupons inserted", "count", len(coupons))
 	return nil
 }
 
 // FindOneCoupon finds the requested coupon in DB and returns the coupon.
 func (c *Client) FindOneCoupon(ctx context.Context, code string) (result *Coupon, err error) {
+	defer metrics.ObserveMongo("FindOneCoupon", time.Now())
+	ctx, span := c.startSpan(ctx, "FindOneCoupon", CollectionNameCoupons)
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
 	result = &Coupon{}
 	coll := c.client.Database(c.db).Collection(CollectionNameCoupons)
-	if err := coll.FindOne(ctx, map[string]string{"code": code}).Decode(result); err != nil {
+	filter := bson.M{"code": code, "deactivatedAt": bson.M{"$exists": false}}
+	if err := coll.FindOne(ctx, filter).Decode(result); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
+			logger.FromContext(ctx).Debug("Mongo coupon not found", "couponCode", code)
 			return nil, aperr.ErrNotFound
 		}
 		return nil, fmt.Errorf("failed to get coupon: %w", err)
 	}
+	logger.FromContext(ctx).Debug("Mongo coupon found", "couponCode", code)
 	return result, nil
 }
+
+// ExistingCoupons returns the codes, among codes, of the coupons in DB, deactivated or not.
+func (c *Client) ExistingCoupons(ctx context.Context, codes []string) (existing []string, err error) {
+	defer metrics.ObserveMongo("ExistingCoupons", time.Now())
+	ctx, span := c.startSpan(ctx, "ExistingCoupons", CollectionNameCoupons)
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	coll := c.client.Database(c.db).Collection(CollectionNameCoupons)
+	cursor, err := coll.Find(ctx, bson.M{"code": bson.M{"$in": codes}}, options.Find().SetProjection(bson.M{"code": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find coupons: %w", err)
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	var coupons []Coupon
+	if err := cursor.All(ctx, &coupons); err != nil {
+		return nil, fmt.Errorf("failed to get all coupons: %w", err)
+	}
+
+	existing = make([]string, 0, len(coupons))
+	for _, coupon := range coupons {
+		existing = append(existing, coupon.Code)
+	}
+	logger.FromContext(ctx).Debug("Mongo existing coupons found", "count", len(existing))
+	return existing, nil
+}
+
+// EachCoupon calls fn with every coupon, deactivated or not, sorted by code, and stops at the first error of fn.
+// It is not bounded by OperationTimeout, as it reads the whole collection; ctx bounds it.
+func (c *Client) EachCoupon(ctx context.Context, fn func(Coupon) error) (err error) {
+	defer metrics.ObserveMongo("EachCoupon", time.Now())
+	ctx, span := c.startSpan(ctx, "EachCoupon", CollectionNameCoupons)
+	defer func() { tracing.End(span, err) }()
+
+	coll := c.client.Database(c.db).Collection(CollectionNameCoupons)
+	cursor, err := coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "code", Value: 1}}))
+	if err != nil {
+		return fmt.Errorf("failed to find coupons: %w", err)
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	for cursor.Next(ctx) {
+		coupon := Coupon{}
+		if err := cursor.Decode(&coupon); err != nil {
+			return fmt.Errorf("failed to decode coupon: %w", err)
+		}
+		if err := fn(coupon); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to read coupons: %w", err)
+	}
+	return nil
+}
+
+// UpsertCoupons makes the coupons with the codes valid: it inserts the missing ones and reactivates the deactivated
+// ones. It returns the number of coupons inserted and reactivated.
+func (c *Client) UpsertCoupons(ctx context.Context, codes []string) (inserted, reactivated int, err error) {
+	defer metrics.ObserveMongo("UpsertCoupons", time.Now())
+	ctx, span := c.startSpan(ctx, "UpsertCoupons", CollectionNameCoupons)
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	if len(codes) == 0 {
+		return 0, 0, nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(codes))
+	for _, code := range codes {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"code": code}).
+			SetUpdate(bson.M{"$unset": bson.M{"deactivatedAt": ""}}).
+			SetUpsert(true))
+	}
+
+	coll := c.client.Database(c.db).Collection(CollectionNameCoupons)
+	result, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to upsert coupons: %w", err)
+	}
+
+	logger.FromContext(ctx).Debug("Mongo coupons upserted", "inserted", result.UpsertedCount, "reactivated", result.ModifiedCount)
+	return int(result.UpsertedCount), int(result.ModifiedCount), nil
+}
+
+// DeactivateCoupons deactivates the valid coupons with the codes at the time at, and returns how many it deactivated.
+func (c *Client) DeactivateCoupons(ctx context.Context, codes []string, at time.Time) (deactivated int, err error) {
+	defer metrics.ObserveMongo("DeactivateCoupons", time.Now())
+	ctx, span := c.startSpan(ctx, "DeactivateCoupons", CollectionNameCoupons)
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	coll := c.client.Database(c.db).Collection(CollectionNameCoupons)
+	result, err := coll.UpdateMany(ctx,
+		bson.M{"code": bson.M{"$in": codes}, "deactivatedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"deactivatedAt": at}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to deactivate coupons: %w", err)
+	}
+
+	logger.FromContext(ctx).Debug("Mongo coupons deactivated", "count", result.ModifiedCount)
+	return int(result.ModifiedCount), nil
+}
+
+// DeleteCoupons deletes the coupons with the codes, and returns how many it deleted.
+func (c *Client) DeleteCoupons(ctx context.Context, codes []string) (deleted int, err error) {
+	defer metrics.ObserveMongo("DeleteCoupons", time.Now())
+	ctx, span := c.startSpan(ctx, "DeleteCoupons", CollectionNameCoupons)
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	coll := c.client.Database(c.db).Collection(CollectionNameCoupons)
+	result, err := coll.DeleteMany(ctx, bson.M{"code": bson.M{"$in": codes}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete coupons: %w", err)
+	}
+
+	logger.FromContext(ctx).Debug("Mongo coupons deleted", "count", result.DeletedCount)
+	return int(result.DeletedCount), nil
+}
+
+// CouponRename changes the code of a coupon From one code To another.
+type CouponRename struct {
+	From string
+	To   string
+}
+
+// RenameCoupons changes the codes of the coupons. A coupon whose new code is taken, by another coupon or by an earlier
+// rename, is deleted instead, the coupon of that code being kept as it is. It returns the number of coupons renamed
+// and deleted.
+func (c *Client) RenameCoupons(ctx context.Context, renames []CouponRename) (renamed, deleted int, err error) {
+	defer metrics.ObserveMongo("RenameCoupons", time.Now())
+	ctx, span := c.startSpan(ctx, "RenameCoupons", CollectionNameCoupons)
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	if len(renames) == 0 {
+		return 0, 0, nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(renames))
+	for _, rename := range renames {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"code": rename.From}).
+			SetUpdate(bson.M{"$set": bson.M{"code": rename.To}}))
+	}
+
+	coll := c.client.Database(c.db).Collection(CollectionNameCoupons)
+	result, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	var taken []string
+	if err != nil {
+		// the renames to a taken code fail on the unique index, the others are written
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+			return 0, 0, fmt.Errorf("failed to rename coupons: %w", err)
+		}
+		for _, writeErr := range bulkErr.WriteErrors {
+			if !mongo.IsDuplicateKeyError(writeErr) {
+				return 0, 0, fmt.Errorf("failed to rename coupons: %w", err)
+			}
+			taken = append(taken, renames[writeErr.Index].From)
+		}
+	}
+
+	if len(taken) > 0 {
+		deleteResult, err := coll.DeleteMany(ctx, bson.M{"code": bson.M{"$in": taken}})
+		if err != nil {
+			return int(result.ModifiedCount), 0, fmt.Errorf("failed to delete renamed coupons: %w", err)
+		}
+		deleted = int(deleteResult.DeletedCount)
+	}
+
+	logger.FromContext(ctx).Debug("Mongo coupons renamed", "renamed", result.ModifiedCount, "deleted", deleted)
+	return int(result.ModifiedCount), deleted, nil
+}
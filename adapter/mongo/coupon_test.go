@@ -9,18 +9,19 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/config"
 	aperr "github.com/y7ls8i/kart/error"
 )
 
 const testMongoURI = "mongodb://127.0.0.1:27017"
 
-func newTestClient(t *testing.T) *Client {
+func newTestClient(t testing.TB) *Client {
 	t.Helper()
 
 	ts := time.Now().UnixNano()
 	dbName := fmt.Sprintf("kart-%d", ts)
 
-	c, err := NewClient(testMongoURI, dbName)
+	c, err := NewClient(config.MongoDB{URI: testMongoURI, DB: dbName, ServerSelectionTimeout: 2 * time.Second})
 	if err != nil {
 		t.Skipf("skipping: cannot connect to MongoDB at %s: %v", testMongoURI, err)
 		return nil
@@ -97,3 +98,162 @@ func TestFindOneCoupon(t *testing.T) {
 		assert.Nil(t, got)
 	})
 }
+
+// BenchmarkFindOneCoupon looks up as many coupons as BenchmarkIndex_FindOneCoupon of the coupon package, to compare.
+func BenchmarkFindOneCoupon(b *testing.B) {
+	const codes = 100_000
+	c := newTestClient(b)
+	if c == nil {
+		return
+	}
+
+	ctx := context.Background()
+	all := make([]string, 2*codes)
+	batch := make([]Coupon, 0, 10_000)
+	for i := range all {
+		all[i] = fmt.Sprintf("CODE%06d", i)
+		if i%2 != 0 {
+			// the odd codes are missing, so every other lookup is a miss
+			continue
+		}
+		batch = append(batch, Coupon{Code: all[i]})
+		if len(batch) == cap(batch) {
+			require.NoError(b, c.InsertCoupons(ctx, batch))
+			batch = batch[:0]
+		}
+	}
+
+	for i := 0; b.Loop(); i++ {
+		_, _ = c.FindOneCoupon(ctx, all[i%len(all)])
+	}
+}
+
+func TestExistingCoupons(t *testing.T) {
+	c := newTestClient(t)
+	if c == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	generation := &CouponGeneration{Batch: "batch1", GeneratedAt: time.Now().UTC().Truncate(time.Millisecond), Campaign: "summer", Prefix: "SUMMER"}
+	require.NoError(t, c.InsertCoupons(ctx, []Coupon{{Code: "SAVE10"}, {Code: "SUMMERK7MQ2XPAF", Generation: generation}}))
+	_, err := c.DeactivateCoupons(ctx, []string{"SAVE10"}, time.Now())
+	require.NoError(t, err)
+
+	existing, err := c.ExistingCoupons(ctx, []string{"SAVE10", "SAVE20", "SUMMERK7MQ2XPAF"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"SAVE10", "SUMMERK7MQ2XPAF"}, existing)
+
+	coupon, err := c.FindOneCoupon(ctx, "SUMMERK7MQ2XPAF")
+	require.NoError(t, err)
+	assert.Equal(t, generation, coupon.Generation)
+}
+
+func TestSyncCoupons(t *testing.T) {
+	t.Run("upsert, deactivate, reactivate and delete", func(t *testing.T) {
+		t.Parallel()
+
+		c := newTestClient(t)
+		if c == nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		require.NoError(t, c.InsertCoupons(ctx, []Coupon{{Code: "SAVE10"}}))
+
+		inserted, reactivated, err := c.UpsertCoupons(ctx, []string{"SAVE20", "SAVE10", "SAVE30"})
+		require.NoError(t, err)
+		assert.Equal(t, 2, inserted)
+		assert.Equal(t, 0, reactivated)
+
+		deactivated, err := c.DeactivateCoupons(ctx, []string{"SAVE10", "MISSING"}, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, 1, deactivated)
+		_, err = c.FindOneCoupon(ctx, "SAVE10")
+		assert.ErrorIs(t, err, aperr.ErrNotFound)
+
+		var codes []string
+		var deactivatedCodes []string
+		err = c.EachCoupon(ctx, func(coupon Coupon) error {
+			codes = append(codes, coupon.Code)
+			if coupon.DeactivatedAt != nil {
+				deactivatedCodes = append(deactivatedCodes, coupon.Code)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"SAVE10", "SAVE20", "SAVE30"}, codes)
+		assert.Equal(t, []string{"SAVE10"}, deactivatedCodes)
+
+		inserted, reactivated, err = c.UpsertCoupons(ctx, []string{"SAVE10", "SAVE20"})
+		require.NoError(t, err)
+		assert.Equal(t, 0, inserted)
+		assert.Equal(t, 1, reactivated)
+		_, err = c.FindOneCoupon(ctx, "SAVE10")
+		require.NoError(t, err)
+
+		deleted, err := c.DeleteCoupons(ctx, []string{"SAVE20", "SAVE30"})
+		require.NoError(t, err)
+		assert.Equal(t, 2, deleted)
+	})
+
+	t.Run("each stops at the first error", func(t *testing.T) {
+		t.Parallel()
+
+		c := newTestClient(t)
+		if c == nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		require.NoError(t, c.InsertCoupons(ctx, []Coupon{{Code: "SAVE10"}, {Code: "SAVE20"}}))
+
+		calls := 0
+		err := c.EachCoupon(ctx, func(Coupon) error {
+			calls++
+			return errors.New("stop")
+		})
+		require.EqualError(t, err, "stop")
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func TestRenameCoupons(t *testing.T) {
+	c := newTestClient(t)
+	if c == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, c.InsertCoupons(ctx, []Coupon{{Code: "SAVE10"}, {Code: "save-10"}, {Code: "save_20"}, {Code: "Save20"}}))
+
+	renamed, deleted, err := c.RenameCoupons(ctx, []CouponRename{
+		{From: "save-10", To: "SAVE10"},
+		{From: "save_20", To: "SAVE20"},
+		{From: "Save20", To: "SAVE20"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, renamed)
+	assert.Equal(t, 2, deleted)
+
+	var codes []string
+	err = c.EachCoupon(ctx, func(coupon Coupon) error {
+		codes = append(codes, coupon.Code)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"SAVE10", "SAVE20"}, codes)
+
+	renamed, deleted, err = c.RenameCoupons(ctx, nil)
+	require.NoError(t, err)
+	assert.Zero(t, renamed)
+	assert.Zero(t, deleted)
+}
@@ -2,10 +2,17 @@ package mongo
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/logger"
+	"github.com/y7ls8i/kart/metrics"
+	"github.com/y7ls8i/kart/tracing"
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 // CollectionNameOrders is the name of the collection for orders.
@@ -30,7 +37,13 @@ type ItemRequest struct {
 }
 
 // CreateOrder creates a new order.
-func (c *Client) CreateOrder(ctx context.Context, items []ItemRequest) (*Order, error) {
+func (c *Client) CreateOrder(ctx context.Context, items []ItemRequest) (result *Order, err error) {
+	defer metrics.ObserveMongo("CreateOrder", time.Now())
+	ctx, span := c.startSpan(ctx, "CreateOrder", CollectionNameOrders)
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
 	coll := c.client.Database(c.db).Collection(CollectionNameOrders)
 
 	order := Order{
@@ -40,7 +53,7 @@ func (c *Client) CreateOrder(ctx context.Context, items []ItemRequest) (*Order,
 	for _, item := range items {
 		productID, err := bson.ObjectIDFromHex(item.ProductID)
 		if err != nil {
-			return nil, fmt.Errorf("%w: %w", aperr.ErrBadRequest, err)
+			return nil, invalidProductID(item.ProductID, err)
 		}
 		order.Items = append(order.Items, OrderItem{
 			ProductID: productID,
@@ -51,6 +64,72 @@ func (c *Client) CreateOrder(ctx context.Context, items []ItemRequest) (*Order,
 	if _, err := coll.InsertOne(ctx, order); err != nil {
 		return nil, fmt.Errorf("failed to create order: %w", err)
 	}
+	logger.FromContext(ctx).Debug("Mongo order inserted", "orderId", order.ID.Hex())
+
+	return &order, nil
+}
+
+// GetOrder returns the requested order.
+func (c *Client) GetOrder(ctx context.Context, id string) (result *Order, err error) {
+	defer metrics.ObserveMongo("GetOrder", time.Now())
+	ctx, span := c.startSpan(ctx, "GetOrder", CollectionNameOrders)
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	bsonID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, aperr.New(aperr.ErrBadRequest, aperr.CodeInvalidOrderID, fmt.Sprintf("invalid order id %q", id)).
+			With("orderId", id).
+			WithCause(err)
+	}
+
+	coll := c.client.Database(c.db).Collection(CollectionNameOrders)
+
+	var order Order
+	if err := coll.FindOne(ctx, bson.M{"_id": bsonID}).Decode(&order); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, aperr.New(aperr.ErrNotFound, aperr.CodeOrderNotFound, fmt.Sprintf("order %q not found", id)).WithCause(err)
+		}
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
 
+	logger.FromContext(ctx).Debug("Mongo order found", "orderId", id)
 	return &order, nil
 }
+
+// ListOrders returns a page of the orders, the newest first.
+func (c *Client) ListOrders(ctx context.Context, page int) (orders []Order, err error) {
+	defer metrics.ObserveMongo("ListOrders", time.Now())
+	ctx, span := c.startSpan(ctx, "ListOrders", CollectionNameOrders)
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	coll := c.client.Database(c.db).Collection(CollectionNameOrders)
+
+	if page < 1 {
+		page = 1
+	}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "_id", Value: -1}})
+	findOptions.SetLimit(int64(DefaultPerPage))
+	findOptions.SetSkip(int64((page - 1) * DefaultPerPage))
+
+	cursor, err := coll.Find(ctx, bson.M{}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find orders: %w", err)
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	orders = []Order{} // return an empty array if no orders
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, fmt.Errorf("failed to get all orders: %w", err)
+	}
+
+	logger.FromContext(ctx).Debug("Mongo orders listed", "page", page, "count", len(orders))
+	return orders, nil
+}
@@ -75,3 +75,57 @@ func TestCreateOrder(t *testing.T) {
 		assert.Nil(t, order)
 	})
 }
+
+func TestGetOrder(t *testing.T) {
+	t.Parallel()
+
+	c := newTestClient(t)
+	if c == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	created, err := c.CreateOrder(ctx, []ItemRequest{{ProductID: bson.NewObjectID().Hex(), Quantity: 3}})
+	require.NoError(t, err)
+
+	order, err := c.GetOrder(ctx, created.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, created, order)
+
+	_, err = c.GetOrder(ctx, bson.NewObjectID().Hex())
+	assert.True(t, errors.Is(err, aperr.ErrNotFound))
+
+	_, err = c.GetOrder(ctx, "not-a-hex")
+	assert.True(t, errors.Is(err, aperr.ErrBadRequest))
+}
+
+func TestListOrders(t *testing.T) {
+	t.Parallel()
+
+	c := newTestClient(t)
+	if c == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var created []*Order
+	for i := 0; i < DefaultPerPage+2; i++ {
+		order, err := c.CreateOrder(ctx, []ItemRequest{{ProductID: bson.NewObjectID().Hex(), Quantity: i + 1}})
+		require.NoError(t, err)
+		created = append(created, order)
+	}
+
+	page1, err := c.ListOrders(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, page1, DefaultPerPage)
+	assert.Equal(t, *created[len(created)-1], page1[0], "newest first")
+
+	page2, err := c.ListOrders(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, page2, 2)
+	assert.Equal(t, *created[0], page2[1])
+}
@@ -4,8 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
+	"time"
 
 	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/logger"
+	"github.com/y7ls8i/kart/metrics"
+	"github.com/y7ls8i/kart/tracing"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
@@ -23,7 +28,72 @@ type Product struct {
 }
 
 // ListProducts returns the list of products.
-func (c *Client) ListProducts(ctx context.Context, page int) ([]Product, error) {
+func (c *Client) ListProducts(ctx context.Context, page int) (products []Product, err error) {
+	defer metrics.ObserveMongo("ListProducts", time.Now())
+	ctx, span := c.startSpan(ctx, "ListProducts", CollectionNameProducts)
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	products, err = c.findProductPage(ctx, bson.M{}, page)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Debug("Mongo products listed", "page", page, "count", len(products))
+	return products, nil
+}
+
+// ProductFilter filters the products returned by SearchProducts. The empty fields do not filter.
+type ProductFilter struct {
+	Category string
+	// Name matches the products whose name contains it, ignoring case.
+	Name     string
+	MinPrice *float64
+	MaxPrice *float64
+}
+
+// query returns the MongoDB query of the filter.
+func (f ProductFilter) query() bson.M {
+	query := bson.M{}
+	if f.Category != "" {
+		query["category"] = f.Category
+	}
+	if f.Name != "" {
+		query["name"] = bson.M{"$regex": regexp.QuoteMeta(f.Name), "$options": "i"}
+	}
+	price := bson.M{}
+	if f.MinPrice != nil {
+		price["$gte"] = *f.MinPrice
+	}
+	if f.MaxPrice != nil {
+		price["$lte"] = *f.MaxPrice
+	}
+	if len(price) > 0 {
+		query["price"] = price
+	}
+	return query
+}
+
+// SearchProducts returns a page of the products that match the filter.
+func (c *Client) SearchProducts(ctx context.Context, filter ProductFilter, page int) (products []Product, err error) {
+	defer metrics.ObserveMongo("SearchProducts", time.Now())
+	ctx, span := c.startSpan(ctx, "SearchProducts", CollectionNameProducts)
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	products, err = c.findProductPage(ctx, filter.query(), page)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Debug("Mongo products searched", "page", page, "count", len(products))
+	return products, nil
+}
+
+// findProductPage returns the page of the products that match the query, or an empty array.
+func (c *Client) findProductPage(ctx context.Context, query bson.M, page int) ([]Product, error) {
 	coll := c.client.Database(c.db).Collection(CollectionNameProducts)
 
 	if page < 1 {
@@ -34,7 +104,7 @@ func (c *Client) ListProducts(ctx context.Context, page int) ([]Product, error)
 	findOptions.SetLimit(int64(DefaultPerPage))
 	findOptions.SetSkip(int64((page - 1) * DefaultPerPage))
 
-	cursor, err := coll.Find(ctx, bson.M{}, findOptions)
+	cursor, err := coll.Find(ctx, query, findOptions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find products: %w", err)
 	}
@@ -46,15 +116,20 @@ func (c *Client) ListProducts(ctx context.Context, page int) ([]Product, error)
 	if err := cursor.All(ctx, &products); err != nil {
 		return nil, fmt.Errorf("failed to get all products: %w", err)
 	}
-
 	return products, nil
 }
 
 // GetProduct returns the requested product.
-func (c *Client) GetProduct(ctx context.Context, id string) (*Product, error) {
+func (c *Client) GetProduct(ctx context.Context, id string) (result *Product, err error) {
+	defer metrics.ObserveMongo("GetProduct", time.Now())
+	ctx, span := c.startSpan(ctx, "GetProduct", CollectionNameProducts)
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
 	bsonID, err := bson.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %w", aperr.ErrBadRequest, err)
+		return nil, invalidProductID(id, err)
 	}
 
 	coll := c.client.Database(c.db).Collection(CollectionNameProducts)
@@ -62,21 +137,28 @@ func (c *Client) GetProduct(ctx context.Context, id string) (*Product, error) {
 	var product Product
 	if err := coll.FindOne(ctx, bson.M{"_id": bsonID}).Decode(&product); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, fmt.Errorf("%w: %w", aperr.ErrNotFound, err)
+			return nil, aperr.New(aperr.ErrNotFound, aperr.CodeProductNotFound, fmt.Sprintf("product %q not found", id)).WithCause(err)
 		}
 		return nil, fmt.Errorf("failed to get product: %w", err)
 	}
 
+	logger.FromContext(ctx).Debug("Mongo product found", "productId", id)
 	return &product, nil
 }
 
 // FindProducts returns the requested products and informs which product ids are missing.
 func (c *Client) FindProducts(ctx context.Context, ids []string) (missing []string, products []Product, err error) {
+	defer metrics.ObserveMongo("FindProducts", time.Now())
+	ctx, span := c.startSpan(ctx, "FindProducts", CollectionNameProducts)
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
 	productIDs := make([]bson.ObjectID, 0, len(ids))
 	for _, id := range ids {
 		bsonID, err := bson.ObjectIDFromHex(id)
 		if err != nil {
-			return nil, nil, fmt.Errorf("%w: %w", aperr.ErrBadRequest, err)
+			return nil, nil, invalidProductID(id, err)
 		}
 		productIDs = append(productIDs, bsonID)
 	}
@@ -108,5 +190,84 @@ func (c *Client) FindProducts(ctx context.Context, ids []string) (missing []stri
 		}
 	}
 
+	logger.FromContext(ctx).Debug("Mongo products found", "requested", len(ids), "found", len(products), "missing", len(missing))
 	return missing, products, nil
 }
+
+// UpsertProducts inserts the products, replacing the products that already exist with the same ID.
+// The products with a zero ID are given a new one.
+func (c *Client) UpsertProducts(ctx context.Context, products []Product) (inserted, updated int, err error) {
+	defer metrics.ObserveMongo("UpsertProducts", time.Now())
+	ctx, span := c.startSpan(ctx, "UpsertProducts", CollectionNameProducts)
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	if len(products) == 0 {
+		return 0, 0, nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(products))
+	for i := range products {
+		if products[i].ID.IsZero() {
+			products[i].ID = bson.NewObjectID()
+		}
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": products[i].ID}).
+			SetReplacement(products[i]).
+			SetUpsert(true))
+	}
+
+	coll := c.client.Database(c.db).Collection(CollectionNameProducts)
+	result, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to upsert products: %w", err)
+	}
+
+	logger.FromContext(ctx).Debug("Mongo products upserted", "inserted", result.UpsertedCount, "updated", result.MatchedCount)
+	return int(result.UpsertedCount), int(result.MatchedCount), nil
+}
+
+// EachProduct calls fn with every product, sorted by ID, and stops at the first error of fn.
+// It is not bounded by OperationTimeout, as it reads the whole collection; ctx bounds it.
+func (c *Client) EachProduct(ctx context.Context, fn func(Product) error) (err error) {
+	defer metrics.ObserveMongo("EachProduct", time.Now())
+	ctx, span := c.startSpan(ctx, "EachProduct", CollectionNameProducts)
+	defer func() { tracing.End(span, err) }()
+
+	coll := c.client.Database(c.db).Collection(CollectionNameProducts)
+	cursor, err := coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return fmt.Errorf("failed to find products: %w", err)
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	for cursor.Next(ctx) {
+		product := Product{}
+		if err := cursor.Decode(&product); err != nil {
+			return fmt.Errorf("failed to decode product: %w", err)
+		}
+		if err := fn(product); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to read products: %w", err)
+	}
+	return nil
+}
+
+// invalidProductID returns the error of a product ID that is not a valid ObjectID.
+func invalidProductID(id string, err error) error {
+	return aperr.New(aperr.ErrBadRequest, aperr.CodeInvalidProductID, fmt.Sprintf("invalid product id %q", id)).
+		With("productId", id).
+		WithCause(err)
+}
+
+// IsValidID reports whether id is a valid product ID.
+func IsValidID(id string) bool {
+	_, err := bson.ObjectIDFromHex(id)
+	return err == nil
+}
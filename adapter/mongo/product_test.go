@@ -225,3 +225,105 @@ func TestFindProducts(t *testing.T) {
 		assert.Nil(t, products)
 	})
 }
+
+func TestSearchProducts(t *testing.T) {
+	t.Parallel()
+
+	c := newTestClient(t)
+	if c == nil {
+		return
+	}
+
+	products := []Product{
+		{ID: bson.NewObjectID(), Category: "burger", Name: "Cheese Burger", Price: 8},
+		{ID: bson.NewObjectID(), Category: "burger", Name: "Veggie Burger", Price: 12},
+		{ID: bson.NewObjectID(), Category: "drink", Name: "Cola", Price: 2},
+	}
+	insertTestProducts(t, c, products)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	maxPrice := 10.0
+	found, err := c.SearchProducts(ctx, ProductFilter{Category: "burger", Name: "burger", MaxPrice: &maxPrice}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []Product{products[0]}, found)
+
+	found, err = c.SearchProducts(ctx, ProductFilter{Name: "nothing"}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []Product{}, found)
+}
+
+func TestProductFilter_query(t *testing.T) {
+	minPrice, maxPrice := 1.5, 10.0
+
+	testCases := []struct {
+		name     string
+		filter   ProductFilter
+		expected bson.M
+	}{
+		{
+			name:     "empty",
+			filter:   ProductFilter{},
+			expected: bson.M{},
+		},
+		{
+			name:   "all",
+			filter: ProductFilter{Category: "burger", Name: "Big (XL)", MinPrice: &minPrice, MaxPrice: &maxPrice},
+			expected: bson.M{
+				"category": "burger",
+				"name":     bson.M{"$regex": `Big \(XL\)`, "$options": "i"},
+				"price":    bson.M{"$gte": 1.5, "$lte": 10.0},
+			},
+		},
+		{
+			name:     "min price only",
+			filter:   ProductFilter{MinPrice: &minPrice},
+			expected: bson.M{"price": bson.M{"$gte": 1.5}},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.filter.query())
+		})
+	}
+}
+
+func TestUpsertProducts(t *testing.T) {
+	c := newTestClient(t)
+	if c == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	existing := Product{ID: bson.NewObjectID(), Category: "cat", Name: "old", Price: 1}
+	insertTestProducts(t, c, []Product{existing})
+
+	products := []Product{
+		{ID: existing.ID, Category: "cat", Name: "new", Price: 2},
+		{Category: "cat", Name: "created", Price: 3},
+	}
+	inserted, updated, err := c.UpsertProducts(ctx, products)
+	require.NoError(t, err)
+	assert.Equal(t, 1, inserted)
+	assert.Equal(t, 1, updated)
+	assert.False(t, products[1].ID.IsZero())
+
+	var exported []Product
+	require.NoError(t, c.EachProduct(ctx, func(p Product) error {
+		exported = append(exported, p)
+		return nil
+	}))
+	assert.ElementsMatch(t, products, exported)
+
+	stop := errors.New("stop")
+	count := 0
+	err = c.EachProduct(ctx, func(p Product) error {
+		count++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, count)
+}
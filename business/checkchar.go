@@ -0,0 +1,88 @@
+package business
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/y7ls8i/kart/adapter/mongo"
+	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/logger"
+)
+
+// DefaultCouponAlphabet is the alphabet of the generated coupon codes: the digits and upper case letters without the
+// ambiguous 0, 1, I and O.
+const DefaultCouponAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+// CheckCharacter returns the Luhn mod N check character of code, N being the number of characters of alphabet.
+// It detects any single wrong character and most transpositions of adjacent characters.
+func CheckCharacter(alphabet, code string) (rune, error) {
+	chars := []rune(alphabet)
+	sum, err := luhnSum(chars, code, 2)
+	if err != nil {
+		return 0, err
+	}
+	return chars[(len(chars)-sum%len(chars))%len(chars)], nil
+}
+
+// ValidCheckCharacter reports whether the last character of code is the check character of the others.
+func ValidCheckCharacter(alphabet, code string) bool {
+	sum, err := luhnSum([]rune(alphabet), code, 1)
+	return err == nil && code != "" && sum%len([]rune(alphabet)) == 0
+}
+
+// luhnSum returns the Luhn mod N sum of code, the factor of the last character being factor.
+func luhnSum(chars []rune, code string, factor int) (int, error) {
+	n := len(chars)
+	if n < 2 {
+		return 0, fmt.Errorf("the alphabet must have at least 2 characters")
+	}
+	runes := []rune(code)
+	sum := 0
+	for i := len(runes) - 1; i >= 0; i-- {
+		index := slices.Index(chars, runes[i])
+		if index < 0 {
+			return 0, fmt.Errorf("%q is not in the alphabet", runes[i])
+		}
+		addend := factor * index
+		sum += addend/n + addend%n
+		factor = 3 - factor
+	}
+	return sum, nil
+}
+
+// VerifyCheckCharacters returns a coupon store that looks the coupons up in store, except the codes that start with
+// one of prefixes and whose last character is not the check character of the characters after it, which are not found
+// without touching store. Those are the codes generated by kart coupons generate with one of prefixes and
+// alphabet; the other codes are looked up as they are. store is returned as is if there is no prefix.
+func VerifyCheckCharacters(store CouponStore, alphabet string, prefixes []string) CouponStore {
+	if len(prefixes) == 0 {
+		return store
+	}
+	return &checkCharacterVerifier{store: store, alphabet: alphabet, prefixes: slices.Clone(prefixes)}
+}
+
+type checkCharacterVerifier struct {
+	store    CouponStore
+	alphabet string
+	prefixes []string
+}
+
+// FindOneCoupon looks the coupon up in the store, unless its check character is wrong.
+func (v *checkCharacterVerifier) FindOneCoupon(ctx context.Context, code string) (*mongo.Coupon, error) {
+	prefixed := false
+	for _, prefix := range v.prefixes {
+		if rest, ok := strings.CutPrefix(code, prefix); ok {
+			if ValidCheckCharacter(v.alphabet, rest) {
+				return v.store.FindOneCoupon(ctx, code)
+			}
+			prefixed = true
+		}
+	}
+	if prefixed {
+		logger.FromContext(ctx).Debug("Coupon check character is wrong", "couponCode", code)
+		return nil, aperr.ErrNotFound
+	}
+	return v.store.FindOneCoupon(ctx, code)
+}
@@ -0,0 +1,116 @@
+package business_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/business"
+	aperr "github.com/y7ls8i/kart/error"
+)
+
+func TestCheckCharacter(t *testing.T) {
+	testCases := []struct {
+		name          string
+		alphabet      string
+		code          string
+		expected      rune
+		expectedError string
+	}{
+		{name: "luhn", alphabet: "0123456789", code: "7992739871", expected: '3'},
+		{name: "default alphabet", alphabet: business.DefaultCouponAlphabet, code: "HAPPYHRS", expected: 'X'},
+		{name: "empty", alphabet: business.DefaultCouponAlphabet, code: "", expected: '2'},
+		{name: "not in the alphabet", alphabet: business.DefaultCouponAlphabet, code: "HAPPY0", expectedError: `'0' is not in the alphabet`},
+		{name: "short alphabet", alphabet: "A", code: "A", expectedError: "the alphabet must have at least 2 characters"},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			check, err := business.CheckCharacter(test.alphabet, test.code)
+			if test.expectedError != "" {
+				require.EqualError(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, string(test.expected), string(check))
+			assert.True(t, business.ValidCheckCharacter(test.alphabet, test.code+string(check)))
+		})
+	}
+}
+
+func TestValidCheckCharacter(t *testing.T) {
+	alphabet := business.DefaultCouponAlphabet
+	code := "K7MQ2XPA"
+	check, err := business.CheckCharacter(alphabet, code)
+	require.NoError(t, err)
+	valid := []rune(code + string(check))
+	require.True(t, business.ValidCheckCharacter(alphabet, string(valid)))
+
+	// every single wrong character is detected
+	for i := range valid {
+		for _, char := range alphabet {
+			if char == valid[i] {
+				continue
+			}
+			wrong := append([]rune{}, valid...)
+			wrong[i] = char
+			assert.False(t, business.ValidCheckCharacter(alphabet, string(wrong)), string(wrong))
+		}
+	}
+	// and so is every transposition of different adjacent characters
+	for i := range len(valid) - 1 {
+		if valid[i] == valid[i+1] {
+			continue
+		}
+		swapped := append([]rune{}, valid...)
+		swapped[i], swapped[i+1] = swapped[i+1], swapped[i]
+		assert.False(t, business.ValidCheckCharacter(alphabet, string(swapped)), string(swapped))
+	}
+
+	assert.False(t, business.ValidCheckCharacter(alphabet, ""))
+	assert.False(t, business.ValidCheckCharacter(alphabet, "HAPPY0"))
+}
+
+func TestVerifyCheckCharacters(t *testing.T) {
+	alphabet := business.DefaultCouponAlphabet
+	check, err := business.CheckCharacter(alphabet, "K7MQ2XPA")
+	require.NoError(t, err)
+	generated := "SUMMERK7MQ2XPA" + string(check)
+
+	testCases := []struct {
+		name         string
+		code         string
+		expectedCode string // the code looked up in the store, empty if none
+	}{
+		{name: "valid check character", code: generated, expectedCode: generated},
+		{name: "wrong check character", code: generated[:len(generated)-1] + "Z"},
+		{name: "not in the alphabet", code: "SUMMER0000"},
+		{name: "prefix only", code: "SUMMER"},
+		{name: "longer prefix", code: "SUMMERSALE" + "K7MQ2XPA" + string(check), expectedCode: "SUMMERSALE" + "K7MQ2XPA" + string(check)},
+		{name: "other prefix", code: "HAPPYHRS", expectedCode: "HAPPYHRS"},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			db := &mockDB{findOneCouponCoupon: &mongo.Coupon{Code: test.code}}
+			store := business.VerifyCheckCharacters(db, alphabet, []string{"SUMMER", "SUMMERSALE"})
+			coupon, err := store.FindOneCoupon(context.Background(), test.code)
+			assert.Equal(t, test.expectedCode, db.code)
+			if test.expectedCode == "" {
+				require.ErrorIs(t, err, aperr.ErrNotFound)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.code, coupon.Code)
+		})
+	}
+
+	t.Run("no prefix", func(t *testing.T) {
+		db := &mockDB{}
+		assert.Same(t, db, business.VerifyCheckCharacters(db, alphabet, nil))
+	})
+}
@@ -0,0 +1,123 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/y7ls8i/kart/adapter/mongo"
+	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/logger"
+	"github.com/y7ls8i/kart/tracing"
+	"github.com/y7ls8i/kart/validation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CouponCheck represents whether a coupon code can be used in an order.
+type CouponCheck struct {
+	Code  string `json:"code"`
+	Valid bool   `json:"valid"`
+}
+
+// CouponPreviewRequest represents the request of a discount preview: the items of the order to come.
+type CouponPreviewRequest struct {
+	Items []mongo.ItemRequest `json:"items"`
+}
+
+// CouponPreview represents the discount a coupon would give on an order.
+// Subtotal is the price of the items, and Total is Subtotal less Discount. An invalid coupon gives no discount.
+type CouponPreview struct {
+	CouponCheck
+	Subtotal float64 `json:"subtotal"`
+	Discount float64 `json:"discount"`
+	Total    float64 `json:"total"`
+}
+
+// CanonicalCouponCode returns the canonical form of a coupon code, the form the coupons are saved and looked up in:
+// without the spaces and the '-', '_' and '.' separators, in upper case. "happy-hrs " and "HAPPYHRS" are the same code.
+func CanonicalCouponCode(code string) string {
+	return strings.ToUpper(strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '-' || r == '_' || r == '.' {
+			return -1
+		}
+		return r
+	}, code))
+}
+
+// CheckCoupon returns whether the coupon code is valid. An unknown code is not an error, it is not valid.
+// The code is looked up, and returned, in its canonical form.
+func (b *Business) CheckCoupon(ctx context.Context, code string) (result *CouponCheck, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "business.CheckCoupon")
+	defer func() { tracing.End(span, err) }()
+
+	result = &CouponCheck{Code: CanonicalCouponCode(code)}
+	if result.Code == "" {
+		return result, nil
+	}
+	if _, err := b.coupons.FindOneCoupon(ctx, result.Code); err != nil {
+		if !errors.Is(err, aperr.ErrNotFound) {
+			return nil, fmt.Errorf("failed to find one coupon: %w", err)
+		}
+		logger.FromContext(ctx).Debug("Coupon checked", "valid", false)
+		return result, nil
+	}
+
+	logger.FromContext(ctx).Debug("Coupon checked", "valid", true)
+	result.Valid = true
+	return result, nil
+}
+
+// PreviewCoupon returns the discount the coupon code would give on an order of the items, which are checked like
+// CreateOrder checks them. No order is created.
+func (b *Business) PreviewCoupon(ctx context.Context, code string, req CouponPreviewRequest) (result *CouponPreview, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "business.PreviewCoupon", trace.WithAttributes(
+		attribute.Int("order.items", len(req.Items)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	var violations validation.Violations
+	missing, products, err := b.checkItems(ctx, req.Items, &violations)
+	if err != nil {
+		return nil, err
+	}
+	if len(violations) > 0 {
+		verr := violations.Problem(aperr.ErrUnprocessableEntity, aperr.CodeValidationFailed)
+		if len(missing) > 0 {
+			verr.With("missingProductIds", missing)
+		}
+		return nil, verr
+	}
+
+	check, err := b.CheckCoupon(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make(map[string]float64, len(products))
+	for _, product := range products {
+		prices[product.ID.Hex()] = product.Price
+	}
+	subtotal := 0.0
+	for _, item := range req.Items {
+		subtotal += prices[item.ProductID] * float64(item.Quantity)
+	}
+
+	// the coupons do not carry discount rules yet, so a valid coupon gives no discount either
+	discount := 0.0
+	result = &CouponPreview{
+		CouponCheck: *check,
+		Subtotal:    cents(subtotal),
+		Discount:    cents(discount),
+		Total:       cents(subtotal - discount),
+	}
+	return result, nil
+}
+
+// cents rounds the amount to the cent, so that the sums of prices do not show floating-point errors.
+func cents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
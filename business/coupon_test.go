@@ -0,0 +1,186 @@
+package business_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/business"
+	aperr "github.com/y7ls8i/kart/error"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestBusiness_CheckCoupon(t *testing.T) {
+	testCases := []struct {
+		name           string
+		code           string
+		mock           *mockDB
+		expectedResult *business.CouponCheck
+		expectedErr    error
+	}{
+		{
+			name:           "valid",
+			code:           "HAPPYHRS",
+			mock:           &mockDB{findOneCouponCoupon: &mongo.Coupon{Code: "HAPPYHRS"}},
+			expectedResult: &business.CouponCheck{Code: "HAPPYHRS", Valid: true},
+		},
+		{
+			name:           "not found",
+			code:           "NOPE",
+			mock:           &mockDB{findOneCouponErr: aperr.ErrNotFound},
+			expectedResult: &business.CouponCheck{Code: "NOPE", Valid: false},
+		},
+		{
+			name:           "canonical form",
+			code:           " happy-hrs",
+			mock:           &mockDB{findOneCouponCoupon: &mongo.Coupon{Code: "HAPPYHRS"}},
+			expectedResult: &business.CouponCheck{Code: "HAPPYHRS", Valid: true},
+		},
+		{
+			name:           "separators only",
+			code:           "-_.",
+			mock:           &mockDB{findOneCouponErr: errors.New("not called")},
+			expectedResult: &business.CouponCheck{Code: "", Valid: false},
+		},
+		{
+			name:           "empty",
+			code:           "",
+			mock:           &mockDB{findOneCouponErr: errors.New("not called")},
+			expectedResult: &business.CouponCheck{Code: "", Valid: false},
+		},
+		{
+			name:        "internal error",
+			code:        "HAPPYHRS",
+			mock:        &mockDB{findOneCouponErr: errors.New("internal error")},
+			expectedErr: errors.New("failed to find one coupon: internal error"),
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			b := business.NewBusiness(test.mock, test.mock, test.mock)
+			result, err := b.CheckCoupon(context.Background(), test.code)
+			if test.expectedErr != nil {
+				require.EqualError(t, err, test.expectedErr.Error())
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, test.expectedResult, result)
+			}
+		})
+	}
+}
+
+func TestCanonicalCouponCode(t *testing.T) {
+	testCases := []struct {
+		code     string
+		expected string
+	}{
+		{code: "HAPPYHRS", expected: "HAPPYHRS"},
+		{code: "birthday", expected: "BIRTHDAY"},
+		{code: "  Happy Hrs\t", expected: "HAPPYHRS"},
+		{code: "HAPPY-HRS", expected: "HAPPYHRS"},
+		{code: "happy_hrs.2026", expected: "HAPPYHRS2026"},
+		{code: " -_. ", expected: ""},
+	}
+	for _, test := range testCases {
+		t.Run(test.code, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, test.expected, business.CanonicalCouponCode(test.code))
+		})
+	}
+}
+
+func TestBusiness_PreviewCoupon(t *testing.T) {
+	product1, product2 := bson.NewObjectID(), bson.NewObjectID()
+	products := []mongo.Product{{ID: product1, Name: "product1", Price: 0.1}, {ID: product2, Name: "product2", Price: 6.5}}
+	items := []mongo.ItemRequest{{ProductID: product1.Hex(), Quantity: 3}, {ProductID: product2.Hex(), Quantity: 2}}
+
+	testCases := []struct {
+		name           string
+		code           string
+		req            business.CouponPreviewRequest
+		mock           *mockDB
+		expectedResult *business.CouponPreview
+		expectedErr    error
+		expectedErrIs  error
+	}{
+		{
+			name: "valid coupon",
+			code: "HAPPYHRS",
+			req:  business.CouponPreviewRequest{Items: items},
+			mock: &mockDB{findProductsProducts: products, findOneCouponCoupon: &mongo.Coupon{Code: "HAPPYHRS"}},
+			expectedResult: &business.CouponPreview{
+				CouponCheck: business.CouponCheck{Code: "HAPPYHRS", Valid: true},
+				Subtotal:    13.3,
+				Discount:    0,
+				Total:       13.3,
+			},
+		},
+		{
+			name: "invalid coupon",
+			code: "NOPE",
+			req:  business.CouponPreviewRequest{Items: items},
+			mock: &mockDB{findProductsProducts: products, findOneCouponErr: aperr.ErrNotFound},
+			expectedResult: &business.CouponPreview{
+				CouponCheck: business.CouponCheck{Code: "NOPE", Valid: false},
+				Subtotal:    13.3,
+				Total:       13.3,
+			},
+		},
+		{
+			name:          "invalid items",
+			code:          "HAPPYHRS",
+			req:           business.CouponPreviewRequest{Items: []mongo.ItemRequest{{ProductID: product1.Hex(), Quantity: 0}}},
+			mock:          &mockDB{findProductsProducts: products[:1]},
+			expectedErr:   errors.New("unprocessable entity: /items/0/quantity must be positive"),
+			expectedErrIs: aperr.ErrUnprocessableEntity,
+		},
+		{
+			name:          "no items",
+			code:          "HAPPYHRS",
+			req:           business.CouponPreviewRequest{Items: []mongo.ItemRequest{}},
+			mock:          &mockDB{},
+			expectedErr:   errors.New("unprocessable entity: /items is required"),
+			expectedErrIs: aperr.ErrUnprocessableEntity,
+		},
+		{
+			name:          "product not found",
+			code:          "HAPPYHRS",
+			req:           business.CouponPreviewRequest{Items: items},
+			mock:          &mockDB{findProductsMissing: []string{product2.Hex()}, findProductsProducts: products[:1]},
+			expectedErr:   errors.New("unprocessable entity: /items/1/productId product not found"),
+			expectedErrIs: aperr.ErrUnprocessableEntity,
+		},
+		{
+			name:        "find products internal error",
+			code:        "HAPPYHRS",
+			req:         business.CouponPreviewRequest{Items: items},
+			mock:        &mockDB{findProductsErr: errors.New("internal error")},
+			expectedErr: errors.New("failed to find products: internal error"),
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			b := business.NewBusiness(test.mock, test.mock, test.mock)
+			result, err := b.PreviewCoupon(context.Background(), test.code, test.req)
+			if test.expectedErr != nil {
+				require.EqualError(t, err, test.expectedErr.Error())
+				if test.expectedErrIs != nil {
+					assert.ErrorIs(t, err, test.expectedErrIs)
+				}
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, test.expectedResult, result)
+			}
+			// no order is created
+			assert.Nil(t, test.mock.items)
+		})
+	}
+}
@@ -9,23 +9,38 @@ import (
 
 	"github.com/y7ls8i/kart/adapter/mongo"
 	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/logger"
+	"github.com/y7ls8i/kart/metrics"
+	"github.com/y7ls8i/kart/tracing"
+	"github.com/y7ls8i/kart/validation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // DB is the interface for the database layer that is required by the business layer.
 type DB interface {
 	CreateOrder(ctx context.Context, items []mongo.ItemRequest) (*mongo.Order, error)
 	FindProducts(ctx context.Context, ids []string) (missing []string, products []mongo.Product, err error)
+}
+
+// CouponStore is the interface for the store of the valid coupons, the database or an index file.
+// FindOneCoupon returns aperr.ErrNotFound if the coupon does not exist or is not valid.
+type CouponStore interface {
 	FindOneCoupon(ctx context.Context, code string) (coupon *mongo.Coupon, err error)
 }
 
 // Business struct represents the business layer object.
 type Business struct {
-	db DB
+	db           DB
+	coupons      CouponStore
+	orderCoupons CouponStore
 }
 
-// NewBusiness returns a new business layer object.
-func NewBusiness(db DB) *Business {
-	return &Business{db: db}
+// NewBusiness returns a new business layer object, which looks the coupons up in coupons, and in orderCoupons when
+// it creates an order. orderCoupons is usually coupons throttled by ThrottleCoupons, so that the codes cannot be
+// guessed through the orders without locking out the users who check a code as they type it.
+func NewBusiness(db DB, coupons, orderCoupons CouponStore) *Business {
+	return &Business{db: db, coupons: coupons, orderCoupons: orderCoupons}
 }
 
 // Order represents an order.
@@ -42,42 +57,104 @@ type OrderRequest struct {
 
 // CreateOrder creates a new order.
 func (b *Business) CreateOrder(ctx context.Context, req OrderRequest) (result *Order, err error) {
-	// 1. check quantity
-	productIDs := make([]string, 0, len(req.Items))
-	for _, item := range req.Items {
-		if item.Quantity <= 0 {
-			return nil, fmt.Errorf("%w: quantity must be positive", aperr.ErrUnprocessableEntity)
-		}
-		productIDs = append(productIDs, item.ProductID)
-	}
+	ctx, span := tracing.Tracer().Start(ctx, "business.CreateOrder", trace.WithAttributes(
+		attribute.Int("order.items", len(req.Items)),
+		attribute.Bool("order.coupon", req.CouponCode != ""),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	log := logger.FromContext(ctx)
 
-	// 2. check if products exist
-	missing, products, err := b.db.FindProducts(ctx, productIDs)
+	// 1. check the items, and if their products exist
+	var violations validation.Violations
+	missing, products, err := b.checkItems(ctx, req.Items, &violations)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find products: %w", err)
-	}
-	if len(missing) > 0 {
-		return nil, fmt.Errorf("%w: product ids not found: %v", aperr.ErrUnprocessableEntity, missing)
+		return nil, err
 	}
 
-	// 3. check if the coupon exists
+	// 2. check if the coupon exists, in its canonical form
 	if req.CouponCode != "" {
-		if _, err := b.db.FindOneCoupon(ctx, req.CouponCode); err != nil {
-			if errors.Is(err, aperr.ErrNotFound) {
-				return nil, fmt.Errorf("%w: coupon %q not found", aperr.ErrUnprocessableEntity, req.CouponCode)
-			}
+		err := aperr.ErrNotFound // a code of separators only is no code
+		if code := CanonicalCouponCode(req.CouponCode); code != "" {
+			_, err = b.orderCoupons.FindOneCoupon(ctx, code)
+		}
+		switch {
+		case err == nil:
+		case errors.Is(err, aperr.ErrTooManyRequests):
+			metrics.CouponRejections.WithLabelValues(metrics.CouponRejectionThrottled).Inc()
+			log.Info("Order rejected", "reason", "too many failed coupon attempts")
+			return nil, err
+		case errors.Is(err, aperr.ErrNotFound):
+			metrics.CouponRejections.WithLabelValues(metrics.CouponRejectionNotFound).Inc()
+			violations.Add(validation.Pointer("couponCode"), aperr.CodeCouponNotFound, fmt.Sprintf("coupon %q not found", req.CouponCode))
+		default:
 			return nil, fmt.Errorf("failed to find one coupon: %w", err)
 		}
 	}
 
+	if len(violations) > 0 {
+		verr := violations.Problem(aperr.ErrUnprocessableEntity, aperr.CodeValidationFailed)
+		if len(missing) > 0 {
+			verr.With("missingProductIds", missing)
+		}
+		log.Info("Order rejected", "violations", verr.Detail)
+		return nil, verr
+	}
+
 	orderCreated, err := b.db.CreateOrder(ctx, req.Items)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create order: %w", err)
 	}
 
+	log.Info("Order created", "orderId", orderCreated.ID.Hex(), "items", len(orderCreated.Items))
+	metrics.OrdersCreated.Inc()
+
 	result = &Order{
 		Order:    orderCreated,
 		Products: products,
 	}
 	return result, nil
 }
+
+// checkItems adds the violations of the items to violations, and returns the products of the items that exist and the
+// IDs of the ones that do not.
+func (b *Business) checkItems(ctx context.Context, items []mongo.ItemRequest, violations *validation.Violations) (
+	missing []string, products []mongo.Product, err error,
+) {
+	if len(items) == 0 {
+		violations.Add(validation.Pointer("items"), aperr.CodeRequired, "is required")
+		return nil, nil, nil
+	}
+
+	productIDs := make([]string, 0, len(items))
+	lines := make(map[string]int, len(items)) // index of the first item of each product
+	for i, item := range items {
+		pointer := validation.Pointer("items", i, "productId")
+		switch first, duplicate := lines[item.ProductID]; {
+		case item.ProductID == "":
+			violations.Add(pointer, aperr.CodeRequired, "is required")
+		case !mongo.IsValidID(item.ProductID):
+			violations.Add(pointer, aperr.CodeInvalidProductID, fmt.Sprintf("%q is not a valid product id", item.ProductID))
+		case duplicate:
+			violations.Add(pointer, aperr.CodeDuplicateItem, "duplicates "+validation.Pointer("items", first))
+		default:
+			lines[item.ProductID] = i
+			productIDs = append(productIDs, item.ProductID)
+		}
+		if item.Quantity <= 0 {
+			violations.Add(validation.Pointer("items", i, "quantity"), aperr.CodeInvalidQuantity, "must be positive")
+		}
+	}
+
+	missing, products, err = b.db.FindProducts(ctx, productIDs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find products: %w", err)
+	}
+	if len(missing) > 0 {
+		metrics.ProductsMissing.Inc()
+		for _, id := range missing {
+			violations.Add(validation.Pointer("items", lines[id], "productId"), aperr.CodeProductNotFound, "product not found")
+		}
+	}
+	return missing, products, nil
+}
@@ -3,7 +3,6 @@ package business_test
 import (
 	"context"
 	"errors"
-	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -11,6 +10,7 @@ import (
 	"github.com/y7ls8i/kart/adapter/mongo"
 	"github.com/y7ls8i/kart/business"
 	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/validation"
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
@@ -25,6 +25,7 @@ func TestBusiness_CreateOrder(t *testing.T) {
 		expectedResult *business.Order
 		expectedErr    error
 		expectedErrIs  error
+		expectedCode   string
 	}{
 		{
 			name: "success",
@@ -47,8 +48,18 @@ func TestBusiness_CreateOrder(t *testing.T) {
 			req:            business.OrderRequest{CouponCode: "coupon1", Items: []mongo.ItemRequest{{ProductID: productID.Hex(), Quantity: -1}}},
 			mock:           &mockDB{},
 			expectedResult: nil,
-			expectedErr:    errors.New("unprocessable entity: quantity must be positive"),
+			expectedErr:    errors.New("unprocessable entity: /items/0/quantity must be positive"),
 			expectedErrIs:  aperr.ErrUnprocessableEntity,
+			expectedCode:   aperr.CodeValidationFailed,
+		},
+		{
+			name:           "no items",
+			req:            business.OrderRequest{CouponCode: "coupon1"},
+			mock:           &mockDB{},
+			expectedResult: nil,
+			expectedErr:    errors.New("unprocessable entity: /items is required"),
+			expectedErrIs:  aperr.ErrUnprocessableEntity,
+			expectedCode:   aperr.CodeValidationFailed,
 		},
 		{
 			name: "invalid product",
@@ -59,8 +70,9 @@ func TestBusiness_CreateOrder(t *testing.T) {
 				findProductsErr:      nil,
 			},
 			expectedResult: nil,
-			expectedErr:    fmt.Errorf("unprocessable entity: product ids not found: [%s]", productID.Hex()),
+			expectedErr:    errors.New("unprocessable entity: /items/0/productId product not found"),
 			expectedErrIs:  aperr.ErrUnprocessableEntity,
+			expectedCode:   aperr.CodeValidationFailed,
 		},
 		{
 			name: "invalid coupon",
@@ -73,8 +85,35 @@ func TestBusiness_CreateOrder(t *testing.T) {
 				findOneCouponErr:     aperr.ErrNotFound,
 			},
 			expectedResult: nil,
-			expectedErr:    fmt.Errorf(`unprocessable entity: coupon "coupon1" not found`),
+			expectedErr:    errors.New(`unprocessable entity: /couponCode coupon "coupon1" not found`),
+			expectedErrIs:  aperr.ErrUnprocessableEntity,
+			expectedCode:   aperr.CodeValidationFailed,
+		},
+		{
+			name: "too many failed coupon attempts",
+			req:  business.OrderRequest{CouponCode: "coupon1", Items: []mongo.ItemRequest{{ProductID: productID.Hex(), Quantity: 1}}},
+			mock: &mockDB{
+				findProductsMissing:  []string{},
+				findProductsProducts: []mongo.Product{{ID: productID, Name: "product1"}},
+				findOneCouponErr:     aperr.New(aperr.ErrTooManyRequests, aperr.CodeTooManyCouponAttempts, "too many failed coupon attempts"),
+			},
+			expectedResult: nil,
+			expectedErr:    errors.New("too many requests: too many failed coupon attempts"),
+			expectedErrIs:  aperr.ErrTooManyRequests,
+			expectedCode:   aperr.CodeTooManyCouponAttempts,
+		},
+		{
+			name: "coupon of separators only",
+			req:  business.OrderRequest{CouponCode: " - ", Items: []mongo.ItemRequest{{ProductID: productID.Hex(), Quantity: 1}}},
+			mock: &mockDB{
+				findProductsMissing:  []string{},
+				findProductsProducts: []mongo.Product{{ID: productID, Name: "product1"}},
+				findOneCouponErr:     errors.New("not called"),
+			},
+			expectedResult: nil,
+			expectedErr:    errors.New(`unprocessable entity: /couponCode coupon " - " not found`),
 			expectedErrIs:  aperr.ErrUnprocessableEntity,
+			expectedCode:   aperr.CodeValidationFailed,
 		},
 		{
 			name: "find products internal error",
@@ -123,7 +162,7 @@ func TestBusiness_CreateOrder(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			t.Parallel()
 
-			b := business.NewBusiness(test.mock)
+			b := business.NewBusiness(test.mock, test.mock, test.mock)
 			result, err := b.CreateOrder(context.Background(), test.req)
 			if test.expectedErr != nil {
 				require.Error(t, err)
@@ -131,6 +170,11 @@ func TestBusiness_CreateOrder(t *testing.T) {
 				if test.expectedErrIs != nil {
 					assert.True(t, errors.Is(err, test.expectedErrIs))
 				}
+				if test.expectedCode != "" {
+					var apErr *aperr.Error
+					require.True(t, errors.As(err, &apErr))
+					assert.Equal(t, test.expectedCode, apErr.Code)
+				}
 			} else {
 				require.NoError(t, err)
 				assert.Equal(t, test.expectedResult, result)
@@ -171,3 +215,40 @@ func (m *mockDB) FindOneCoupon(_ context.Context, code string) (coupon *mongo.Co
 	m.code = code
 	return m.findOneCouponCoupon, m.findOneCouponErr
 }
+
+func TestCreateOrder_violations(t *testing.T) {
+	valid, missing := bson.NewObjectID().Hex(), bson.NewObjectID().Hex()
+	db := &mockDB{findProductsMissing: []string{missing}, findOneCouponErr: aperr.ErrNotFound}
+	b := business.NewBusiness(db, db, db)
+
+	_, err := b.CreateOrder(context.Background(), business.OrderRequest{
+		Items: []mongo.ItemRequest{
+			{ProductID: "", Quantity: 1},
+			{ProductID: "bad", Quantity: 1},
+			{ProductID: valid, Quantity: 0},
+			{ProductID: valid, Quantity: 2},
+			{ProductID: missing, Quantity: 1},
+		},
+		CouponCode: " no-pe",
+	})
+
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, aperr.ErrUnprocessableEntity))
+	var apErr *aperr.Error
+	require.True(t, errors.As(err, &apErr))
+	assert.Equal(t, aperr.CodeValidationFailed, apErr.Code)
+	assert.Equal(t, []validation.Violation{
+		{Pointer: "/items/0/productId", Code: aperr.CodeRequired, Detail: "is required"},
+		{Pointer: "/items/1/productId", Code: aperr.CodeInvalidProductID, Detail: `"bad" is not a valid product id`},
+		{Pointer: "/items/2/quantity", Code: aperr.CodeInvalidQuantity, Detail: "must be positive"},
+		{Pointer: "/items/3/productId", Code: aperr.CodeDuplicateItem, Detail: "duplicates /items/2"},
+		{Pointer: "/items/4/productId", Code: aperr.CodeProductNotFound, Detail: "product not found"},
+		{Pointer: "/couponCode", Code: aperr.CodeCouponNotFound, Detail: `coupon " no-pe" not found`},
+	}, apErr.Extensions["errors"])
+	assert.Equal(t, []string{missing}, apErr.Extensions["missingProductIds"])
+
+	// only the valid product ids are looked up, once each, the coupon in its canonical form, and no order is created
+	assert.Equal(t, []string{valid, missing}, db.ids)
+	assert.Equal(t, "NOPE", db.code)
+	assert.Nil(t, db.items)
+}
@@ -0,0 +1,118 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/y7ls8i/kart/adapter/mongo"
+	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/logger"
+	"golang.org/x/time/rate"
+)
+
+type clientKey struct{}
+
+// WithClient returns a copy of ctx that carries the client of the request, e.g. its IP address, which the failed
+// coupon attempts are counted by.
+func WithClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// Client returns the client carried by ctx, or an empty string if ctx does not carry one.
+func Client(ctx context.Context) string {
+	client, _ := ctx.Value(clientKey{}).(string)
+	return client
+}
+
+// ThrottleCoupons returns a coupon store that looks the coupons up in store, and rejects the lookups of a client
+// with aperr.ErrTooManyRequests once it has failed maxFailures times, so that the codes cannot be guessed by brute
+// force. The failures are forgotten at the rate of maxFailures per window. The lookups of a context without client
+// are not throttled. store is returned as is if maxFailures is 0.
+func ThrottleCoupons(store CouponStore, maxFailures int, window time.Duration) CouponStore {
+	if maxFailures <= 0 || window <= 0 {
+		return store
+	}
+	return &couponThrottle{
+		store:   store,
+		limit:   rate.Limit(float64(maxFailures) / window.Seconds()),
+		burst:   maxFailures,
+		idle:    window,
+		clients: map[string]*throttledClient{},
+	}
+}
+
+// couponThrottle is a token bucket of failed attempts per client.
+type couponThrottle struct {
+	store CouponStore
+	limit rate.Limit
+	burst int
+	// idle is how long a client is remembered after its last attempt, by then its bucket is full again
+	idle time.Duration
+
+	mu        sync.Mutex
+	clients   map[string]*throttledClient
+	lastSweep time.Time
+}
+
+type throttledClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// FindOneCoupon looks the coupon up in the store, unless the client has no failed attempt left.
+func (t *couponThrottle) FindOneCoupon(ctx context.Context, code string) (*mongo.Coupon, error) {
+	client := Client(ctx)
+	if client == "" {
+		return t.store.FindOneCoupon(ctx, code)
+	}
+
+	now := time.Now()
+	attempt, wait := t.reserve(client, now)
+	if attempt == nil {
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		logger.FromContext(ctx).Warn("Coupon lookup throttled", "client", client, "retryAfter", retryAfter)
+		return nil, aperr.New(aperr.ErrTooManyRequests, aperr.CodeTooManyCouponAttempts, "too many failed coupon attempts").
+			With("retryAfter", retryAfter)
+	}
+
+	coupon, err := t.store.FindOneCoupon(ctx, code)
+	if !errors.Is(err, aperr.ErrNotFound) {
+		// only the codes that are not found are failed attempts; a reservation is given back at the time it was made
+		attempt.CancelAt(now)
+	}
+	return coupon, err
+}
+
+// reserve takes one of the failed attempts of the client before its lookup, so that concurrent lookups cannot fail
+// more than maxFailures times, and returns it to be given back if the lookup does not fail. If the client has no
+// failed attempt left, it returns nil and how long the client should wait for one.
+func (t *couponThrottle) reserve(client string, now time.Time) (*rate.Reservation, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now.Sub(t.lastSweep) > t.idle {
+		for k, c := range t.clients {
+			if now.Sub(c.lastSeen) > t.idle {
+				delete(t.clients, k)
+			}
+		}
+		t.lastSweep = now
+	}
+
+	c, ok := t.clients[client]
+	if !ok {
+		c = &throttledClient{limiter: rate.NewLimiter(t.limit, t.burst)}
+		t.clients[client] = c
+	}
+	c.lastSeen = now
+
+	r := c.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return nil, delay
+	}
+	return r, 0
+}
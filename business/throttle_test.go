@@ -0,0 +1,129 @@
+package business_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/business"
+	aperr "github.com/y7ls8i/kart/error"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestThrottleCoupons(t *testing.T) {
+	db := &mockDB{findOneCouponErr: aperr.ErrNotFound}
+	store := business.ThrottleCoupons(db, 3, time.Hour)
+	client1 := business.WithClient(context.Background(), "192.0.2.1")
+	client2 := business.WithClient(context.Background(), "192.0.2.2")
+
+	for range 3 {
+		_, err := store.FindOneCoupon(client1, "NOPE")
+		require.ErrorIs(t, err, aperr.ErrNotFound)
+	}
+
+	// the fourth attempt is not looked up
+	db.code = ""
+	_, err := store.FindOneCoupon(client1, "NOPE")
+	require.ErrorIs(t, err, aperr.ErrTooManyRequests)
+	var apErr *aperr.Error
+	require.True(t, errors.As(err, &apErr))
+	assert.Equal(t, aperr.CodeTooManyCouponAttempts, apErr.Code)
+	// one attempt is given back every 20 minutes
+	assert.InDelta(t, 1200, apErr.Extensions["retryAfter"], 1)
+	assert.Empty(t, db.code)
+
+	// not even a valid code
+	db.findOneCouponCoupon, db.findOneCouponErr = &mongo.Coupon{Code: "HAPPYHRS"}, nil
+	_, err = store.FindOneCoupon(client1, "HAPPYHRS")
+	require.ErrorIs(t, err, aperr.ErrTooManyRequests)
+
+	// the other clients, and the lookups without client, are not throttled
+	coupon, err := store.FindOneCoupon(client2, "HAPPYHRS")
+	require.NoError(t, err)
+	assert.Equal(t, "HAPPYHRS", coupon.Code)
+	_, err = store.FindOneCoupon(context.Background(), "HAPPYHRS")
+	require.NoError(t, err)
+}
+
+func TestThrottleCoupons_success(t *testing.T) {
+	db := &mockDB{findOneCouponCoupon: &mongo.Coupon{Code: "HAPPYHRS"}}
+	store := business.ThrottleCoupons(db, 1, time.Hour)
+	ctx := business.WithClient(context.Background(), "192.0.2.1")
+
+	// the coupons found do not count
+	for range 3 {
+		_, err := store.FindOneCoupon(ctx, "HAPPYHRS")
+		require.NoError(t, err)
+	}
+}
+
+func TestThrottleCoupons_concurrent(t *testing.T) {
+	db := &slowStore{delay: 50 * time.Millisecond}
+	store := business.ThrottleCoupons(db, 3, time.Hour)
+	ctx := business.WithClient(context.Background(), "192.0.2.1")
+
+	// the lookups in flight use their attempt before they fail
+	var wg sync.WaitGroup
+	var throttled atomic.Int32
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := store.FindOneCoupon(ctx, "NOPE"); errors.Is(err, aperr.ErrTooManyRequests) {
+				throttled.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(3), db.lookups.Load())
+	assert.Equal(t, int32(17), throttled.Load())
+}
+
+func TestThrottleCoupons_disabled(t *testing.T) {
+	db := &mockDB{}
+	assert.Same(t, db, business.ThrottleCoupons(db, 0, time.Hour))
+}
+
+// slowStore is a coupon store that finds no coupon, after delay.
+type slowStore struct {
+	delay   time.Duration
+	lookups atomic.Int32
+}
+
+func (s *slowStore) FindOneCoupon(context.Context, string) (*mongo.Coupon, error) {
+	s.lookups.Add(1)
+	time.Sleep(s.delay)
+	return nil, aperr.ErrNotFound
+}
+
+func TestThrottleCoupons_ordersOnly(t *testing.T) {
+	productID := bson.NewObjectID()
+	db := &mockDB{
+		findProductsProducts: []mongo.Product{{ID: productID, Name: "product1"}},
+		findOneCouponErr:     aperr.ErrNotFound,
+		createOrderResult:    &mongo.Order{ID: bson.NewObjectID()},
+	}
+	b := business.NewBusiness(db, db, business.ThrottleCoupons(db, 3, time.Hour))
+	ctx := business.WithClient(context.Background(), "192.0.2.1")
+
+	// the coupon check, as the user types the code, does not use the failed attempts of the orders
+	for _, code := range []string{"H", "HA", "HAP", "HAPP", "HAPPY", "HAPPYH", "HAPPYHR"} {
+		check, err := b.CheckCoupon(ctx, code)
+		require.NoError(t, err)
+		assert.False(t, check.Valid)
+	}
+
+	db.findOneCouponCoupon, db.findOneCouponErr = &mongo.Coupon{Code: "HAPPYHRS"}, nil
+	order, err := b.CreateOrder(ctx, business.OrderRequest{
+		CouponCode: "HAPPYHRS",
+		Items:      []mongo.ItemRequest{{ProductID: productID.Hex(), Quantity: 1}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, db.createOrderResult, order.Order)
+}
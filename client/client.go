@@ -0,0 +1,294 @@
+// Package client is the Go client of the kart HTTP API.
+//
+// The errors of the API are returned as *aperr.Error values that match the aperr sentinel errors with errors.Is, e.g.
+// errors.Is(err, aperr.ErrNotFound), and carry the error code, the detail and the other fields of the problem.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/business"
+	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/validation"
+)
+
+const (
+	// DefaultMaxRetries is the number of retries used when the config does not set one.
+	DefaultMaxRetries = 3
+	// DefaultBackoff is the wait before the first retry used when the config does not set one.
+	DefaultBackoff = 100 * time.Millisecond
+	// DefaultTimeout is the timeout of the requests used when the config does not set an HTTP client.
+	DefaultTimeout = 30 * time.Second
+)
+
+// ErrServer is the sentinel error of the server errors, and of the responses that are not errors of the API.
+var ErrServer = errors.New("server error")
+
+// statuses maps the status of the responses to the sentinel errors.
+var statuses = map[int]error{
+	http.StatusNotFound:              aperr.ErrNotFound,
+	http.StatusBadRequest:            aperr.ErrBadRequest,
+	http.StatusUnprocessableEntity:   aperr.ErrUnprocessableEntity,
+	http.StatusUnauthorized:          aperr.ErrUnauthorized,
+	http.StatusRequestEntityTooLarge: aperr.ErrTooLarge,
+	http.StatusTooManyRequests:       aperr.ErrTooManyRequests,
+}
+
+// Config structure.
+// BaseURL is the URL of the server, e.g. http://localhost:8000, and APIKey is sent in the Api_key header.
+// HTTPClient is the client that sends the requests, it defaults to a client with DefaultTimeout.
+// MaxRetries is the number of times a failed request is retried, waiting Backoff, doubled on every retry; a negative
+// MaxRetries disables the retries.
+type Config struct {
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
+	MaxRetries int
+	Backoff    time.Duration
+}
+
+// Client is the client of the kart HTTP API.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+	maxRetries int
+	backoff    time.Duration
+}
+
+// NewClient returns a new client of the API.
+func NewClient(conf Config) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(conf.BaseURL, "/"),
+		apiKey:     conf.APIKey,
+		httpClient: conf.HTTPClient,
+		maxRetries: conf.MaxRetries,
+		backoff:    conf.Backoff,
+	}
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	switch {
+	case c.maxRetries == 0:
+		c.maxRetries = DefaultMaxRetries
+	case c.maxRetries < 0:
+		c.maxRetries = 0
+	}
+	if c.backoff <= 0 {
+		c.backoff = DefaultBackoff
+	}
+	return c
+}
+
+// ListProductsOptions are the options of ListProducts.
+// Page is the page number, starting at 1; 0 is the first page.
+type ListProductsOptions struct {
+	Page int
+}
+
+// ListProducts returns a page of products. opts can be nil.
+func (c *Client) ListProducts(ctx context.Context, opts *ListProductsOptions) ([]mongo.Product, error) {
+	query := url.Values{}
+	if opts != nil && opts.Page > 0 {
+		query.Set("page", strconv.Itoa(opts.Page))
+	}
+	var products []mongo.Product
+	if err := c.do(ctx, http.MethodGet, "/api/product", query, nil, &products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// GetProduct returns a single product by ID.
+func (c *Client) GetProduct(ctx context.Context, id string) (*mongo.Product, error) {
+	product := &mongo.Product{}
+	if err := c.do(ctx, http.MethodGet, "/api/product/"+url.PathEscape(id), nil, nil, product); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// CreateOrder places an order.
+// The validation problems of the request are the "errors" field of the returned error, as []validation.Violation.
+func (c *Client) CreateOrder(ctx context.Context, req business.OrderRequest) (*business.Order, error) {
+	order := &business.Order{}
+	if err := c.do(ctx, http.MethodPost, "/api/order", nil, req, order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// CheckCoupon returns whether a coupon code is valid. An invalid code is not an error.
+func (c *Client) CheckCoupon(ctx context.Context, code string) (*business.CouponCheck, error) {
+	check := &business.CouponCheck{}
+	if err := c.do(ctx, http.MethodGet, "/api/coupon/"+url.PathEscape(code), nil, nil, check); err != nil {
+		return nil, err
+	}
+	return check, nil
+}
+
+// PreviewCoupon returns the discount a coupon code would give on an order of the items of req.
+// The validation problems of the items are the "errors" field of the returned error, like with CreateOrder.
+func (c *Client) PreviewCoupon(ctx context.Context, code string, req business.CouponPreviewRequest) (*business.CouponPreview, error) {
+	preview := &business.CouponPreview{}
+	if err := c.do(ctx, http.MethodPost, "/api/coupon/"+url.PathEscape(code)+"/preview", nil, req, preview); err != nil {
+		return nil, err
+	}
+	return preview, nil
+}
+
+// do sends a request with the JSON of body, if not nil, and decodes the JSON response into result.
+// The GET requests are retried on the server errors and on the network errors. The other requests are retried only
+// on 502 and 503, which the API never returns, so the request did not reach it.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, result any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("failed to encode request body: %w", err)
+		}
+	}
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		err := c.send(ctx, method, u, payload, result)
+		if err == nil || attempt >= c.maxRetries || !retryable(method, err) {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// send sends one request.
+func (c *Client) send(ctx context.Context, method, u string, payload []byte, result any) error {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Api_key", c.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return &networkError{err: err}
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return decodeError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// networkError is the error of a request that did not get a response.
+type networkError struct {
+	err error
+}
+
+func (e *networkError) Error() string {
+	return "failed to send request: " + e.err.Error()
+}
+
+func (e *networkError) Unwrap() error {
+	return e.err
+}
+
+// retryable reports whether the request can be retried after err.
+func retryable(method string, err error) bool {
+	var netErr *networkError
+	if errors.As(err, &netErr) {
+		// the context is done, or the request was sent and the response was lost
+		return method == http.MethodGet && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	var apErr *aperr.Error
+	if !errors.As(err, &apErr) || !errors.Is(err, ErrServer) {
+		return false
+	}
+	status, _ := apErr.Extensions["status"].(int)
+	if method == http.MethodGet {
+		return status >= http.StatusInternalServerError
+	}
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable
+}
+
+// problem is an error response of the API, an RFC 9457 problem details.
+type problem struct {
+	Code   string                 `json:"code"`
+	Detail string                 `json:"detail"`
+	Errors []validation.Violation `json:"errors"`
+}
+
+// decodeError returns the error of an error response.
+// The fields of the problem other than type, title, detail, instance and code are the extensions of the error; the
+// status is the "status" extension even if the response is not a problem.
+func decodeError(resp *http.Response) error {
+	kind, ok := statuses[resp.StatusCode]
+	if !ok {
+		kind = ErrServer
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/problem+json" {
+		return aperr.New(kind, "", http.StatusText(resp.StatusCode)).With("status", resp.StatusCode)
+	}
+
+	p := problem{}
+	fields := map[string]json.RawMessage{}
+	if json.Unmarshal(data, &p) != nil || json.Unmarshal(data, &fields) != nil {
+		return aperr.New(kind, "", http.StatusText(resp.StatusCode)).With("status", resp.StatusCode)
+	}
+	if p.Detail == "" {
+		p.Detail = http.StatusText(resp.StatusCode)
+	}
+
+	apErr := aperr.New(kind, p.Code, p.Detail)
+	for k, raw := range fields {
+		switch k {
+		case "type", "title", "status", "detail", "instance", "code":
+		case "errors":
+			apErr.With(k, p.Errors)
+		default:
+			var v any
+			_ = json.Unmarshal(raw, &v)
+			apErr.With(k, v)
+		}
+	}
+	return apErr.With("status", resp.StatusCode)
+}
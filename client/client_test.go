@@ -0,0 +1,348 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/business"
+	"github.com/y7ls8i/kart/client"
+	"github.com/y7ls8i/kart/config"
+	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/server"
+	"github.com/y7ls8i/kart/validation"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// newTestClient returns a client of a test server built with the mocks.
+func newTestClient(t *testing.T, db *mockDB, buss *mockBusiness, apiKey string) *client.Client {
+	t.Helper()
+
+	ts := httptest.NewServer(server.NewServer(config.Server{Mode: "test"}, db, buss))
+	t.Cleanup(ts.Close)
+	return client.NewClient(client.Config{BaseURL: ts.URL, APIKey: apiKey, Backoff: time.Millisecond})
+}
+
+func TestListProducts(t *testing.T) {
+	productID := bson.NewObjectID()
+
+	testCases := []struct {
+		name             string
+		opts             *client.ListProductsOptions
+		mock             *mockDB
+		expectedProducts []mongo.Product
+		expectedPage     int
+		expectedCalls    int32
+		expectedErr      error
+	}{
+		{
+			name:             "success, no options",
+			mock:             &mockDB{listProductsResult: []mongo.Product{{ID: productID, Name: "product1"}}},
+			expectedProducts: []mongo.Product{{ID: productID, Name: "product1"}},
+			expectedCalls:    1,
+		},
+		{
+			name:             "success, paged",
+			opts:             &client.ListProductsOptions{Page: 3},
+			mock:             &mockDB{listProductsResult: []mongo.Product{}},
+			expectedProducts: []mongo.Product{},
+			expectedPage:     3,
+			expectedCalls:    1,
+		},
+		{
+			name: "retried after server errors",
+			mock: &mockDB{
+				listProductsResult: []mongo.Product{{ID: productID, Name: "product1"}},
+				listProductsErrs:   []error{errors.New("connection lost"), errors.New("connection lost")},
+			},
+			expectedProducts: []mongo.Product{{ID: productID, Name: "product1"}},
+			expectedCalls:    3,
+		},
+		{
+			name: "retries exhausted",
+			mock: &mockDB{listProductsErrs: []error{
+				errors.New("connection lost"), errors.New("connection lost"), errors.New("connection lost"), errors.New("connection lost"),
+			}},
+			expectedCalls: 1 + client.DefaultMaxRetries,
+			expectedErr:   client.ErrServer,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := newTestClient(t, test.mock, &mockBusiness{}, "apitest")
+			products, err := c.ListProducts(context.Background(), test.opts)
+
+			assert.Equal(t, test.expectedCalls, test.mock.calls.Load())
+			if test.expectedErr != nil {
+				require.ErrorIs(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedProducts, products)
+			assert.Equal(t, test.expectedPage, test.mock.page)
+		})
+	}
+}
+
+func TestGetProduct(t *testing.T) {
+	productID := bson.NewObjectID()
+
+	testCases := []struct {
+		name            string
+		mock            *mockDB
+		apiKey          string
+		expectedProduct *mongo.Product
+		expectedErr     error
+		expectedCode    string
+		expectedDetail  string
+	}{
+		{
+			name:            "success",
+			mock:            &mockDB{getProductResult: &mongo.Product{ID: productID, Name: "product1", Price: 3.5}},
+			apiKey:          "apitest",
+			expectedProduct: &mongo.Product{ID: productID, Name: "product1", Price: 3.5},
+		},
+		{
+			name:           "not found",
+			mock:           &mockDB{getProductErr: aperr.New(aperr.ErrNotFound, aperr.CodeProductNotFound, "product not found")},
+			apiKey:         "apitest",
+			expectedErr:    aperr.ErrNotFound,
+			expectedCode:   aperr.CodeProductNotFound,
+			expectedDetail: "product not found",
+		},
+		{
+			name:           "unauthorized",
+			mock:           &mockDB{},
+			apiKey:         "wrong",
+			expectedErr:    aperr.ErrUnauthorized,
+			expectedCode:   aperr.CodeUnauthorized,
+			expectedDetail: "missing or invalid API key",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := newTestClient(t, test.mock, &mockBusiness{}, test.apiKey)
+			product, err := c.GetProduct(context.Background(), productID.Hex())
+
+			if test.expectedErr != nil {
+				require.ErrorIs(t, err, test.expectedErr)
+				var apErr *aperr.Error
+				require.ErrorAs(t, err, &apErr)
+				assert.Equal(t, test.expectedCode, apErr.Code)
+				assert.Equal(t, test.expectedDetail, apErr.Detail)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedProduct, product)
+			assert.Equal(t, productID.Hex(), test.mock.id)
+		})
+	}
+}
+
+func TestCreateOrder(t *testing.T) {
+	productID := bson.NewObjectID()
+	orderID := bson.NewObjectID()
+	req := business.OrderRequest{
+		Items:      []mongo.ItemRequest{{ProductID: productID.Hex(), Quantity: 2}},
+		CouponCode: "HAPPYHRS",
+	}
+
+	t.Run("success", func(t *testing.T) {
+		expected := &business.Order{
+			Order:    &mongo.Order{ID: orderID, Items: []mongo.OrderItem{{ProductID: productID, Quantity: 2}}},
+			Products: []mongo.Product{{ID: productID, Name: "product1"}},
+		}
+		buss := &mockBusiness{createOrderResult: expected}
+		c := newTestClient(t, &mockDB{}, buss, "apitest")
+
+		order, err := c.CreateOrder(context.Background(), req)
+		require.NoError(t, err)
+		assert.Equal(t, expected, order)
+		assert.Equal(t, req, buss.req)
+	})
+
+	t.Run("validation failed", func(t *testing.T) {
+		var violations validation.Violations
+		violations.Add("/items/0/productId", aperr.CodeProductNotFound, "product not found")
+		buss := &mockBusiness{createOrderErr: violations.Problem(aperr.ErrUnprocessableEntity, aperr.CodeValidationFailed).
+			With("missingProductIds", []string{productID.Hex()})}
+		c := newTestClient(t, &mockDB{}, buss, "apitest")
+
+		_, err := c.CreateOrder(context.Background(), req)
+		require.ErrorIs(t, err, aperr.ErrUnprocessableEntity)
+		var apErr *aperr.Error
+		require.ErrorAs(t, err, &apErr)
+		assert.Equal(t, aperr.CodeValidationFailed, apErr.Code)
+		assert.Equal(t, "/items/0/productId product not found", apErr.Detail)
+		assert.Equal(t, []validation.Violation(violations), apErr.Extensions["errors"])
+		assert.Equal(t, []any{productID.Hex()}, apErr.Extensions["missingProductIds"])
+		assert.Equal(t, http.StatusUnprocessableEntity, apErr.Extensions["status"])
+	})
+
+	t.Run("server error not retried", func(t *testing.T) {
+		buss := &mockBusiness{createOrderErr: errors.New("connection lost")}
+		c := newTestClient(t, &mockDB{}, buss, "apitest")
+
+		_, err := c.CreateOrder(context.Background(), req)
+		require.ErrorIs(t, err, client.ErrServer)
+		assert.Equal(t, int32(1), buss.calls.Load())
+	})
+}
+
+func TestCheckCoupon(t *testing.T) {
+	buss := &mockBusiness{checkCouponResult: &business.CouponCheck{Code: "HAPPY HRS", Valid: true}}
+	c := newTestClient(t, &mockDB{}, buss, "apitest")
+
+	check, err := c.CheckCoupon(context.Background(), "HAPPY HRS")
+	require.NoError(t, err)
+	assert.Equal(t, &business.CouponCheck{Code: "HAPPY HRS", Valid: true}, check)
+	assert.Equal(t, "HAPPY HRS", buss.code, "the code is escaped in the path")
+}
+
+func TestPreviewCoupon(t *testing.T) {
+	productID := bson.NewObjectID()
+	req := business.CouponPreviewRequest{Items: []mongo.ItemRequest{{ProductID: productID.Hex(), Quantity: 2}}}
+	expected := &business.CouponPreview{CouponCheck: business.CouponCheck{Code: "HAPPYHRS", Valid: true}, Subtotal: 7, Total: 7}
+	buss := &mockBusiness{previewCouponResult: expected}
+	c := newTestClient(t, &mockDB{}, buss, "apitest")
+
+	preview, err := c.PreviewCoupon(context.Background(), "HAPPYHRS", req)
+	require.NoError(t, err)
+	assert.Equal(t, expected, preview)
+	assert.Equal(t, "HAPPYHRS", buss.code)
+	assert.Equal(t, req, buss.previewReq)
+}
+
+func TestRetry(t *testing.T) {
+	t.Run("service unavailable", func(t *testing.T) {
+		calls := atomic.Int32{}
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(`{"id":"000000000000000000000000","items":[],"products":[]}`))
+		}))
+		defer ts.Close()
+		c := client.NewClient(client.Config{BaseURL: ts.URL, Backoff: time.Millisecond})
+
+		_, err := c.CreateOrder(context.Background(), business.OrderRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		calls := atomic.Int32{}
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer ts.Close()
+		c := client.NewClient(client.Config{BaseURL: ts.URL, MaxRetries: -1})
+
+		_, err := c.ListProducts(context.Background(), nil)
+		require.ErrorIs(t, err, client.ErrServer)
+		assert.Equal(t, "server error: Bad Gateway", err.Error())
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("context done while waiting", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer ts.Close()
+		c := client.NewClient(client.Config{BaseURL: ts.URL, Backoff: time.Hour})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := c.ListProducts(ctx, nil)
+		require.ErrorIs(t, err, client.ErrServer)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+type mockDB struct {
+	listProductsResult []mongo.Product
+	listProductsErrs   []error // returned by the successive calls, before listProductsResult
+	getProductResult   *mongo.Product
+	getProductErr      error
+	page               int
+	id                 string
+	calls              atomic.Int32
+}
+
+func (m *mockDB) Ping(_ context.Context) error {
+	return nil
+}
+
+func (m *mockDB) CheckIndexes(_ context.Context) error {
+	return nil
+}
+
+func (m *mockDB) ListProducts(_ context.Context, page int) ([]mongo.Product, error) {
+	m.page = page
+	if call := int(m.calls.Add(1)); call <= len(m.listProductsErrs) {
+		return nil, m.listProductsErrs[call-1]
+	}
+	return m.listProductsResult, nil
+}
+
+func (m *mockDB) GetProduct(_ context.Context, id string) (*mongo.Product, error) {
+	m.id = id
+	return m.getProductResult, m.getProductErr
+}
+
+func (m *mockDB) SearchProducts(_ context.Context, _ mongo.ProductFilter, _ int) ([]mongo.Product, error) {
+	return nil, nil
+}
+
+func (m *mockDB) FindProducts(_ context.Context, _ []string) ([]string, []mongo.Product, error) {
+	return nil, nil, nil
+}
+
+func (m *mockDB) ListOrders(_ context.Context, _ int) ([]mongo.Order, error) {
+	return nil, nil
+}
+
+func (m *mockDB) GetOrder(_ context.Context, _ string) (*mongo.Order, error) {
+	return nil, nil
+}
+
+type mockBusiness struct {
+	createOrderResult *business.Order
+	createOrderErr    error
+	req               business.OrderRequest
+	calls             atomic.Int32
+
+	code                string
+	checkCouponResult   *business.CouponCheck
+	previewCouponResult *business.CouponPreview
+	previewReq          business.CouponPreviewRequest
+}
+
+func (m *mockBusiness) CreateOrder(_ context.Context, req business.OrderRequest) (*business.Order, error) {
+	m.calls.Add(1)
+	m.req = req
+	return m.createOrderResult, m.createOrderErr
+}
+
+func (m *mockBusiness) CheckCoupon(_ context.Context, code string) (*business.CouponCheck, error) {
+	m.code = code
+	return m.checkCouponResult, nil
+}
+
+func (m *mockBusiness) PreviewCoupon(_ context.Context, code string, req business.CouponPreviewRequest) (*business.CouponPreview, error) {
+	m.code, m.previewReq = code, req
+	return m.previewCouponResult, nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/y7ls8i/kart/config"
+)
+
+// apiKeyBytes is the number of random bytes of a generated API key.
+const apiKeyBytes = 32
+
+func init() {
+	register(app.Command("apikey", "Generate a random API key to add to Server.APIKeys."), generateAPIKey)
+}
+
+// generateAPIKey writes a new random API key to the standard output.
+func generateAPIKey(_ context.Context, _ *config.Config) error {
+	key := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate API key: %w", err)
+	}
+	_, err := fmt.Println(base64.RawURLEncoding.EncodeToString(key))
+	return err
+}
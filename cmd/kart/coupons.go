@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/business"
+	"github.com/y7ls8i/kart/config"
+	"github.com/y7ls8i/kart/coupon"
+)
+
+// couponsValidateSet records the rule flags given on the command line, which override the config.
+var couponsValidateSet struct {
+	minFiles, minLength, maxLength, pattern, caseName, canonical bool
+}
+
+var (
+	coupons = app.Command("coupons", "Find the valid coupons and import them.")
+
+	couponsDownload    = coupons.Command("download", "Download the coupon bases.")
+	couponsDownloadDir = couponsDownload.Flag("dir", "Directory of the coupon bases; defaults to Coupons.Dir.").String()
+	couponsDownloadURL = couponsDownload.Flag("url", "Name and URL of a coupon base, e.g. couponbase1=https://..., repeatable; "+
+		"defaults to the coupon bases of Coupons.Bases.").StringMap()
+
+	couponsValidate      = coupons.Command("validate", "Find the valid coupons of the coupon bases.")
+	couponsValidateFiles = couponsValidate.Arg("files", "Coupon bases, plain, gzipped or zstd-compressed files or URLs streamed "+
+		"without an intermediate file; defaults to the downloaded ones.").Strings()
+	couponsValidateStream = couponsValidate.Flag("stream", "Stream the coupon bases from their URLs instead of reading the downloaded ones.").Bool()
+	couponsValidateSHA256 = couponsValidate.Flag("sha256", "Path or URL and expected SHA-256 of a coupon base before decompression, "+
+		"e.g. https://...=3a7bd3..., repeatable; the checksums of Coupons.Bases are checked too.").StringMap()
+	couponsValidateMinFiles = couponsValidate.Flag("min-files", "Number of coupon bases a valid coupon appears in, at least; "+
+		"defaults to Coupons.MinFiles.").IsSetByUser(&couponsValidateSet.minFiles).Int()
+	couponsValidateMinLength = couponsValidate.Flag("min-length", "Minimum length of a valid coupon; defaults to Coupons.MinLength.").
+					IsSetByUser(&couponsValidateSet.minLength).Int()
+	couponsValidateMaxLength = couponsValidate.Flag("max-length", "Maximum length of a valid coupon; defaults to Coupons.MaxLength.").
+					IsSetByUser(&couponsValidateSet.maxLength).Int()
+	couponsValidatePattern = couponsValidate.Flag("pattern", "Regular expression a valid coupon matches entirely, e.g. [A-Z0-9]+; "+
+		"defaults to Coupons.Pattern.").IsSetByUser(&couponsValidateSet.pattern).String()
+	couponsValidateCase = couponsValidate.Flag("case", "Case the codes are turned to before they are compared, upper or lower; "+
+		"defaults to Coupons.Case.").IsSetByUser(&couponsValidateSet.caseName).String()
+	couponsValidateCanonical = couponsValidate.Flag("canonical", "Turn the codes to their canonical form, without spaces and separators "+
+		"in upper case, instead of the case, as coupons sync and index read them; defaults to Coupons.Canonical.").
+		IsSetByUser(&couponsValidateSet.canonical).Bool()
+	couponsValidateOutput = couponsValidate.Flag("output", "File of the valid coupons, - for the standard output.").
+				Short('o').Default(coupon.DefaultValidFile).String()
+	couponsValidateShards = couponsValidate.Flag("shards", "Number of maps the codes are partitioned into, each filled by its own goroutine; "+
+		"defaults to the number of CPUs.").Int()
+	couponsValidateExternal = couponsValidate.Flag("external", "Sort the codes in runs on disk and merge them, instead of holding them all in memory.").Bool()
+	couponsValidateMemory   = couponsValidate.Flag("memory", "Memory budget of the codes held at once with --external, e.g. 512MiB.").
+				Default("256MiB").Bytes()
+	couponsValidateTempDir = couponsValidate.Flag("temp-dir", "Directory of the runs with --external; defaults to the system one.").String()
+
+	couponsImport          = coupons.Command("import", "Import the valid coupons into MongoDB.")
+	couponsImportFile      = couponsImport.Flag("file", "File of the valid coupons, - for the standard input.").Default(coupon.DefaultValidFile).String()
+	couponsImportBatchSize = couponsImport.Flag("batch-size", "Number of coupons inserted at once.").Default(fmt.Sprint(coupon.DefaultBatchSize)).Int()
+
+	couponsSync       = coupons.Command("sync", "Make the coupons in MongoDB the valid coupons; it can be run again.")
+	couponsSyncFile   = couponsSync.Flag("file", "Sorted file of the valid coupons, - for the standard input.").Default(coupon.DefaultValidFile).String()
+	couponsSyncRemove = couponsSync.Flag("remove", "What is done with the coupons that are no longer valid: none, deactivate or delete.").
+				Default("none").Enum("none", string(coupon.RemoveDeactivate), string(coupon.RemoveDelete))
+	couponsSyncDryRun = couponsSync.Flag("dry-run", "Print the changes without making them.").Bool()
+	couponsSyncDiff   = couponsSync.Flag("diff", "File the changes are written to, +CODE or -CODE per line, - for the standard output; "+
+		"defaults to the standard output with --dry-run.").String()
+	couponsSyncBatchSize = couponsSync.Flag("batch-size", "Number of coupons written at once.").Default(fmt.Sprint(coupon.DefaultBatchSize)).Int()
+
+	couponsIndex       = coupons.Command("index", "Build the index file of the valid coupons, which the API server can look the coupons up in.")
+	couponsIndexFile   = couponsIndex.Flag("file", "Sorted file of the valid coupons.").Default(coupon.DefaultValidFile).String()
+	couponsIndexOutput = couponsIndex.Flag("output", "Index file; defaults to Coupons.IndexFile.").Short('o').String()
+
+	couponsGenerate       = coupons.Command("generate", "Generate new random coupon codes with a check character and insert them into MongoDB.")
+	couponsGenerateCount  = couponsGenerate.Flag("count", "Number of codes.").Short('n').Required().Int()
+	couponsGenerateLength = couponsGenerate.Flag("length", "Number of random characters of a code, without its prefix and check character.").
+				Default(fmt.Sprint(coupon.DefaultGenerateLength)).Int()
+	couponsGeneratePrefix = couponsGenerate.Flag("prefix", "Prefix of the codes, e.g. SUMMER; add it to Coupons.CheckedPrefixes "+
+		"for the API to verify the check character.").String()
+	couponsGenerateAlphabet  = couponsGenerate.Flag("alphabet", "Characters the codes are drawn from; defaults to Coupons.Alphabet.").String()
+	couponsGenerateCampaign  = couponsGenerate.Flag("campaign", "Campaign saved with the coupons.").String()
+	couponsGenerateOutput    = couponsGenerate.Flag("output", "File the codes are written to, - for the standard output.").Short('o').Default("-").String()
+	couponsGenerateDryRun    = couponsGenerate.Flag("dry-run", "Print the codes without inserting them.").Bool()
+	couponsGenerateBatchSize = couponsGenerate.Flag("batch-size", "Number of coupons inserted at once.").Default(fmt.Sprint(coupon.DefaultBatchSize)).Int()
+)
+
+func init() {
+	register(couponsDownload, downloadCoupons)
+	register(couponsValidate, validateCoupons)
+	register(couponsImport, importCoupons)
+	register(couponsSync, syncCoupons)
+	register(couponsIndex, indexCoupons)
+	register(couponsGenerate, generateCoupons)
+}
+
+// downloadCoupons downloads the coupon bases of the manifest in parallel, skipping the ones that are up to date.
+func downloadCoupons(ctx context.Context, conf *config.Config) error {
+	dir := *couponsDownloadDir
+	if dir == "" {
+		dir = conf.Coupons.Dir
+	}
+	bases := couponBases(conf.Coupons)
+	if len(*couponsDownloadURL) > 0 {
+		bases = nil
+		for _, name := range slices.Sorted(maps.Keys(*couponsDownloadURL)) {
+			bases = append(bases, coupon.Base{Name: name, URL: (*couponsDownloadURL)[name]})
+		}
+	}
+
+	downloader := coupon.NewDownloader(coupon.DownloaderConfig{
+		MaxRetries: conf.Coupons.DownloadRetries,
+		Backoff:    conf.Coupons.DownloadBackoff,
+	})
+	var wg sync.WaitGroup
+	errs := make([]error, 0, len(bases))
+	var mu sync.Mutex
+	for _, base := range bases {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := downloader.Download(ctx, base, filepath.Join(dir, base.Name)); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("failed to download %s: %w", base.Name, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// couponBases returns the coupon bases of the manifest.
+func couponBases(conf config.Coupons) []coupon.Base {
+	bases := make([]coupon.Base, 0, len(conf.Bases))
+	for _, base := range conf.Bases {
+		bases = append(bases, coupon.Base{Name: base.Name, URL: base.URL, SHA256: base.SHA256})
+	}
+	return bases
+}
+
+// validateCoupons writes the valid coupons of the coupon bases.
+func validateCoupons(ctx context.Context, conf *config.Config) (err error) {
+	// the coupon bases are downloaded as they are, so the checksums of the manifest are those of the files too
+	inputs := coupon.Inputs{Client: coupon.NewHTTPClient(), SHA256: map[string]string{}}
+	files := *couponsValidateFiles
+	for _, base := range couponBases(conf.Coupons) {
+		path := filepath.Join(conf.Coupons.Dir, base.Name)
+		if base.SHA256 != "" {
+			inputs.SHA256[base.URL] = base.SHA256
+			inputs.SHA256[path] = base.SHA256
+		}
+		if len(*couponsValidateFiles) > 0 {
+			continue
+		}
+		if *couponsValidateStream {
+			files = append(files, base.URL)
+		} else {
+			files = append(files, path)
+		}
+	}
+	maps.Copy(inputs.SHA256, *couponsValidateSHA256)
+
+	rules := validationRules(conf.Coupons)
+
+	out, closeOut, err := create(*couponsValidateOutput)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, closeOut(err != nil))
+	}()
+
+	var count int
+	if *couponsValidateExternal {
+		count, err = coupon.ValidateExternal(ctx, files, rules, out, coupon.ExternalOptions{
+			MemoryBudget: int64(*couponsValidateMemory),
+			TempDir:      *couponsValidateTempDir,
+			Inputs:       inputs,
+		})
+	} else {
+		count, err = coupon.Validate(ctx, files, rules, out, coupon.Options{Shards: *couponsValidateShards, Inputs: inputs})
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("Valid coupons written", "count", count, "output", *couponsValidateOutput)
+	return nil
+}
+
+// validationRules returns the rules of the config, overridden by the flags given on the command line.
+func validationRules(conf config.Coupons) coupon.Rules {
+	rules := coupon.Rules{
+		MinLength: conf.MinLength,
+		MaxLength: conf.MaxLength,
+		Pattern:   conf.Pattern,
+		Case:      coupon.Case(conf.Case),
+		MinFiles:  conf.MinFiles,
+		Canonical: conf.Canonical,
+	}
+	if couponsValidateSet.minFiles {
+		rules.MinFiles = *couponsValidateMinFiles
+	}
+	if couponsValidateSet.minLength {
+		rules.MinLength = *couponsValidateMinLength
+	}
+	if couponsValidateSet.maxLength {
+		rules.MaxLength = *couponsValidateMaxLength
+	}
+	if couponsValidateSet.pattern {
+		rules.Pattern = *couponsValidatePattern
+	}
+	if couponsValidateSet.caseName {
+		rules.Case = coupon.Case(*couponsValidateCase)
+	}
+	if couponsValidateSet.canonical {
+		rules.Canonical = *couponsValidateCanonical
+	}
+	return rules
+}
+
+// importCoupons inserts the valid coupons into MongoDB.
+func importCoupons(ctx context.Context, conf *config.Config) error {
+	in, closeIn, err := open(*couponsImportFile)
+	if err != nil {
+		return err
+	}
+	defer closeIn()
+
+	return withMongo(conf.MongoDB, func(client *mongo.Client) error {
+		count, err := coupon.Import(ctx, client, in, *couponsImportBatchSize)
+		if err != nil {
+			return err
+		}
+		slog.Info("Coupons inserted", "count", count)
+		return nil
+	})
+}
+
+// syncCoupons upserts the valid coupons into MongoDB and removes the others, or prints what it would do.
+func syncCoupons(ctx context.Context, conf *config.Config) (err error) {
+	in, closeIn, err := open(*couponsSyncFile)
+	if err != nil {
+		return err
+	}
+	defer closeIn()
+
+	opts := coupon.SyncOptions{BatchSize: *couponsSyncBatchSize, DryRun: *couponsSyncDryRun}
+	if *couponsSyncRemove != "none" {
+		opts.Remove = coupon.Removal(*couponsSyncRemove)
+	}
+	diffPath := *couponsSyncDiff
+	if diffPath == "" && opts.DryRun {
+		diffPath = "-"
+	}
+	if diffPath != "" {
+		diff, closeDiff, err := create(diffPath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err = errors.Join(err, closeDiff(err != nil))
+		}()
+		opts.Diff = diff
+	}
+
+	return withMongo(conf.MongoDB, func(client *mongo.Client) error {
+		result, err := coupon.Sync(ctx, client, in, opts)
+		if err != nil {
+			return err
+		}
+		slog.Info("Coupons synced", "dryRun", opts.DryRun, "inserted", result.Inserted, "reactivated", result.Reactivated,
+			"removed", result.Removed, "unchanged", result.Unchanged)
+		return nil
+	})
+}
+
+// indexCoupons builds the index file of the valid coupons.
+func indexCoupons(_ context.Context, conf *config.Config) error {
+	output := *couponsIndexOutput
+	if output == "" {
+		output = conf.Coupons.IndexFile
+	}
+	count, err := coupon.BuildIndex(*couponsIndexFile, output)
+	if err != nil {
+		return err
+	}
+	slog.Info("Coupon index built", "count", count, "path", output)
+	return nil
+}
+
+// generateCoupons inserts new random coupon codes into MongoDB and writes them, or only writes them in a dry run.
+func generateCoupons(ctx context.Context, conf *config.Config) (err error) {
+	// the API would reject the generated codes, which are not in the index file
+	if conf.Coupons.Store == "index" && !*couponsGenerateDryRun {
+		return errors.New("Coupons.Store is index: the generated coupons are inserted into MongoDB, " +
+			"where the API does not look them up")
+	}
+
+	opts := coupon.GenerateOptions{
+		Count:     *couponsGenerateCount,
+		Length:    *couponsGenerateLength,
+		Prefix:    business.CanonicalCouponCode(*couponsGeneratePrefix),
+		Alphabet:  *couponsGenerateAlphabet,
+		Campaign:  *couponsGenerateCampaign,
+		BatchSize: *couponsGenerateBatchSize,
+		DryRun:    *couponsGenerateDryRun,
+	}
+	if opts.Alphabet == "" {
+		opts.Alphabet = conf.Coupons.Alphabet
+	}
+	if opts.Prefix == "" || !slices.Contains(conf.Coupons.CheckedPrefixes, opts.Prefix) {
+		slog.Warn("The API does not verify the check character of the codes, their prefix is not in Coupons.CheckedPrefixes",
+			"prefix", opts.Prefix)
+	}
+
+	out, closeOut, err := create(*couponsGenerateOutput)
+	if err != nil {
+		return err
+	}
+	// the codes inserted before a failure are kept, so they are written too
+	defer func() {
+		err = errors.Join(err, closeOut(false))
+	}()
+
+	return withMongo(conf.MongoDB, func(client *mongo.Client) error {
+		count, err := coupon.Generate(ctx, client, out, opts)
+		if err != nil {
+			return err
+		}
+		slog.Info("Coupons generated", "dryRun", opts.DryRun, "count", count, "output", *couponsGenerateOutput)
+		return nil
+	})
+}
+
+// open opens the file at path for reading, or returns the standard input if path is "-".
+func open(path string) (io.Reader, func(), error) {
+	if path == "-" {
+		return os.Stdin, func() {}, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return file, func() { _ = file.Close() }, nil
+}
+
+// create returns a writer to the file at path, or to the standard output if path is "-", and the function to call
+// once done, with whether the command failed. The file is written next to path and renamed to path only if the
+// command succeeded, so a failed command leaves path as it was.
+func create(path string) (io.Writer, func(failed bool) error, error) {
+	if path == "-" {
+		return os.Stdout, func(bool) error { return nil }, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create %s: %w", tmpPath, err)
+	}
+	return file, func(failed bool) error {
+		closeErr := file.Close()
+		if failed || closeErr != nil {
+			_ = os.Remove(tmpPath)
+			if closeErr != nil {
+				return fmt.Errorf("failed to write %s: %w", path, closeErr)
+			}
+			return nil
+		}
+		if err := os.Rename(tmpPath, path); err != nil {
+			return fmt.Errorf("failed to rename %s: %w", tmpPath, err)
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,97 @@
+// kart is the kart API server and its operator tools, as subcommands.
+//
+// Every subcommand reads the same config file and logs the same way. The exit code is 0 on success, 1 if the
+// command failed, 2 if the command line is invalid and 3 if the config cannot be read or is invalid.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/config"
+	"github.com/y7ls8i/kart/logger"
+)
+
+// The exit codes.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+	exitConfig  = 3
+)
+
+// closeTimeout bounds the time spent closing the MongoDB connection and flushing the spans once a command is done.
+const closeTimeout = 5 * time.Second
+
+var (
+	app        = kingpin.New("kart", "Kart food ordering API server and operator tools.")
+	configPath = app.Flag("config", "Path to config file.").Short('c').ExistingFile()
+)
+
+// command runs a subcommand with the config. ctx is done when the process receives SIGINT or SIGTERM.
+type command func(ctx context.Context, conf *config.Config) error
+
+// commands are the subcommands, by full name, e.g. "coupons download".
+var commands = map[string]command{}
+
+// register registers the function that runs the subcommand clause.
+func register(clause *kingpin.CmdClause, run command) {
+	commands[clause.FullCommand()] = run
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run runs the subcommand of args and returns the exit code.
+func run(args []string) int {
+	name, err := app.Parse(args)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "kart: error: %v, try --help\n", err)
+		return exitUsage
+	}
+
+	conf, err := config.ReadConfig(*configPath)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "kart: error reading config: %v\n", err)
+		return exitConfig
+	}
+	if err := logger.Setup(os.Stderr, conf.Log); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "kart: error setting up logger: %v\n", err)
+		return exitConfig
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := commands[name](ctx, conf); err != nil {
+		slog.Error("Command failed", "command", name, "error", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// withMongo connects to MongoDB, calls fn with the client, and closes the connection.
+func withMongo(conf config.MongoDB, fn func(client *mongo.Client) error) (err error) {
+	client, err := mongo.NewClient(conf)
+	if err != nil {
+		return fmt.Errorf("error connecting to mongo: %w", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+		defer cancel()
+		if closeErr := client.Close(ctx); closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
+	}()
+
+	return fn(client)
+}
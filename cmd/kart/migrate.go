@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/config"
+	"github.com/y7ls8i/kart/coupon"
+)
+
+func init() {
+	register(app.Command("migrate", "Create the MongoDB indexes the API requires and rewrite the coupon codes in canonical form."), migrate)
+}
+
+// migrate creates the indexes, which the connection does, checks that they all exist, and rewrites the codes of the
+// coupons saved before the codes were canonical.
+func migrate(ctx context.Context, conf *config.Config) error {
+	return withMongo(conf.MongoDB, func(client *mongo.Client) error {
+		if err := client.CheckIndexes(ctx); err != nil {
+			return err
+		}
+		slog.Info("MongoDB indexes are up to date", "db", conf.MongoDB.DB)
+
+		result, err := coupon.Canonicalise(ctx, client, coupon.DefaultBatchSize)
+		if err != nil {
+			return err
+		}
+		slog.Info("Coupon codes are in canonical form", "renamed", result.Renamed, "merged", result.Merged)
+		return nil
+	})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/config"
+)
+
+var (
+	products = app.Command("products", "Import and export the products.")
+
+	productsImport          = products.Command("import", "Import products from a JSON array, replacing the products with the same ID.")
+	productsImportFile      = productsImport.Flag("file", "JSON file of the products, - for the standard input.").Default("-").String()
+	productsImportBatchSize = productsImport.Flag("batch-size", "Number of products written at once.").Default("1000").Int()
+
+	productsExport     = products.Command("export", "Export the products as a JSON array.")
+	productsExportFile = productsExport.Flag("file", "JSON file of the products, - for the standard output.").Short('o').Default("-").String()
+)
+
+func init() {
+	register(productsImport, importProducts)
+	register(productsExport, exportProducts)
+}
+
+// importProducts upserts the products of a JSON array, in the format of the API, batch by batch.
+func importProducts(ctx context.Context, conf *config.Config) error {
+	in, closeIn, err := open(*productsImportFile)
+	if err != nil {
+		return err
+	}
+	defer closeIn()
+
+	return withMongo(conf.MongoDB, func(client *mongo.Client) error {
+		dec := json.NewDecoder(in)
+		if token, err := dec.Token(); err != nil || token != json.Delim('[') {
+			return errors.New("the products must be a JSON array")
+		}
+
+		inserted, updated := 0, 0
+		batch := make([]mongo.Product, 0, *productsImportBatchSize)
+		flush := func() error {
+			i, u, err := client.UpsertProducts(ctx, batch)
+			if err != nil {
+				return err
+			}
+			inserted, updated = inserted+i, updated+u
+			batch = batch[:0]
+			return nil
+		}
+		for dec.More() {
+			product := mongo.Product{}
+			if err := dec.Decode(&product); err != nil {
+				return fmt.Errorf("failed to decode product %d: %w", inserted+updated+len(batch)+1, err)
+			}
+			batch = append(batch, product)
+			if len(batch) >= *productsImportBatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return fmt.Errorf("failed to decode products: %w", err)
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+
+		slog.Info("Products imported", "inserted", inserted, "updated", updated)
+		return nil
+	})
+}
+
+// exportProducts writes all the products as a JSON array, in the format of the API, one product per line.
+func exportProducts(ctx context.Context, conf *config.Config) (err error) {
+	out, closeOut, err := create(*productsExportFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, closeOut(err != nil))
+	}()
+
+	return withMongo(conf.MongoDB, func(client *mongo.Client) error {
+		w := bufio.NewWriter(out)
+		count := 0
+		separator := "[\n"
+		err := client.EachProduct(ctx, func(product mongo.Product) error {
+			data, err := json.Marshal(product)
+			if err != nil {
+				return fmt.Errorf("failed to encode product: %w", err)
+			}
+			if _, err := fmt.Fprintf(w, "%s%s", separator, data); err != nil {
+				return fmt.Errorf("failed to write product: %w", err)
+			}
+			separator = ",\n"
+			count++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		end := "\n]\n"
+		if count == 0 {
+			end = "[]\n"
+		}
+		if _, err := fmt.Fprint(w, end); err != nil {
+			return fmt.Errorf("failed to write products: %w", err)
+		}
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("failed to write products: %w", err)
+		}
+
+		slog.Info("Products exported", "count", count)
+		return nil
+	})
+}
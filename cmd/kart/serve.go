@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/business"
+	"github.com/y7ls8i/kart/config"
+	"github.com/y7ls8i/kart/coupon"
+	"github.com/y7ls8i/kart/logger"
+	"github.com/y7ls8i/kart/server"
+	"github.com/y7ls8i/kart/tracing"
+)
+
+func init() {
+	register(app.Command("serve", "Run the API server.").Default(), serve)
+}
+
+// serve runs the API server and stops its dependencies in order once it is shut down: the HTTP server and its
+// background workers first, then the coupon store and the MongoDB connection, and the tracing last so that the
+// shutdown spans are flushed.
+func serve(ctx context.Context, conf *config.Config) (err error) {
+	shutdownTracing, err := tracing.Setup(ctx, conf.Tracing)
+	if err != nil {
+		return fmt.Errorf("error setting up tracing: %w", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+		defer cancel()
+		if closeErr := shutdownTracing(ctx); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("error shutting down tracing: %w", closeErr))
+		}
+	}()
+
+	return withMongo(conf.MongoDB, func(client *mongo.Client) (err error) {
+		coupons, closeCoupons, err := couponStore(conf.Coupons, client)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err = errors.Join(err, closeCoupons())
+		}()
+		coupons = business.VerifyCheckCharacters(coupons, conf.Coupons.Alphabet, conf.Coupons.CheckedPrefixes)
+		// only the orders are throttled, the coupon check and preview let the users check a code as they type it
+		orderCoupons := business.ThrottleCoupons(coupons, conf.Coupons.MaxFailedAttempts, conf.Coupons.FailedAttemptsWindow)
+		buss := business.NewBusiness(client, coupons, orderCoupons)
+
+		s := server.NewServer(conf.Server, client, buss)
+		if conf.Server.Mode == "release" && len(conf.Server.APIKeys) == 0 {
+			slog.Warn("No API keys in release mode, every API request is rejected, see kart apikey")
+		}
+
+		// reload the log level, CORS origins, rate limits, feature flags and TLS certificate without a restart
+		reloader := config.NewReloader(*configPath, conf)
+		reloader.OnReload(func(conf *config.Config) {
+			if err := logger.SetLevel(conf.Log.Level); err != nil {
+				slog.Error("Error reloading log level", "error", err)
+			}
+			if err := s.Reload(conf.Server); err != nil {
+				slog.Error("Error reloading server settings", "error", err)
+			}
+		})
+		s.AddWorker(reloader.Watch)
+
+		return s.Start(ctx)
+	})
+}
+
+// couponStore returns the store the coupons are looked up in, MongoDB or the index file of the config, and the
+// function that closes it.
+func couponStore(conf config.Coupons, client *mongo.Client) (business.CouponStore, func() error, error) {
+	if conf.Store != "index" {
+		return client, func() error { return nil }, nil
+	}
+	index, err := coupon.OpenIndex(conf.IndexFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening coupon index: %w", err)
+	}
+	slog.Info("Coupon index opened", "path", conf.IndexFile, "coupons", index.Len())
+	return index, index.Close, nil
+}
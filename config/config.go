@@ -1,39 +1,279 @@
 // Package config is http server configuration.
+//
+// The configuration is read from a TOML file, and every field can be overridden by an environment variable named
+// KART_<SECTION>_<FIELD> in upper case, e.g. KART_MONGODB_URI overrides URI in the [MongoDB] section.
+// Fields that are set neither in the file nor in the environment keep the defaults returned by Default.
 package config
 
 import (
-	"log/slog"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
 
 // Server structure
+// DrainDelay is how long the server keeps serving after the readiness probe starts failing on shutdown.
+// CORSOrigins are the origins allowed to call the API from a browser, "*" allows any origin.
+// RateLimit is the number of API requests per second allowed per client, with bursts of up to RateBurst requests;
+// 0 disables rate limiting.
+// TrustedProxies are the IP addresses and CIDR ranges of the proxies whose X-Forwarded-For and X-Real-IP headers
+// give the client IP address, which the rate limits and the failed coupon attempts are counted by; if empty, no
+// proxy is trusted and the client is the peer address.
+// ReadHeaderTimeout, ReadTimeout, WriteTimeout, IdleTimeout and MaxHeaderBytes are those of http.Server; a zero
+// timeout means no timeout. MaxBodyBytes limits the size of the API request bodies, 0 means no limit.
+// ShutdownTimeout bounds the time spent draining the in-flight requests and stopping the background workers.
+// OpenAPIValidation rejects the API requests that do not match the OpenAPI document; in test mode the responses are
+// validated too.
+// GRPCListen is the address of the gRPC API, with the same certificate as the HTTP server; empty disables it.
+// APIKeys are the keys accepted by the API, see kart apikey; if empty, the development key "apitest" is accepted in
+// the debug and test modes, and no key in release mode.
 type Server struct {
-	Mode     string
-	Listen   string
-	Certfile string
-	Keyfile  string
+	Mode              string
+	Listen            string
+	Certfile          string
+	Keyfile           string
+	DrainDelay        time.Duration
+	CORSOrigins       []string
+	RateLimit         float64
+	RateBurst         int
+	TrustedProxies    []string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	MaxBodyBytes      int64
+	ShutdownTimeout   time.Duration
+	OpenAPIValidation bool
+	GRPCListen        string
+	APIKeys           []string
 }
 
 // MongoDB structure.
+// AppName, MinPoolSize, MaxPoolSize, MaxConnIdleTime, ConnectTimeout and ServerSelectionTimeout are passed to the
+// driver; zero values keep the driver defaults.
+// OperationTimeout bounds every adapter method, 0 means no timeout. The v2 driver has no socket timeout, this is
+// what replaces it.
+// ReadPreference is one of primary, primaryPreferred, secondary, secondaryPreferred or nearest, and WriteConcern is
+// either majority, a tag set name or a number of nodes.
+// TLSCAFile verifies the server certificate, and TLSCertFile and TLSKeyFile are the client certificate.
+// StartupRetries is how many times the startup ping is retried, waiting StartupBackoff, doubled on every retry.
 type MongoDB struct {
-	URI string
-	DB  string
+	URI                    string
+	DB                     string
+	AppName                string
+	MinPoolSize            uint64
+	MaxPoolSize            uint64
+	MaxConnIdleTime        time.Duration
+	ConnectTimeout         time.Duration
+	ServerSelectionTimeout time.Duration
+	OperationTimeout       time.Duration
+	ReadPreference         string
+	WriteConcern           string
+	TLSCAFile              string
+	TLSCertFile            string
+	TLSKeyFile             string
+	StartupRetries         int
+	StartupBackoff         time.Duration
+}
+
+// TLSConfig returns the TLS configuration of the MongoDB connection made of the CA and client certificate files.
+func (m MongoDB) TLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if m.TLSCAFile != "" {
+		pem, err := os.ReadFile(m.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mongo CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in mongo CA file %s", m.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if m.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(m.TLSCertFile, m.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load mongo client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Tracing structure.
+// Exporter is where the spans are sent: "" or "none" disables tracing, "stdout" writes them as JSON to File (or to
+// the standard output if File is empty), and "otlp" sends them to Endpoint over OTLP/HTTP.
+type Tracing struct {
+	Exporter    string
+	File        string
+	Endpoint    string
+	Insecure    bool
+	ServiceName string
+}
+
+// Log structure.
+// Level is one of debug, info, warn or error, and Format is either text or json.
+type Log struct {
+	Level  string
+	Format string
+}
+
+// Coupons structure, the coupon bases and the rules of the valid coupon codes used by kart coupons, and the store the
+// API server looks the coupons up in.
+// Bases is the manifest of the coupon bases, downloaded to Dir; a failed download is retried DownloadRetries times,
+// waiting DownloadBackoff, doubled on every retry. KART_COUPONS_BASES overrides Bases with a JSON array.
+// A line of a coupon base is trimmed and turned to Case, upper or lower, or kept as it is if Case is empty. The code
+// is valid if it is MinLength to MaxLength characters long, matches the regular expression Pattern entirely if it is
+// set, e.g. [A-Z0-9]+, and appears in at least MinFiles of the coupon bases. Canonical turns the lines to the canonical
+// form of the codes instead, without spaces and separators in upper case, which kart coupons sync and index read.
+// Store is mongo to look the coupons up in MongoDB, or index to look them up in IndexFile, built by kart coupons index.
+// A client that fails MaxFailedAttempts coupon lookups is rejected until they are forgotten, at the rate of
+// MaxFailedAttempts per FailedAttemptsWindow; 0 disables the throttling.
+// kart coupons generate draws the codes from Alphabet and ends them with a check character. The API verifies the check
+// character of the codes that start with one of CheckedPrefixes before looking them up.
+type Coupons struct {
+	Dir             string
+	Bases           []CouponBase
+	DownloadRetries int
+	DownloadBackoff time.Duration
+	MinLength       int
+	MaxLength       int
+	Pattern         string
+	Case            string
+	MinFiles        int
+	Canonical       bool
+	Store           string
+	IndexFile       string
+
+	MaxFailedAttempts    int
+	FailedAttemptsWindow time.Duration
+
+	Alphabet        string
+	CheckedPrefixes []string
+}
+
+// CouponBase structure, a coupon base of the manifest: the file Name in Coupons.Dir, downloaded from URL, with the
+// hexadecimal SHA-256 checksum of the download, not checked if empty.
+type CouponBase struct {
+	Name   string
+	URL    string
+	SHA256 string
+}
+
+// Features are feature flags, by name.
+type Features map[string]bool
+
+// Enabled reports whether the feature flag is on. Unknown flags are off.
+func (f Features) Enabled(name string) bool {
+	return f[name]
 }
 
 // Config structure
 type Config struct {
-	Server  Server
-	MongoDB MongoDB
+	Server   Server
+	MongoDB  MongoDB
+	Tracing  Tracing
+	Log      Log
+	Coupons  Coupons
+	Features Features
 }
 
-// ReadConfig from a config file
-func ReadConfig(configFile string) (config *Config) {
-	config = &Config{}
-	if _, err := toml.DecodeFile(configFile, &config); err != nil {
-		slog.Error("Error parsing config", "error", err)
-		os.Exit(1)
+// Default returns the configuration used for the fields that are not set.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Mode:              "release",
+			Listen:            ":8000",
+			DrainDelay:        5 * time.Second,
+			RateBurst:         20,
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			MaxHeaderBytes:    1 << 20, // 1 MiB
+			MaxBodyBytes:      1 << 20, // 1 MiB
+			ShutdownTimeout:   5 * time.Second,
+		},
+		MongoDB: MongoDB{
+			URI:                    "mongodb://127.0.0.1:27017",
+			DB:                     "kart",
+			AppName:                "kart",
+			MaxPoolSize:            100,
+			ConnectTimeout:         10 * time.Second,
+			ServerSelectionTimeout: 10 * time.Second,
+			OperationTimeout:       10 * time.Second,
+			ReadPreference:         "primary",
+			WriteConcern:           "majority",
+			StartupRetries:         5,
+			StartupBackoff:         time.Second,
+		},
+		Tracing: Tracing{
+			ServiceName: "kart",
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "text",
+		},
+		Coupons: Coupons{
+			Dir: "data/coupon",
+			Bases: []CouponBase{
+				{Name: "couponbase1", URL: "https://orderfoodonline-files.s3.ap-southeast-2.amazonaws.com/couponbase1.gz"},
+				{Name: "couponbase2", URL: "https://orderfoodonline-files.s3.ap-southeast-2.amazonaws.com/couponbase2.gz"},
+				{Name: "couponbase3", URL: "https://orderfoodonline-files.s3.ap-southeast-2.amazonaws.com/couponbase3.gz"},
+			},
+			DownloadRetries: 5,
+			DownloadBackoff: time.Second,
+			MinLength:       8,
+			MaxLength:       10,
+			MinFiles:        2,
+			Store:           "mongo",
+			IndexFile:       "data/coupon/valid/valid.idx",
+
+			MaxFailedAttempts:    10,
+			FailedAttemptsWindow: 10 * time.Minute,
+
+			Alphabet: "23456789ABCDEFGHJKLMNPQRSTUVWXYZ",
+		},
+		Features: Features{},
 	}
-	return config
+}
+
+// ReadConfig reads the config file, if configFile is not empty, on top of the defaults, applies the environment
+// variable overrides, and validates the result.
+func ReadConfig(configFile string) (*Config, error) {
+	return readConfig(configFile, os.LookupEnv)
+}
+
+func readConfig(configFile string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	config := Default()
+
+	if configFile != "" {
+		md, err := toml.DecodeFile(configFile, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, 0, len(undecoded))
+			for _, key := range undecoded {
+				keys = append(keys, key.String())
+			}
+			return nil, fmt.Errorf("unknown keys in config file: %s", strings.Join(keys, ", "))
+		}
+	}
+
+	if err := applyEnv(config, lookupEnv); err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
 }
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is the prefix of the environment variables that override the config file.
+const EnvPrefix = "KART_"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnv overrides the fields of config with the KART_<SECTION>_<FIELD> environment variables.
+func applyEnv(config *Config, lookupEnv func(string) (string, bool)) error {
+	if err := applyEnvStruct(reflect.ValueOf(config).Elem(), EnvPrefix, lookupEnv); err != nil {
+		return fmt.Errorf("invalid environment variables:\n%w", err)
+	}
+	return nil
+}
+
+func applyEnvStruct(v reflect.Value, prefix string, lookupEnv func(string) (string, bool)) error {
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		name := prefix + strings.ToUpper(v.Type().Field(i).Name)
+
+		if field.Kind() == reflect.Struct {
+			errs = append(errs, applyEnvStruct(field, name+"_", lookupEnv))
+			continue
+		}
+
+		value, ok := lookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setField parses value into field according to the field type.
+func setField(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Map:
+		if field.Type().Key().Kind() != reflect.String || field.Type().Elem().Kind() != reflect.Bool {
+			return fmt.Errorf("unsupported type %s", field.Type())
+		}
+		// name=true,other=false
+		m := reflect.MakeMap(field.Type())
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			key, val, found := strings.Cut(item, "=")
+			b := true
+			if found {
+				var err error
+				if b, err = strconv.ParseBool(strings.TrimSpace(val)); err != nil {
+					return fmt.Errorf("%s: %w", key, err)
+				}
+			}
+			m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(key)), reflect.ValueOf(b))
+		}
+		field.Set(m)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.Struct {
+			// a JSON array, e.g. [{"Name":"base","URL":"https://example.com/base.gz"}]
+			items := reflect.New(field.Type())
+			if err := json.Unmarshal([]byte(value), items.Interface()); err != nil {
+				return err
+			}
+			field.Set(items.Elem())
+			return nil
+		}
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", field.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
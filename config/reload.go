@@ -0,0 +1,141 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ReloadInterval is how often Watch checks whether the config file changed.
+const ReloadInterval = 2 * time.Second
+
+// Reloader holds the current configuration and swaps in a new one when the config file changes or the process
+// receives SIGHUP.
+// Only the reloadable fields are taken from the new configuration: Log.Level, Server.CORSOrigins,
+// Server.RateLimit, Server.RateBurst, Server.Certfile, Server.Keyfile and Features. The other fields need a restart.
+type Reloader struct {
+	path      string
+	lookupEnv func(string) (string, bool)
+	current   atomic.Pointer[Config]
+
+	mu       sync.Mutex
+	onReload []func(*Config)
+	modTime  time.Time
+	size     int64
+}
+
+// NewReloader returns a reloader of the config file path that starts with conf.
+func NewReloader(path string, conf *Config) *Reloader {
+	r := &Reloader{path: path, lookupEnv: os.LookupEnv}
+	r.current.Store(conf)
+	r.modTime, r.size = r.stat()
+	return r
+}
+
+// Current returns the current configuration. It must not be modified.
+func (r *Reloader) Current() *Config {
+	return r.current.Load()
+}
+
+// OnReload registers fn to be called with the new configuration after every successful reload.
+func (r *Reloader) OnReload(fn func(*Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onReload = append(r.onReload, fn)
+}
+
+// Reload reads and validates the configuration, and swaps in its reloadable fields.
+// If the new configuration is invalid, the current one is kept and the error is returned.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.modTime, r.size = r.stat()
+
+	loaded, err := readConfig(r.path, r.lookupEnv)
+	if err != nil {
+		return err
+	}
+
+	old := r.Current()
+	next := *old
+	next.Log.Level = loaded.Log.Level
+	next.Server.CORSOrigins = loaded.Server.CORSOrigins
+	next.Server.RateLimit = loaded.Server.RateLimit
+	next.Server.RateBurst = loaded.Server.RateBurst
+	next.Server.Certfile = loaded.Server.Certfile
+	next.Server.Keyfile = loaded.Server.Keyfile
+	next.Features = loaded.Features
+
+	// switching between HTTP and HTTPS changes the listener
+	if (old.Server.Certfile == "") != (next.Server.Certfile == "") {
+		slog.Warn("Config reload: switching between HTTP and HTTPS needs a restart")
+		next.Server.Certfile, next.Server.Keyfile = old.Server.Certfile, old.Server.Keyfile
+	}
+	if !reflect.DeepEqual(next, *loaded) {
+		slog.Warn("Config reload: some of the changed fields need a restart and were not applied")
+	}
+
+	r.current.Store(&next)
+	for _, fn := range r.onReload {
+		fn(&next)
+	}
+	slog.Info("Config reloaded", "path", r.path)
+	return nil
+}
+
+// Watch reloads the configuration on SIGHUP and when the config file changes, until ctx is done.
+func (r *Reloader) Watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			slog.Info("Config reload requested by SIGHUP")
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			slog.Info("Config file changed", "path", r.path)
+		}
+		if err := r.Reload(); err != nil {
+			slog.Error("Config reload failed, keeping the current config", "error", err)
+		}
+	}
+}
+
+// changed reports whether the config file changed since the last reload.
+func (r *Reloader) changed() bool {
+	if r.path == "" {
+		return false
+	}
+	modTime, size := r.stat()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !modTime.Equal(r.modTime) || size != r.size
+}
+
+func (r *Reloader) stat() (time.Time, int64) {
+	if r.path == "" {
+		return time.Time{}, 0
+	}
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return info.ModTime(), info.Size()
+}
@@ -0,0 +1,57 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/config"
+)
+
+func TestReloader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	write := func(content string) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	write("[Server]\nListen = \":8000\"\n[Log]\nLevel = \"info\"\n")
+	conf, err := config.ReadConfig(path)
+	require.NoError(t, err)
+
+	reloader := config.NewReloader(path, conf)
+	var reloaded []*config.Config
+	reloader.OnReload(func(c *config.Config) {
+		reloaded = append(reloaded, c)
+	})
+
+	t.Run("reloadable fields applied", func(t *testing.T) {
+		write("[Server]\nListen = \":9000\"\nCORSOrigins = [\"https://shop.example.com\"]\nRateLimit = 5.0\n" +
+			"[Log]\nLevel = \"debug\"\n[Features]\nnewCheckout = true\n")
+		require.NoError(t, reloader.Reload())
+
+		current := reloader.Current()
+		assert.Equal(t, "debug", current.Log.Level)
+		assert.Equal(t, []string{"https://shop.example.com"}, current.Server.CORSOrigins)
+		assert.Equal(t, 5.0, current.Server.RateLimit)
+		assert.True(t, current.Features.Enabled("newCheckout"))
+		// needs a restart
+		assert.Equal(t, ":8000", current.Server.Listen)
+
+		require.Len(t, reloaded, 1)
+		assert.Equal(t, current, reloaded[0])
+		// the previous config is not modified
+		assert.Equal(t, "info", conf.Log.Level)
+	})
+
+	t.Run("invalid config kept out", func(t *testing.T) {
+		before := reloader.Current()
+		write("[Log]\nLevel = \"verbose\"\n")
+		err := reloader.Reload()
+		require.Error(t, err)
+		assert.Equal(t, "invalid config:\nLog.Level must be one of debug, info, warn or error, got \"verbose\"", err.Error())
+		assert.Same(t, before, reloader.Current())
+		assert.Len(t, reloaded, 1)
+	})
+}
@@ -0,0 +1,225 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Validate checks the whole configuration and reports all the problems in one error.
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	// Server
+	if !slices.Contains([]string{"debug", "test", "release"}, c.Server.Mode) {
+		add("Server.Mode must be one of debug, test or release, got %q", c.Server.Mode)
+	}
+	if c.Server.Listen == "" {
+		add("Server.Listen is empty")
+	} else if _, _, err := net.SplitHostPort(c.Server.Listen); err != nil {
+		add("Server.Listen %q is not a host:port address: %v", c.Server.Listen, err)
+	}
+	if (c.Server.Certfile == "") != (c.Server.Keyfile == "") {
+		add("Server.Certfile and Server.Keyfile must be set together")
+	}
+	if c.Server.DrainDelay < 0 {
+		add("Server.DrainDelay must not be negative")
+	}
+	if c.Server.Certfile != "" && c.Server.Keyfile != "" {
+		if _, err := tls.LoadX509KeyPair(c.Server.Certfile, c.Server.Keyfile); err != nil {
+			add("Server.Certfile and Server.Keyfile cannot be loaded: %v", err)
+		}
+	}
+	for _, timeout := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"ReadHeaderTimeout", c.Server.ReadHeaderTimeout},
+		{"ReadTimeout", c.Server.ReadTimeout},
+		{"WriteTimeout", c.Server.WriteTimeout},
+		{"IdleTimeout", c.Server.IdleTimeout},
+	} {
+		if timeout.d < 0 {
+			add("Server.%s must not be negative", timeout.name)
+		}
+	}
+	if c.Server.MaxHeaderBytes < 0 {
+		add("Server.MaxHeaderBytes must not be negative")
+	}
+	if c.Server.MaxBodyBytes < 0 {
+		add("Server.MaxBodyBytes must not be negative")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		add("Server.ShutdownTimeout must be positive")
+	}
+	for _, origin := range c.Server.CORSOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			add("Server.CORSOrigins %q is not an origin like https://example.com", origin)
+		}
+	}
+	if c.Server.RateLimit < 0 {
+		add("Server.RateLimit must not be negative")
+	}
+	if c.Server.RateLimit > 0 && c.Server.RateBurst < 1 {
+		add("Server.RateBurst must be at least 1 when Server.RateLimit is set")
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			add("Server.TrustedProxies %q is not an IP address or a CIDR range", proxy)
+		}
+	}
+
+	// MongoDB
+	if c.MongoDB.URI == "" {
+		add("MongoDB.URI is empty")
+	} else if !strings.HasPrefix(c.MongoDB.URI, "mongodb://") && !strings.HasPrefix(c.MongoDB.URI, "mongodb+srv://") {
+		add("MongoDB.URI must start with mongodb:// or mongodb+srv://")
+	}
+	if c.MongoDB.DB == "" {
+		add("MongoDB.DB is empty")
+	}
+	if c.MongoDB.MaxPoolSize > 0 && c.MongoDB.MinPoolSize > c.MongoDB.MaxPoolSize {
+		add("MongoDB.MinPoolSize must not be greater than MongoDB.MaxPoolSize")
+	}
+	for _, timeout := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"MaxConnIdleTime", c.MongoDB.MaxConnIdleTime},
+		{"ConnectTimeout", c.MongoDB.ConnectTimeout},
+		{"ServerSelectionTimeout", c.MongoDB.ServerSelectionTimeout},
+		{"OperationTimeout", c.MongoDB.OperationTimeout},
+		{"StartupBackoff", c.MongoDB.StartupBackoff},
+	} {
+		if timeout.d < 0 {
+			add("MongoDB.%s must not be negative", timeout.name)
+		}
+	}
+	if c.MongoDB.ReadPreference != "" && !slices.Contains([]string{"primary", "primaryPreferred", "secondary", "secondaryPreferred", "nearest"}, c.MongoDB.ReadPreference) {
+		add("MongoDB.ReadPreference must be one of primary, primaryPreferred, secondary, secondaryPreferred or nearest, got %q", c.MongoDB.ReadPreference)
+	}
+	if c.MongoDB.StartupRetries < 0 {
+		add("MongoDB.StartupRetries must not be negative")
+	}
+	if (c.MongoDB.TLSCertFile == "") != (c.MongoDB.TLSKeyFile == "") {
+		add("MongoDB.TLSCertFile and MongoDB.TLSKeyFile must be set together")
+	} else if c.MongoDB.TLSCAFile != "" || c.MongoDB.TLSCertFile != "" {
+		if _, err := c.MongoDB.TLSConfig(); err != nil {
+			add("MongoDB TLS files cannot be loaded: %v", err)
+		}
+	}
+
+	// Tracing
+	switch c.Tracing.Exporter {
+	case "", "none", "stdout":
+	case "otlp":
+		if c.Tracing.Endpoint != "" {
+			if u, err := url.Parse(c.Tracing.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+				add("Tracing.Endpoint %q is not a URL", c.Tracing.Endpoint)
+			}
+		}
+	default:
+		add("Tracing.Exporter must be one of none, stdout or otlp, got %q", c.Tracing.Exporter)
+	}
+
+	// Log
+	if !slices.Contains([]string{"debug", "info", "warn", "error"}, c.Log.Level) {
+		add("Log.Level must be one of debug, info, warn or error, got %q", c.Log.Level)
+	}
+	if !slices.Contains([]string{"text", "json"}, c.Log.Format) {
+		add("Log.Format must be either text or json, got %q", c.Log.Format)
+	}
+
+	// Coupons
+	if c.Coupons.Dir == "" {
+		add("Coupons.Dir is empty")
+	}
+	names := map[string]bool{}
+	for i, base := range c.Coupons.Bases {
+		if base.Name == "" || strings.ContainsAny(base.Name, `/\`) || base.Name == "." || base.Name == ".." {
+			add("Coupons.Bases[%d].Name %q is not a file name", i, base.Name)
+		} else if names[base.Name] {
+			add("Coupons.Bases[%d].Name %q is not unique", i, base.Name)
+		}
+		names[base.Name] = true
+		if u, err := url.Parse(base.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("Coupons.Bases[%d].URL %q is not an http or https URL", i, base.URL)
+		}
+		if base.SHA256 != "" {
+			if sum, err := hex.DecodeString(base.SHA256); err != nil || len(sum) != sha256.Size {
+				add("Coupons.Bases[%d].SHA256 is not a hexadecimal SHA-256 checksum", i)
+			}
+		}
+	}
+	if c.Coupons.DownloadRetries < 0 {
+		add("Coupons.DownloadRetries must not be negative")
+	}
+	if c.Coupons.DownloadBackoff < 0 {
+		add("Coupons.DownloadBackoff must not be negative")
+	}
+	if c.Coupons.MinLength < 1 {
+		add("Coupons.MinLength must be at least 1")
+	}
+	if c.Coupons.MaxLength < c.Coupons.MinLength {
+		add("Coupons.MaxLength must not be less than Coupons.MinLength")
+	}
+	if _, err := regexp.Compile(c.Coupons.Pattern); err != nil {
+		add("Coupons.Pattern is not a regular expression: %v", err)
+	}
+	if !slices.Contains([]string{"", "upper", "lower"}, c.Coupons.Case) {
+		add("Coupons.Case must be upper, lower or empty, got %q", c.Coupons.Case)
+	}
+	if c.Coupons.MinFiles < 1 {
+		add("Coupons.MinFiles must be at least 1")
+	}
+	if !slices.Contains([]string{"mongo", "index"}, c.Coupons.Store) {
+		add("Coupons.Store must be either mongo or index, got %q", c.Coupons.Store)
+	}
+	if c.Coupons.Store == "index" && c.Coupons.IndexFile == "" {
+		add("Coupons.IndexFile is empty")
+	}
+	if c.Coupons.MaxFailedAttempts < 0 {
+		add("Coupons.MaxFailedAttempts must not be negative")
+	}
+	if c.Coupons.MaxFailedAttempts > 0 && c.Coupons.FailedAttemptsWindow <= 0 {
+		add("Coupons.FailedAttemptsWindow must be positive")
+	}
+	distinct := slices.Compact(slices.Sorted(slices.Values([]rune(c.Coupons.Alphabet))))
+	if len(distinct) < 2 || len(distinct) != utf8.RuneCountInString(c.Coupons.Alphabet) || !canonicalCode(c.Coupons.Alphabet) {
+		add("Coupons.Alphabet must have at least 2 distinct characters, in upper case and without spaces or separators")
+	}
+	for i, prefix := range c.Coupons.CheckedPrefixes {
+		if prefix == "" || !canonicalCode(prefix) {
+			add("Coupons.CheckedPrefixes[%d] %q must not be empty, and be in upper case without spaces or separators", i, prefix)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// canonicalCode reports whether s is a coupon code in canonical form, in upper case without spaces or the '-', '_'
+// and '.' separators.
+func canonicalCode(s string) bool {
+	return strings.ToUpper(s) == s && !strings.ContainsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '-' || r == '_' || r == '.'
+	})
+}
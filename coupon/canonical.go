@@ -0,0 +1,66 @@
+package coupon
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/business"
+)
+
+// CanonicaliseDB is the interface for the database layer that is required by Canonicalise.
+type CanonicaliseDB interface {
+	EachCoupon(ctx context.Context, fn func(mongo.Coupon) error) error
+	RenameCoupons(ctx context.Context, renames []mongo.CouponRename) (renamed, deleted int, err error)
+}
+
+// CanonicaliseResult counts the changes of Canonicalise: the coupons Renamed to their canonical code, and the ones
+// Merged into the coupon that already had it.
+type CanonicaliseResult struct {
+	Renamed int
+	Merged  int
+}
+
+// Canonicalise rewrites the codes of the coupons of db that are not in their canonical form, see
+// business.CanonicalCouponCode, batchSize at a time, so that the coupons saved in lower case or with separators before
+// the codes were canonical are found again. A coupon whose canonical code is already taken is merged into the coupon
+// of that code, which is kept as it is, deactivated or not; a code of separators only is left as it is. It can be run
+// again.
+func Canonicalise(ctx context.Context, db CanonicaliseDB, batchSize int) (CanonicaliseResult, error) {
+	if batchSize < 1 {
+		batchSize = DefaultBatchSize
+	}
+
+	result := CanonicaliseResult{}
+	batch := make([]mongo.CouponRename, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		renamed, merged, err := db.RenameCoupons(ctx, batch)
+		result.Renamed += renamed
+		result.Merged += merged
+		if err != nil {
+			return fmt.Errorf("failed to rename coupons after %d: %w", result.Renamed+result.Merged, err)
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	// the coupons renamed while they are read may be read again, in canonical form, and are left as they are then
+	err := db.EachCoupon(ctx, func(coupon mongo.Coupon) error {
+		code := business.CanonicalCouponCode(coupon.Code)
+		if code == coupon.Code || code == "" {
+			return nil
+		}
+		batch = append(batch, mongo.CouponRename{From: coupon.Code, To: code})
+		if len(batch) == batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	return result, flush()
+}
@@ -0,0 +1,99 @@
+package coupon_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/coupon"
+)
+
+func TestCanonicalise(t *testing.T) {
+	deactivatedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	testCases := []struct {
+		name           string
+		coupons        []mongo.Coupon
+		batchSize      int
+		err            error
+		expected       []mongo.Coupon
+		expectedResult coupon.CanonicaliseResult
+		expectedErr    string
+	}{
+		{
+			name:           "renamed",
+			coupons:        []mongo.Coupon{{Code: "BIRTHDAY"}, {Code: "HAPPY HRS"}, {Code: "fifty-off", DeactivatedAt: &deactivatedAt}},
+			expected:       []mongo.Coupon{{Code: "BIRTHDAY"}, {Code: "FIFTYOFF", DeactivatedAt: &deactivatedAt}, {Code: "HAPPYHRS"}},
+			expectedResult: coupon.CanonicaliseResult{Renamed: 2},
+		},
+		{
+			name:           "merged",
+			coupons:        []mongo.Coupon{{Code: "FIFTYOFF", DeactivatedAt: &deactivatedAt}, {Code: "fifty-off"}, {Code: "fifty_off"}},
+			batchSize:      1,
+			expected:       []mongo.Coupon{{Code: "FIFTYOFF", DeactivatedAt: &deactivatedAt}},
+			expectedResult: coupon.CanonicaliseResult{Merged: 2},
+		},
+		{
+			name:           "already canonical",
+			coupons:        []mongo.Coupon{{Code: "BIRTHDAY"}, {Code: "FIFTYOFF"}},
+			expected:       []mongo.Coupon{{Code: "BIRTHDAY"}, {Code: "FIFTYOFF"}},
+			expectedResult: coupon.CanonicaliseResult{},
+		},
+		{
+			name:           "separators only",
+			coupons:        []mongo.Coupon{{Code: "--"}},
+			expected:       []mongo.Coupon{{Code: "--"}},
+			expectedResult: coupon.CanonicaliseResult{},
+		},
+		{
+			name:        "rename error",
+			coupons:     []mongo.Coupon{{Code: "fifty-off"}},
+			err:         errors.New("connection refused"),
+			expected:    []mongo.Coupon{{Code: "fifty-off"}},
+			expectedErr: "failed to rename coupons after 0: connection refused",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			db := &mockSyncDB{coupons: test.coupons, err: test.err}
+			result, err := coupon.Canonicalise(context.Background(), db, test.batchSize)
+			if test.expectedErr != "" {
+				require.EqualError(t, err, test.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, test.expectedResult, result)
+			assert.Equal(t, test.expected, db.coupons)
+		})
+	}
+}
+
+func (m *mockSyncDB) RenameCoupons(_ context.Context, renames []mongo.CouponRename) (int, int, error) {
+	if m.err != nil {
+		return 0, 0, m.err
+	}
+	renamed, deleted := 0, 0
+	for _, rename := range renames {
+		i, found := m.find(rename.From)
+		if !found {
+			continue
+		}
+		c := m.coupons[i]
+		m.coupons = slices.Delete(m.coupons, i, i+1)
+		if _, taken := m.find(rename.To); taken {
+			deleted++
+			continue
+		}
+		c.Code = rename.To
+		j, _ := m.find(rename.To)
+		m.coupons = slices.Insert(m.coupons, j, c)
+		renamed++
+	}
+	return renamed, deleted, nil
+}
@@ -0,0 +1,20 @@
+// Package coupon contains the coupon tools: downloading the coupon bases, finding the valid coupons in them, and
+// importing the valid coupons into MongoDB or indexing them in a file the API server can look them up in, and
+// generating new coupon codes with a check character.
+//
+// By default, a coupon code is valid if it is MinLength to MaxLength characters long and appears in at least MinFiles
+// of the coupon bases; see Rules for the other rules.
+package coupon
+
+// The default rules, see DefaultRules.
+const (
+	// MinLength is the minimum length of a valid coupon code.
+	MinLength = 8
+	// MaxLength is the maximum length of a valid coupon code.
+	MaxLength = 10
+	// MinFiles is the number of coupon bases a valid coupon code appears in, at least.
+	MinFiles = 2
+)
+
+// DefaultValidFile is the file of the valid coupon codes.
+const DefaultValidFile = "data/coupon/valid/valid"
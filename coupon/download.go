@@ -0,0 +1,323 @@
+package coupon
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultDownloadRetries is the number of retries of a download used when the config does not set one.
+	DefaultDownloadRetries = 5
+	// DefaultDownloadBackoff is the wait before the first retry of a download used when the config does not set one.
+	DefaultDownloadBackoff = time.Second
+	// DefaultResponseTimeout is how long the HTTP client of NewHTTPClient waits for the response headers.
+	// The downloads themselves are not bounded, they take as long as the coupon bases are big.
+	DefaultResponseTimeout = 30 * time.Second
+)
+
+// Base is a coupon base of the manifest: the file Name, downloaded from URL, whose content has the hexadecimal
+// SHA-256 checksum SHA256, not checked if empty.
+type Base struct {
+	Name   string
+	URL    string
+	SHA256 string
+}
+
+// DownloaderConfig structure.
+// HTTPClient is the client that downloads the coupon bases, it defaults to NewHTTPClient. MaxRetries is the number of
+// times a failed download is resumed, waiting Backoff, doubled on every retry; a negative MaxRetries disables the
+// retries.
+type DownloaderConfig struct {
+	HTTPClient *http.Client
+	MaxRetries int
+	Backoff    time.Duration
+}
+
+// Downloader downloads the coupon bases as they are, compressed or not.
+//
+// The coupon base is written to <path>.part and renamed to path once complete and checked, so path is never a partial
+// download. A failed download is resumed with a Range request, from where it stopped, if the server supports it and
+// the coupon base did not change in between. The ETag and Last-Modified of the coupon bases are kept in
+// <path>.meta, so that a coupon base that did not change is not downloaded again.
+type Downloader struct {
+	httpClient *http.Client
+	maxRetries int
+	backoff    time.Duration
+}
+
+// NewHTTPClient returns the default client of the coupon bases given as URLs, which waits DefaultResponseTimeout for
+// the response headers.
+func NewHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = DefaultResponseTimeout
+	return &http.Client{Transport: transport}
+}
+
+// NewDownloader returns a new downloader of coupon bases.
+func NewDownloader(conf DownloaderConfig) *Downloader {
+	d := &Downloader{
+		httpClient: conf.HTTPClient,
+		maxRetries: conf.MaxRetries,
+		backoff:    conf.Backoff,
+	}
+	if d.httpClient == nil {
+		d.httpClient = NewHTTPClient()
+	}
+	switch {
+	case d.maxRetries == 0:
+		d.maxRetries = DefaultDownloadRetries
+	case d.maxRetries < 0:
+		d.maxRetries = 0
+	}
+	if d.backoff <= 0 {
+		d.backoff = DefaultDownloadBackoff
+	}
+	return d
+}
+
+// meta is what the server said about a coupon base, kept next to it.
+type meta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	// SHA256 is the checksum of the complete coupon base.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// validator returns the ETag, or the Last-Modified date, to send in the conditional requests, empty if the server
+// gave none.
+func (m *meta) validator() string {
+	if m.ETag != "" && !strings.HasPrefix(m.ETag, "W/") {
+		return m.ETag
+	}
+	return m.LastModified
+}
+
+// Download downloads the coupon base to path, unless the file at path is already up to date, and returns whether it
+// downloaded it. The download is retried on the network errors and on the server errors, resuming from where it
+// stopped.
+func (d *Downloader) Download(ctx context.Context, base Base, path string) (bool, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return false, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	backoff := d.backoff
+	for attempt := 0; ; attempt++ {
+		downloaded, err := d.download(ctx, base, path)
+		if err == nil {
+			return downloaded, nil
+		}
+		var temporary *temporaryError
+		if attempt >= d.maxRetries || !errors.As(err, &temporary) || ctx.Err() != nil {
+			return false, err
+		}
+		slog.Warn("Coupon base download failed, retrying", "url", base.URL, "error", err, "backoff", backoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false, errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// temporaryError is the error of a download that may succeed if retried.
+type temporaryError struct {
+	err error
+}
+
+func (e *temporaryError) Error() string { return e.err.Error() }
+func (e *temporaryError) Unwrap() error { return e.err }
+
+// download makes one attempt at downloading the coupon base.
+func (d *Downloader) download(ctx context.Context, base Base, path string) (bool, error) {
+	partPath, metaPath, partMetaPath := path+".part", path+".meta", path+".part.meta"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base.URL, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// resume the partial download if it can be, or ask for the coupon base only if it changed
+	offset := int64(0)
+	partMeta, err := readMeta(partMetaPath)
+	if err != nil {
+		return false, err
+	}
+	info, statErr := os.Stat(partPath)
+	if partMeta != nil && partMeta.URL == base.URL && partMeta.validator() != "" && statErr == nil && info.Size() > 0 {
+		offset = info.Size()
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+		req.Header.Set("If-Range", partMeta.validator())
+	} else if current, err := readMeta(metaPath); err != nil {
+		return false, err
+	} else if current != nil && current.URL == base.URL && fileExists(path) &&
+		(base.SHA256 == "" || strings.EqualFold(current.SHA256, base.SHA256)) {
+		if current.ETag != "" {
+			req.Header.Set("If-None-Match", current.ETag)
+		}
+		if current.LastModified != "" {
+			req.Header.Set("If-Modified-Since", current.LastModified)
+		}
+	}
+
+	slog.Info("Downloading coupon base", "url", base.URL, "offset", offset)
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return false, &temporaryError{err: fmt.Errorf("failed to download %s: %w", base.URL, err)}
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		slog.Info("Coupon base is up to date", "url", base.URL, "path", path)
+		return false, nil
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if start, ok := rangeStart(resp.Header.Get("Content-Range")); !ok || start != offset {
+			_ = os.Remove(partPath)
+			return false, &temporaryError{err: fmt.Errorf("unexpected range downloading %s: %q", base.URL, resp.Header.Get("Content-Range"))}
+		}
+	case resp.StatusCode == http.StatusOK:
+		// the whole coupon base, because it is the first attempt, the server does not support ranges, or it changed
+		offset = 0
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		m := meta{URL: base.URL, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+		if err := writeMeta(partMetaPath, m); err != nil {
+			return false, err
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		_ = os.Remove(partPath)
+		return false, &temporaryError{err: fmt.Errorf("bad status downloading %s: %d", base.URL, resp.StatusCode)}
+	case resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests:
+		return false, &temporaryError{err: fmt.Errorf("bad status downloading %s: %d", base.URL, resp.StatusCode)}
+	default:
+		return false, fmt.Errorf("bad status downloading %s: %d", base.URL, resp.StatusCode)
+	}
+
+	part, err := os.OpenFile(partPath, flag, 0o644)
+	if err != nil {
+		return false, fmt.Errorf("failed to create %s: %w", partPath, err)
+	}
+	n, err := io.Copy(part, resp.Body)
+	if closeErr := part.Close(); err == nil && closeErr != nil {
+		return false, fmt.Errorf("failed to write %s: %w", partPath, closeErr)
+	}
+	if err != nil {
+		// the part is kept, the next attempt resumes from its end
+		return false, &temporaryError{err: fmt.Errorf("failed to download %s after %d bytes: %w", base.URL, offset+n, err)}
+	}
+
+	sum, err := fileSHA256(partPath)
+	if err != nil {
+		return false, err
+	}
+	if base.SHA256 != "" && !strings.EqualFold(sum, base.SHA256) {
+		// a corrupt download is not resumed
+		_ = os.Remove(partPath)
+		_ = os.Remove(partMetaPath)
+		return false, fmt.Errorf("%w: %s has SHA-256 %s, expected %s", ErrChecksum, base.URL, sum, base.SHA256)
+	}
+
+	m, err := readMeta(partMetaPath)
+	if err != nil || m == nil {
+		return false, errors.Join(err, fmt.Errorf("%s is missing", partMetaPath))
+	}
+	m.SHA256 = sum
+	if err := os.Rename(partPath, path); err != nil {
+		return false, fmt.Errorf("failed to rename %s: %w", partPath, err)
+	}
+	// the meta is written last: if it is missing, the next download is a full one
+	if err := writeMeta(metaPath, *m); err != nil {
+		return false, err
+	}
+	_ = os.Remove(partMetaPath)
+	slog.Info("Coupon base downloaded", "url", base.URL, "path", path)
+	return true, nil
+}
+
+// rangeStart returns the first byte of a Content-Range header, e.g. 100 for "bytes 100-199/200".
+func rangeStart(contentRange string) (int64, bool) {
+	r, ok := strings.CutPrefix(contentRange, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	start, _, ok := strings.Cut(r, "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	return n, err == nil
+}
+
+// readMeta reads the meta file at path, and returns nil if there is none.
+func readMeta(path string) (*meta, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	m := &meta{}
+	if err := json.Unmarshal(data, m); err != nil {
+		// a corrupt meta file only costs a full download
+		return nil, nil
+	}
+	return m, nil
+}
+
+// writeMeta writes the meta file at path atomically.
+func writeMeta(path string, m meta) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to rename %s: %w", tmpPath, err)
+	}
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// fileSHA256 returns the hexadecimal SHA-256 checksum of the file at path.
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,304 @@
+package coupon_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/coupon"
+)
+
+// baseServer serves a coupon base with an ETag, supporting Range and conditional requests, and can fail the requests
+// on demand.
+type baseServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	content  []byte
+	etag     string
+	failures []func(w http.ResponseWriter) // the next requests fail with these, in order
+	requests []*http.Request
+	ranges   bool
+}
+
+func newBaseServer(t *testing.T, content []byte) *baseServer {
+	s := &baseServer{content: content, etag: `"v1"`, ranges: true}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *baseServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Clone(context.Background()))
+	var fail func(w http.ResponseWriter)
+	if len(s.failures) > 0 {
+		fail, s.failures = s.failures[0], s.failures[1:]
+	}
+	content, etag, ranges := s.content, s.etag, s.ranges
+	s.mu.Unlock()
+
+	if r.URL.Path != "/couponbase1.gz" {
+		http.NotFound(w, r)
+		return
+	}
+	if fail != nil {
+		fail(w)
+		return
+	}
+	if !ranges {
+		_, _ = w.Write(content)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+}
+
+// update changes the content of the coupon base and its ETag.
+func (s *baseServer) update(content []byte, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.content, s.etag = content, etag
+}
+
+func (s *baseServer) failNext(fails ...func(w http.ResponseWriter)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, fails...)
+}
+
+func (s *baseServer) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+func (s *baseServer) lastRequest() *http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[len(s.requests)-1]
+}
+
+// unavailable fails a request with a 503.
+func unavailable(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusServiceUnavailable)
+}
+
+// truncated sends the first n bytes of content and drops the connection.
+func truncated(content []byte, etag string, n int) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Length", "1000000")
+		_, _ = w.Write(content[:n])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func newDownloader(s *baseServer) *coupon.Downloader {
+	return coupon.NewDownloader(coupon.DownloaderConfig{HTTPClient: s.Client(), Backoff: time.Millisecond})
+}
+
+func TestDownloader(t *testing.T) {
+	content := gzipped(t, randomBases(1, 2000)[0])
+	require.Greater(t, len(content), 1000)
+
+	t.Run("download and skip when up to date", func(t *testing.T) {
+		s := newBaseServer(t, content)
+		d := newDownloader(s)
+		path := filepath.Join(t.TempDir(), "coupon", "couponbase1")
+		base := coupon.Base{Name: "couponbase1", URL: s.URL + "/couponbase1.gz", SHA256: sha256Hex(content)}
+
+		downloaded, err := d.Download(context.Background(), base, path)
+		require.NoError(t, err)
+		assert.True(t, downloaded)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+		assert.NoFileExists(t, path+".part")
+
+		downloaded, err = d.Download(context.Background(), base, path)
+		require.NoError(t, err)
+		assert.False(t, downloaded)
+		assert.Equal(t, `"v1"`, s.lastRequest().Header.Get("If-None-Match"))
+		assert.Equal(t, 2, s.requestCount())
+	})
+
+	t.Run("download again when changed", func(t *testing.T) {
+		s := newBaseServer(t, content)
+		d := newDownloader(s)
+		path := filepath.Join(t.TempDir(), "couponbase1")
+		base := coupon.Base{Name: "couponbase1", URL: s.URL + "/couponbase1.gz"}
+
+		_, err := d.Download(context.Background(), base, path)
+		require.NoError(t, err)
+
+		updated := gzipped(t, "BIRTHDAY\n")
+		s.update(updated, `"v2"`)
+		downloaded, err := d.Download(context.Background(), base, path)
+		require.NoError(t, err)
+		assert.True(t, downloaded)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, updated, data)
+	})
+
+	t.Run("download again when the checksum of the manifest changed", func(t *testing.T) {
+		s := newBaseServer(t, content)
+		d := newDownloader(s)
+		path := filepath.Join(t.TempDir(), "couponbase1")
+		base := coupon.Base{Name: "couponbase1", URL: s.URL + "/couponbase1.gz", SHA256: sha256Hex(content)}
+
+		_, err := d.Download(context.Background(), base, path)
+		require.NoError(t, err)
+
+		// the server did not change the ETag, but the manifest expects another coupon base
+		updated := gzipped(t, "BIRTHDAY\n")
+		s.update(updated, `"v1"`)
+		base.SHA256 = sha256Hex(updated)
+		downloaded, err := d.Download(context.Background(), base, path)
+		require.NoError(t, err)
+		assert.True(t, downloaded)
+		assert.Empty(t, s.lastRequest().Header.Get("If-None-Match"))
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, updated, data)
+	})
+
+	t.Run("resume after a dropped connection", func(t *testing.T) {
+		s := newBaseServer(t, content)
+		s.failNext(truncated(content, `"v1"`, 100))
+		d := newDownloader(s)
+		path := filepath.Join(t.TempDir(), "couponbase1")
+		base := coupon.Base{Name: "couponbase1", URL: s.URL + "/couponbase1.gz", SHA256: sha256Hex(content)}
+
+		downloaded, err := d.Download(context.Background(), base, path)
+		require.NoError(t, err)
+		assert.True(t, downloaded)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+
+		assert.Equal(t, 2, s.requestCount())
+		assert.Equal(t, "bytes=100-", s.lastRequest().Header.Get("Range"))
+		assert.Equal(t, `"v1"`, s.lastRequest().Header.Get("If-Range"))
+	})
+
+	t.Run("restart when changed since the dropped connection", func(t *testing.T) {
+		s := newBaseServer(t, content)
+		s.failNext(truncated(content, `"v0"`, 100))
+		d := newDownloader(s)
+		path := filepath.Join(t.TempDir(), "couponbase1")
+		base := coupon.Base{Name: "couponbase1", URL: s.URL + "/couponbase1.gz"}
+
+		_, err := d.Download(context.Background(), base, path)
+		require.NoError(t, err)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+		assert.Equal(t, `"v0"`, s.lastRequest().Header.Get("If-Range"))
+	})
+
+	t.Run("restart when ranges are not supported", func(t *testing.T) {
+		s := newBaseServer(t, content)
+		s.ranges = false
+		s.failNext(truncated(content, `"v1"`, 100))
+		d := newDownloader(s)
+		path := filepath.Join(t.TempDir(), "couponbase1")
+		base := coupon.Base{Name: "couponbase1", URL: s.URL + "/couponbase1.gz", SHA256: sha256Hex(content)}
+
+		_, err := d.Download(context.Background(), base, path)
+		require.NoError(t, err)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+	})
+
+	t.Run("retry server errors", func(t *testing.T) {
+		s := newBaseServer(t, content)
+		s.failNext(unavailable, unavailable)
+		d := newDownloader(s)
+		path := filepath.Join(t.TempDir(), "couponbase1")
+
+		_, err := d.Download(context.Background(), coupon.Base{Name: "couponbase1", URL: s.URL + "/couponbase1.gz"}, path)
+		require.NoError(t, err)
+		assert.Equal(t, 3, s.requestCount())
+	})
+
+	t.Run("give up after the retries", func(t *testing.T) {
+		s := newBaseServer(t, content)
+		s.failNext(unavailable, unavailable, unavailable)
+		d := coupon.NewDownloader(coupon.DownloaderConfig{HTTPClient: s.Client(), MaxRetries: 2, Backoff: time.Millisecond})
+		path := filepath.Join(t.TempDir(), "couponbase1")
+
+		_, err := d.Download(context.Background(), coupon.Base{Name: "couponbase1", URL: s.URL + "/couponbase1.gz"}, path)
+		require.EqualError(t, err, "bad status downloading "+s.URL+"/couponbase1.gz: 503")
+		assert.Equal(t, 3, s.requestCount())
+		assert.NoFileExists(t, path)
+	})
+
+	t.Run("not found is not retried", func(t *testing.T) {
+		s := newBaseServer(t, content)
+		d := newDownloader(s)
+		path := filepath.Join(t.TempDir(), "couponbase1")
+
+		_, err := d.Download(context.Background(), coupon.Base{Name: "couponbase1", URL: s.URL + "/missing.gz"}, path)
+		require.EqualError(t, err, "bad status downloading "+s.URL+"/missing.gz: 404")
+		assert.Equal(t, 1, s.requestCount())
+		assert.NoFileExists(t, path)
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		s := newBaseServer(t, content)
+		d := newDownloader(s)
+		dir := t.TempDir()
+		path := filepath.Join(dir, "couponbase1")
+		base := coupon.Base{Name: "couponbase1", URL: s.URL + "/couponbase1.gz", SHA256: sha256Hex([]byte("other"))}
+
+		_, err := d.Download(context.Background(), base, path)
+		require.ErrorIs(t, err, coupon.ErrChecksum)
+		assert.Equal(t, 1, s.requestCount())
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries, "no partial file is left")
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		s := newBaseServer(t, content)
+		s.failNext(unavailable)
+		d := coupon.NewDownloader(coupon.DownloaderConfig{HTTPClient: s.Client(), Backoff: time.Hour})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := d.Download(ctx, coupon.Base{Name: "couponbase1", URL: s.URL + "/couponbase1.gz"}, filepath.Join(t.TempDir(), "couponbase1"))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+// TestDownloader_validate checks that the downloaded coupon bases, stored compressed, are read by the validation.
+func TestDownloader_validate(t *testing.T) {
+	s := newBaseServer(t, gzipped(t, "HAPPYHRS\nFIFTYOFF\n"))
+	path := filepath.Join(t.TempDir(), "couponbase1")
+	_, err := newDownloader(s).Download(context.Background(), coupon.Base{Name: "couponbase1", URL: s.URL + "/couponbase1.gz"}, path)
+	require.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	_, err = coupon.Validate(context.Background(), []string{path}, minFiles(1), out, coupon.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "FIFTYOFF\nHAPPYHRS\n", out.String())
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	client := coupon.NewHTTPClient()
+	require.IsType(t, &http.Transport{}, client.Transport)
+	assert.Equal(t, coupon.DefaultResponseTimeout, client.Transport.(*http.Transport).ResponseHeaderTimeout)
+	assert.NotSame(t, http.DefaultTransport, client.Transport)
+}
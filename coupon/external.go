@@ -0,0 +1,341 @@
+package coupon
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultMemoryBudget is the default memory budget of ValidateExternal, in bytes.
+	DefaultMemoryBudget = 256 << 20
+
+	// DefaultFanIn is the default maximum number of runs ValidateExternal merges at once.
+	DefaultFanIn = 64
+
+	// codeOverhead is the estimated memory a code takes on top of its characters: the string header and the
+	// slice element, with some slack for the allocator.
+	codeOverhead = 32
+)
+
+// ExternalOptions are the options of ValidateExternal.
+type ExternalOptions struct {
+	// MemoryBudget bounds the memory taken by the codes held at once, in bytes. DefaultMemoryBudget if 0.
+	MemoryBudget int64
+	// TempDir is the directory the runs are written to, the default directory for temporary files if empty.
+	TempDir string
+	// FanIn is the maximum number of runs merged at once, which bounds the number of open files. DefaultFanIn if 0.
+	FanIn int
+	// ProgressInterval is how often the progress of the split is logged. DefaultProgressInterval if 0.
+	ProgressInterval time.Duration
+	Inputs
+}
+
+// ValidateExternal writes the same valid coupon codes as Validate, but holds only a bounded number of codes in memory.
+//
+// Every coupon base is split into runs: chunks of at most opts.MemoryBudget bytes of codes, sorted, deduplicated and
+// written to a temporary file. The runs of all the bases are then merged, opts.FanIn at a time, into one sorted stream
+// that carries the set of the bases each code appears in.
+func ValidateExternal(ctx context.Context, paths []string, rules Rules, w io.Writer, opts ExternalOptions) (count int, err error) {
+	codeOf, err := rules.compile(len(paths))
+	if err != nil {
+		return 0, err
+	}
+	if opts.MemoryBudget == 0 {
+		opts.MemoryBudget = DefaultMemoryBudget
+	}
+	if opts.FanIn == 0 {
+		opts.FanIn = DefaultFanIn
+	}
+	if opts.ProgressInterval == 0 {
+		opts.ProgressInterval = DefaultProgressInterval
+	}
+	if opts.MemoryBudget < 0 || opts.FanIn < 2 || opts.ProgressInterval < 0 {
+		return 0, fmt.Errorf("invalid memory budget %d, fan-in %d or progress interval %s", opts.MemoryBudget, opts.FanIn, opts.ProgressInterval)
+	}
+
+	p, err := newProgress(paths)
+	if err != nil {
+		return 0, err
+	}
+	reportCtx, stopReport := context.WithCancel(ctx)
+	defer stopReport()
+	go p.report(reportCtx, opts.ProgressInterval)
+
+	dir, err := os.MkdirTemp(opts.TempDir, "kart-coupons-")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create directory of the runs: %w", err)
+	}
+	defer func() {
+		if rmErr := os.RemoveAll(dir); rmErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to remove the runs: %w", rmErr))
+		}
+	}()
+	r := &runs{dir: dir, inputs: opts.Inputs, progress: p, codeOf: codeOf}
+
+	var runPaths []string
+	for i, path := range paths {
+		slog.Info("Splitting coupon base into runs", "path", path)
+		fileRuns, err := r.split(ctx, path, uint64(1)<<i, opts.MemoryBudget)
+		if err != nil {
+			return 0, err
+		}
+		slog.Info("Coupon base split", "path", path, "runs", len(fileRuns))
+		runPaths = append(runPaths, fileRuns...)
+	}
+	stopReport()
+
+	// merge the runs in groups until they can all be merged at once
+	for len(runPaths) > opts.FanIn {
+		slog.Info("Merging runs", "runs", len(runPaths))
+		var merged []string
+		for group := range slices.Chunk(runPaths, opts.FanIn) {
+			path, err := r.mergeToRun(ctx, group)
+			if err != nil {
+				return 0, err
+			}
+			merged = append(merged, path)
+		}
+		runPaths = merged
+	}
+
+	bw := bufio.NewWriter(w)
+	err = mergeRuns(ctx, runPaths, func(code string, files uint64) error {
+		if bits.OnesCount64(files) < rules.MinFiles {
+			return nil
+		}
+		count++
+		if _, err := bw.WriteString(code + "\n"); err != nil {
+			return fmt.Errorf("failed to write valid coupons: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to write valid coupons: %w", err)
+	}
+	return count, nil
+}
+
+// runs writes the runs to a directory. A run is a file of lines "<files> <code>", sorted by code without duplicates,
+// where files is the set of the bases the code appears in, in hexadecimal. The set comes first because a code may
+// contain spaces.
+type runs struct {
+	dir      string
+	next     int
+	inputs   Inputs
+	progress *progress
+	codeOf   codeFunc
+}
+
+// split splits the coupon base at path into runs of codes taking at most budget bytes, and returns their paths.
+func (r *runs) split(ctx context.Context, path string, bit uint64, budget int64) ([]string, error) {
+	var paths []string
+	var codes []string
+	size := int64(0)
+	flush := func() error {
+		if len(codes) == 0 {
+			return nil
+		}
+		slices.Sort(codes)
+		codes = slices.Compact(codes)
+		path, err := r.write(func(w *bufio.Writer) error {
+			for _, code := range codes {
+				if err := writeRunLine(w, code, bit); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		clear(codes)
+		codes, size = codes[:0], 0
+		return nil
+	}
+
+	err := scanCodes(ctx, r.inputs, path, r.progress, r.codeOf, func(code string) error {
+		codeSize := int64(len(code) + codeOverhead)
+		if size+codeSize > budget {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		codes = append(codes, code)
+		size += codeSize
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// mergeToRun merges the runs at paths into a new run, removes them and returns the path of the new run.
+func (r *runs) mergeToRun(ctx context.Context, paths []string) (string, error) {
+	path, err := r.write(func(w *bufio.Writer) error {
+		return mergeRuns(ctx, paths, func(code string, files uint64) error {
+			return writeRunLine(w, code, files)
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil {
+			return "", fmt.Errorf("failed to remove run: %w", err)
+		}
+	}
+	return path, nil
+}
+
+// write creates a new run and calls fn to write its lines.
+func (r *runs) write(fn func(w *bufio.Writer) error) (string, error) {
+	path := filepath.Join(r.dir, fmt.Sprintf("run-%06d", r.next))
+	r.next++
+
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create run: %w", err)
+	}
+	w := bufio.NewWriter(file)
+	err = fn(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write run: %w", err)
+	}
+	return path, nil
+}
+
+func writeRunLine(w *bufio.Writer, code string, files uint64) error {
+	_, err := w.WriteString(strconv.FormatUint(files, 16) + " " + code + "\n")
+	return err
+}
+
+// mergeRuns calls fn with every code of the runs at paths, in order, and the union of its sets of bases.
+func mergeRuns(ctx context.Context, paths []string, fn func(code string, files uint64) error) error {
+	h := make(runHeap, 0, len(paths))
+	defer func() {
+		for _, reader := range h {
+			_ = reader.file.Close()
+		}
+	}()
+	for _, path := range paths {
+		reader, err := openRun(path)
+		if err != nil {
+			return err
+		}
+		ok, err := reader.next()
+		if err != nil || !ok {
+			_ = reader.file.Close()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		h = append(h, reader)
+	}
+	heap.Init(&h)
+
+	for lines := 0; len(h) > 0; lines++ {
+		// checking the context on every line would slow the merge down
+		if lines%100_000 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		code, files := h[0].code, uint64(0)
+		for len(h) > 0 && h[0].code == code {
+			reader := h[0]
+			files |= reader.files
+			ok, err := reader.next()
+			if err != nil {
+				return err
+			}
+			if ok {
+				heap.Fix(&h, 0)
+			} else {
+				_ = reader.file.Close()
+				heap.Pop(&h)
+			}
+		}
+		if err := fn(code, files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runReader reads a run line by line.
+type runReader struct {
+	path    string
+	file    *os.File
+	scanner *bufio.Scanner
+	code    string
+	files   uint64
+}
+
+func openRun(path string) (*runReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open run: %w", err)
+	}
+	return &runReader{path: path, file: file, scanner: bufio.NewScanner(file)}, nil
+}
+
+// next reads the next line of the run, and returns false at the end of the run.
+func (r *runReader) next() (bool, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return false, fmt.Errorf("error scanning run %s: %w", r.path, err)
+		}
+		return false, nil
+	}
+	files, code, ok := strings.Cut(r.scanner.Text(), " ")
+	if !ok {
+		return false, fmt.Errorf("invalid line in run %s", r.path)
+	}
+	set, err := strconv.ParseUint(files, 16, 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid line in run %s: %w", r.path, err)
+	}
+	r.code, r.files = code, set
+	return true, nil
+}
+
+// runHeap is a min-heap of run readers by their current code.
+type runHeap []*runReader
+
+func (h runHeap) Len() int           { return len(h) }
+func (h runHeap) Less(i, j int) bool { return h[i].code < h[j].code }
+func (h runHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)        { *h = append(*h, x.(*runReader)) }
+
+func (h *runHeap) Pop() any {
+	old := *h
+	reader := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return reader
+}
@@ -0,0 +1,158 @@
+package coupon_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/coupon"
+)
+
+// randomBases returns n coupon bases of lines random lines each, drawn from a small set of codes so that many of them
+// appear in several bases and several times in the same base.
+func randomBases(n, lines int) []string {
+	r := rand.New(rand.NewPCG(1, 2))
+	bases := make([]string, 0, n)
+	for range n {
+		b := strings.Builder{}
+		for range lines {
+			// lengths 6 to 11, so that some codes are too short or too long
+			code := fmt.Sprintf("%0*d", 6+r.IntN(6), r.IntN(lines))
+			if r.IntN(10) == 0 {
+				code = "  " + code + " "
+			}
+			b.WriteString(code + "\n")
+		}
+		bases = append(bases, b.String())
+	}
+	return bases
+}
+
+func TestValidateExternal(t *testing.T) {
+	testCases := []struct {
+		name     string
+		files    []string
+		minFiles int
+		opts     coupon.ExternalOptions
+	}{
+		{
+			name: "default options",
+			files: []string{
+				"HAPPYHRS\nFIFTYOFF\nSHORT\nONLYINONE\n",
+				"FIFTYOFF\n  HAPPYHRS  \nSHORT\nTOOLONGCODE1\n",
+				"BIRTHDAY\nTOOLONGCODE1\nFIFTYOFF\n",
+			},
+			minFiles: 2,
+		},
+		{
+			name:     "repeated in one file",
+			files:    []string{"HAPPYHRS\nHAPPYHRS\n", "FIFTYOFF\n"},
+			minFiles: 2,
+		},
+		{
+			name:     "code with spaces",
+			files:    []string{"HAPPY HRS\n", "HAPPY HRS\n"},
+			minFiles: 2,
+		},
+		{
+			name:     "one run per file",
+			files:    randomBases(3, 2000),
+			minFiles: 2,
+		},
+		{
+			name:     "many runs per file",
+			files:    randomBases(3, 2000),
+			minFiles: 2,
+			opts:     coupon.ExternalOptions{MemoryBudget: 4 << 10},
+		},
+		{
+			name:     "many merge passes",
+			files:    randomBases(5, 2000),
+			minFiles: 3,
+			opts:     coupon.ExternalOptions{MemoryBudget: 1 << 10, FanIn: 2},
+		},
+		{
+			name:     "one code per run",
+			files:    randomBases(2, 200),
+			minFiles: 1,
+			opts:     coupon.ExternalOptions{MemoryBudget: 1, FanIn: 3},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			paths := writeFiles(t, test.files...)
+			expected := &bytes.Buffer{}
+			expectedCount, err := coupon.Validate(context.Background(), paths, minFiles(test.minFiles), expected, coupon.Options{Shards: 1})
+			require.NoError(t, err)
+
+			test.opts.TempDir = t.TempDir()
+			out := &bytes.Buffer{}
+			count, err := coupon.ValidateExternal(context.Background(), paths, minFiles(test.minFiles), out, test.opts)
+			require.NoError(t, err)
+			assert.Equal(t, expected.String(), out.String())
+			assert.Equal(t, expectedCount, count)
+
+			// the runs are removed
+			entries, err := os.ReadDir(test.opts.TempDir)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
+
+func TestValidateExternal_errors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		files       []string
+		minFiles    int
+		opts        coupon.ExternalOptions
+		expectedErr string
+	}{
+		{
+			name:        "minimum files out of range",
+			files:       []string{"HAPPYHRS\n", "HAPPYHRS\n"},
+			minFiles:    3,
+			expectedErr: "the minimum number of files must be between 1 and 2, got 3",
+		},
+		{
+			name:        "no files",
+			minFiles:    1,
+			expectedErr: "between 1 and 64 coupon bases are required, got 0",
+		},
+		{
+			name:        "fan-in too small",
+			files:       []string{"HAPPYHRS\n"},
+			minFiles:    1,
+			opts:        coupon.ExternalOptions{FanIn: 1},
+			expectedErr: "invalid memory budget 268435456, fan-in 1 or progress interval 10s",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := coupon.ValidateExternal(context.Background(), writeFiles(t, test.files...), minFiles(test.minFiles), &bytes.Buffer{}, test.opts)
+			require.EqualError(t, err, test.expectedErr)
+		})
+	}
+}
+
+func TestValidateExternal_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dir := t.TempDir()
+	_, err := coupon.ValidateExternal(ctx, writeFiles(t, "HAPPYHRS\n"), minFiles(1), &bytes.Buffer{}, coupon.ExternalOptions{TempDir: dir})
+	require.ErrorIs(t, err, context.Canceled)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,203 @@
+package coupon
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/business"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// DefaultGenerateLength is the number of random characters of a generated code, without its prefix and check
+// character.
+const DefaultGenerateLength = 8
+
+// maxGenerateRounds is the number of times in a row Generate draws codes that are all taken before it gives up.
+const maxGenerateRounds = 10
+
+// GenerateDB is the interface for the database layer that is required by Generate.
+type GenerateDB interface {
+	ExistingCoupons(ctx context.Context, codes []string) ([]string, error)
+	InsertCoupons(ctx context.Context, coupons []mongo.Coupon) error
+}
+
+// GenerateOptions are the options of Generate.
+// Count codes are generated, each of Prefix, Length random characters of Alphabet and the check character of those.
+// Length is DefaultGenerateLength if 0, Alphabet business.DefaultCouponAlphabet if empty, and BatchSize
+// DefaultBatchSize if 0. Campaign is saved with the coupons. If DryRun is set, nothing is written to the database.
+type GenerateOptions struct {
+	Count     int
+	Length    int
+	Prefix    string
+	Alphabet  string
+	Campaign  string
+	BatchSize int
+	DryRun    bool
+}
+
+// Generate inserts opts.Count new random coupon codes into db, BatchSize at a time, and writes them to w, one per
+// line, once they are inserted. The codes are drawn with crypto/rand, so they cannot be predicted, and the ones that
+// are already in db, deactivated or not, are drawn again; a dry run checks them too. It returns the number of codes
+// generated.
+func Generate(ctx context.Context, db GenerateDB, w io.Writer, opts GenerateOptions) (int, error) {
+	if opts.Length == 0 {
+		opts.Length = DefaultGenerateLength
+	}
+	if opts.Alphabet == "" {
+		opts.Alphabet = business.DefaultCouponAlphabet
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if err := checkGenerateOptions(opts); err != nil {
+		return 0, err
+	}
+
+	g := &generator{
+		db:    db,
+		opts:  opts,
+		chars: []rune(opts.Alphabet),
+		drawn: map[string]bool{},
+		generation: &mongo.CouponGeneration{
+			Batch:       bson.NewObjectID().Hex(),
+			GeneratedAt: time.Now().UTC(),
+			Campaign:    opts.Campaign,
+			Prefix:      opts.Prefix,
+		},
+	}
+	out := bufio.NewWriter(w)
+	count := 0
+	for count < opts.Count {
+		codes, err := g.batch(ctx, min(opts.BatchSize, opts.Count-count))
+		if err != nil {
+			return count, err
+		}
+		if !opts.DryRun {
+			coupons := make([]mongo.Coupon, 0, len(codes))
+			for _, code := range codes {
+				coupons = append(coupons, mongo.Coupon{Code: code, Generation: g.generation})
+			}
+			if err := db.InsertCoupons(ctx, coupons); err != nil {
+				return count, fmt.Errorf("failed to insert coupons after %d: %w", count, err)
+			}
+		}
+		count += len(codes)
+		for _, code := range codes {
+			if _, err := out.WriteString(code + "\n"); err != nil {
+				return count, fmt.Errorf("failed to write coupons: %w", err)
+			}
+		}
+		if err := out.Flush(); err != nil {
+			return count, fmt.Errorf("failed to write coupons: %w", err)
+		}
+	}
+	return count, nil
+}
+
+// checkGenerateOptions checks that the alphabet is made of distinct characters in canonical form, the prefix is in
+// canonical form, and that there are enough possible codes.
+func checkGenerateOptions(opts GenerateOptions) error {
+	if opts.Count < 0 || opts.Length < 1 {
+		return fmt.Errorf("invalid count %d or length %d", opts.Count, opts.Length)
+	}
+	chars := []rune(opts.Alphabet)
+	if len(chars) < 2 {
+		return fmt.Errorf("the alphabet must have at least 2 characters, got %q", opts.Alphabet)
+	}
+	for i, char := range chars {
+		if slices.Contains(chars[:i], char) {
+			return fmt.Errorf("the alphabet has %q twice", char)
+		}
+		if business.CanonicalCouponCode(string(char)) != string(char) {
+			return fmt.Errorf("the alphabet has %q, which is not in canonical form", char)
+		}
+	}
+	if business.CanonicalCouponCode(opts.Prefix) != opts.Prefix {
+		return fmt.Errorf("the prefix %q is not in canonical form, %q", opts.Prefix, business.CanonicalCouponCode(opts.Prefix))
+	}
+	// leave room for the codes that already exist
+	if possible := math.Pow(float64(len(chars)), float64(opts.Length)); float64(opts.Count) > possible/2 {
+		return fmt.Errorf("%d codes are too many for the %.0f possible codes of %d characters", opts.Count, possible, opts.Length)
+	}
+	return nil
+}
+
+// generator draws the codes of Generate.
+type generator struct {
+	db         GenerateDB
+	opts       GenerateOptions
+	chars      []rune
+	drawn      map[string]bool // the codes drawn so far, so that a code is never drawn twice
+	generation *mongo.CouponGeneration
+}
+
+// batch returns n new codes that are not in the database.
+func (g *generator) batch(ctx context.Context, n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for rounds := 0; len(codes) < n; {
+		// the codes drawn before are drawn again, but not used; the attempts are bounded in case none is left
+		want := n - len(codes)
+		candidates := make([]string, 0, want)
+		for attempt := 0; len(candidates) < want && attempt < 10*want; attempt++ {
+			code, err := g.code()
+			if err != nil {
+				return nil, err
+			}
+			if !g.drawn[code] {
+				g.drawn[code] = true
+				candidates = append(candidates, code)
+			}
+		}
+
+		var existing []string
+		if len(candidates) > 0 {
+			var err error
+			if existing, err = g.db.ExistingCoupons(ctx, candidates); err != nil {
+				return nil, fmt.Errorf("failed to find existing coupons: %w", err)
+			}
+		}
+		if len(existing) == len(candidates) {
+			if rounds++; rounds == maxGenerateRounds {
+				return nil, fmt.Errorf("failed to generate new codes: the codes drawn %d times in a row were all taken", rounds)
+			}
+		} else {
+			rounds = 0
+		}
+		exists := make(map[string]bool, len(existing))
+		for _, code := range existing {
+			exists[code] = true
+		}
+		for _, code := range candidates {
+			if !exists[code] {
+				codes = append(codes, code)
+			}
+		}
+	}
+	return codes, nil
+}
+
+// code returns a random code.
+func (g *generator) code() (string, error) {
+	random := make([]rune, 0, g.opts.Length)
+	size := big.NewInt(int64(len(g.chars)))
+	for range g.opts.Length {
+		i, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", fmt.Errorf("failed to draw a random character: %w", err)
+		}
+		random = append(random, g.chars[i.Int64()])
+	}
+	check, err := business.CheckCharacter(g.opts.Alphabet, string(random))
+	if err != nil {
+		return "", err
+	}
+	return g.opts.Prefix + string(random) + string(check), nil
+}
@@ -0,0 +1,190 @@
+package coupon_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/business"
+	"github.com/y7ls8i/kart/coupon"
+)
+
+func TestGenerate(t *testing.T) {
+	db := &mockGenerateDB{}
+	out := &bytes.Buffer{}
+	count, err := coupon.Generate(context.Background(), db, out, coupon.GenerateOptions{
+		Count:     5,
+		Prefix:    "SUMMER",
+		Campaign:  "summer-sale",
+		BatchSize: 2,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 5, count)
+
+	codes := strings.Fields(out.String())
+	require.Len(t, codes, 5)
+	require.Len(t, db.batches, 3)
+	var inserted []string
+	for _, batch := range db.batches {
+		for _, c := range batch {
+			inserted = append(inserted, c.Code)
+			require.NotNil(t, c.Generation)
+			assert.Equal(t, db.batches[0][0].Generation.Batch, c.Generation.Batch)
+			assert.Equal(t, "summer-sale", c.Generation.Campaign)
+			assert.Equal(t, "SUMMER", c.Generation.Prefix)
+			assert.False(t, c.Generation.GeneratedAt.IsZero())
+		}
+	}
+	assert.Equal(t, codes, inserted)
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		assert.False(t, seen[code], "%s is generated twice", code)
+		seen[code] = true
+
+		random, ok := strings.CutPrefix(code, "SUMMER")
+		require.True(t, ok, code)
+		assert.Len(t, random, coupon.DefaultGenerateLength+1)
+		assert.True(t, business.ValidCheckCharacter(business.DefaultCouponAlphabet, random), code)
+		assert.Equal(t, code, business.CanonicalCouponCode(code))
+	}
+}
+
+func TestGenerate_existing(t *testing.T) {
+	// 2 random characters of AB give the 4 codes AA, AB, BA and BB, with their check character
+	db := &mockGenerateDB{existing: map[string]bool{}}
+	for _, code := range []string{"AA", "AB", "BA"} {
+		check, err := business.CheckCharacter("AB", code)
+		require.NoError(t, err)
+		db.existing[code+string(check)] = true
+	}
+	out := &bytes.Buffer{}
+
+	_, err := coupon.Generate(context.Background(), db, out, coupon.GenerateOptions{Count: 1, Length: 2, Alphabet: "AB"})
+	require.NoError(t, err)
+	check, err := business.CheckCharacter("AB", "BB")
+	require.NoError(t, err)
+	assert.Equal(t, "BB"+string(check)+"\n", out.String())
+
+	// no new code is left
+	db.existing["BB"+string(check)] = true
+	_, err = coupon.Generate(context.Background(), db, out, coupon.GenerateOptions{Count: 1, Length: 2, Alphabet: "AB"})
+	require.EqualError(t, err, "failed to generate new codes: the codes drawn 10 times in a row were all taken")
+}
+
+func TestGenerate_dryRun(t *testing.T) {
+	db := &mockGenerateDB{}
+	out := &bytes.Buffer{}
+	count, err := coupon.Generate(context.Background(), db, out, coupon.GenerateOptions{Count: 3, Length: 4, DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Len(t, strings.Fields(out.String()), 3)
+	assert.Empty(t, db.batches)
+	assert.Equal(t, 1, db.lookups)
+}
+
+func TestGenerate_errors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		opts        coupon.GenerateOptions
+		mock        *mockGenerateDB
+		expectedErr string
+	}{
+		{
+			name:        "short alphabet",
+			opts:        coupon.GenerateOptions{Count: 1, Alphabet: "A"},
+			expectedErr: `the alphabet must have at least 2 characters, got "A"`,
+		},
+		{
+			name:        "repeated character",
+			opts:        coupon.GenerateOptions{Count: 1, Alphabet: "ABCA"},
+			expectedErr: `the alphabet has 'A' twice`,
+		},
+		{
+			name:        "lower case alphabet",
+			opts:        coupon.GenerateOptions{Count: 1, Alphabet: "ABc"},
+			expectedErr: `the alphabet has 'c', which is not in canonical form`,
+		},
+		{
+			name:        "separator in the alphabet",
+			opts:        coupon.GenerateOptions{Count: 1, Alphabet: "AB-"},
+			expectedErr: `the alphabet has '-', which is not in canonical form`,
+		},
+		{
+			name:        "prefix",
+			opts:        coupon.GenerateOptions{Count: 1, Prefix: "summer-"},
+			expectedErr: `the prefix "summer-" is not in canonical form, "SUMMER"`,
+		},
+		{
+			name:        "too many codes",
+			opts:        coupon.GenerateOptions{Count: 3, Length: 2, Alphabet: "AB"},
+			expectedErr: "3 codes are too many for the 4 possible codes of 2 characters",
+		},
+		{
+			name:        "negative count",
+			opts:        coupon.GenerateOptions{Count: -1},
+			expectedErr: "invalid count -1 or length 8",
+		},
+		{
+			name:        "lookup error",
+			opts:        coupon.GenerateOptions{Count: 1},
+			mock:        &mockGenerateDB{lookupErr: errors.New("connection refused")},
+			expectedErr: "failed to find existing coupons: connection refused",
+		},
+		{
+			name:        "insert error",
+			opts:        coupon.GenerateOptions{Count: 1},
+			mock:        &mockGenerateDB{insertErr: errors.New("duplicate key")},
+			expectedErr: "failed to insert coupons after 0: duplicate key",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			db := test.mock
+			if db == nil {
+				db = &mockGenerateDB{}
+			}
+			out := &bytes.Buffer{}
+			_, err := coupon.Generate(context.Background(), db, out, test.opts)
+			require.EqualError(t, err, test.expectedErr)
+			assert.Empty(t, out.String())
+		})
+	}
+}
+
+type mockGenerateDB struct {
+	existing  map[string]bool
+	batches   [][]mongo.Coupon
+	lookups   int
+	lookupErr error
+	insertErr error
+}
+
+func (m *mockGenerateDB) ExistingCoupons(_ context.Context, codes []string) ([]string, error) {
+	m.lookups++
+	if m.lookupErr != nil {
+		return nil, m.lookupErr
+	}
+	var existing []string
+	for _, code := range codes {
+		if m.existing[code] {
+			existing = append(existing, code)
+		}
+	}
+	return existing, nil
+}
+
+func (m *mockGenerateDB) InsertCoupons(_ context.Context, coupons []mongo.Coupon) error {
+	if m.insertErr != nil {
+		return m.insertErr
+	}
+	m.batches = append(m.batches, append([]mongo.Coupon(nil), coupons...))
+	return nil
+}
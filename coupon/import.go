@@ -0,0 +1,59 @@
+package coupon
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/business"
+)
+
+// DefaultBatchSize is the number of coupons inserted at once by Import.
+const DefaultBatchSize = 1000
+
+// DB is the interface for the database layer that is required by Import.
+type DB interface {
+	InsertCoupons(ctx context.Context, coupons []mongo.Coupon) error
+}
+
+// Import inserts the coupon codes read from r, one per line, into db in their canonical form, batchSize at a time.
+// The blank lines are skipped. It returns the number of coupons inserted.
+func Import(ctx context.Context, db DB, r io.Reader, batchSize int) (int, error) {
+	if batchSize < 1 {
+		batchSize = DefaultBatchSize
+	}
+
+	count := 0
+	batch := make([]mongo.Coupon, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := db.InsertCoupons(ctx, batch); err != nil {
+			return fmt.Errorf("failed to insert coupons after %d: %w", count, err)
+		}
+		count += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		code := business.CanonicalCouponCode(scanner.Text())
+		if code == "" {
+			continue
+		}
+		batch = append(batch, mongo.Coupon{Code: code})
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return count, fmt.Errorf("failed to read coupons: %w", err)
+	}
+	return count, flush()
+}
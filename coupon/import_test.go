@@ -0,0 +1,79 @@
+package coupon_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/coupon"
+)
+
+func TestImport(t *testing.T) {
+	testCases := []struct {
+		name            string
+		input           string
+		batchSize       int
+		mock            *mockDB
+		expectedCount   int
+		expectedBatches [][]mongo.Coupon
+		expectedErr     string
+	}{
+		{
+			name:          "batches",
+			input:         "HAPPYHRS\n\nfifty-off\n  BIRTHDAY  \n",
+			batchSize:     2,
+			mock:          &mockDB{},
+			expectedCount: 3,
+			expectedBatches: [][]mongo.Coupon{
+				{{Code: "HAPPYHRS"}, {Code: "FIFTYOFF"}},
+				{{Code: "BIRTHDAY"}},
+			},
+		},
+		{
+			name:          "empty",
+			input:         "\n",
+			mock:          &mockDB{},
+			expectedCount: 0,
+		},
+		{
+			name:            "insert error",
+			input:           "HAPPYHRS\nFIFTYOFF\nBIRTHDAY\n",
+			batchSize:       2,
+			mock:            &mockDB{errAt: 2},
+			expectedCount:   2,
+			expectedBatches: [][]mongo.Coupon{{{Code: "HAPPYHRS"}, {Code: "FIFTYOFF"}}},
+			expectedErr:     "failed to insert coupons after 2: duplicate key",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			count, err := coupon.Import(context.Background(), test.mock, strings.NewReader(test.input), test.batchSize)
+			if test.expectedErr != "" {
+				require.EqualError(t, err, test.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, test.expectedCount, count)
+			assert.Equal(t, test.expectedBatches, test.mock.batches)
+		})
+	}
+}
+
+type mockDB struct {
+	batches [][]mongo.Coupon
+	errAt   int // the call that fails, starting at 1
+}
+
+func (m *mockDB) InsertCoupons(_ context.Context, coupons []mongo.Coupon) error {
+	if len(m.batches)+1 == m.errAt {
+		return errors.New("duplicate key")
+	}
+	m.batches = append(m.batches, append([]mongo.Coupon(nil), coupons...))
+	return nil
+}
@@ -0,0 +1,205 @@
+package coupon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/y7ls8i/kart/adapter/mongo"
+	aperr "github.com/y7ls8i/kart/error"
+)
+
+// ErrIndexFormat is returned by OpenIndex when the file is not an index of coupon codes.
+var ErrIndexFormat = errors.New("not a coupon index")
+
+// The index file is a header followed by the codes, sorted and padded with zero bytes to the length of the longest,
+// so that the code i is at indexHeaderSize + i*width. The header is indexMagic, indexVersion, a zero byte, the width
+// as a big-endian uint16 and the number of codes as a big-endian uint64.
+const (
+	indexMagic      = "KCPI"
+	indexVersion    = 1
+	indexHeaderSize = 16
+)
+
+// BuildIndex writes the index of the valid coupon codes read from the file at src, one per line and sorted, as
+// Validate writes them, to the file at dst, and returns the number of codes. The codes are indexed in their canonical
+// form, in which they must be sorted, like Sync. The blank lines and the repeated codes are skipped. The file at dst
+// is replaced only once the index is complete.
+func BuildIndex(src, dst string) (int, error) {
+	// the first pass finds the width of the records, the second writes them
+	count, width := 0, 0
+	err := eachValidCode(src, func(code string) error {
+		if strings.IndexByte(code, 0) >= 0 {
+			return fmt.Errorf("coupon %q has a zero byte", code)
+		}
+		count++
+		width = max(width, len(code))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if width > math.MaxUint16 {
+		return 0, fmt.Errorf("coupons of %d bytes are too long for an index", width)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmpPath := dst + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", tmpPath, err)
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(tmpPath)
+	}()
+
+	w := bufio.NewWriter(file)
+	header := make([]byte, indexHeaderSize)
+	copy(header, indexMagic)
+	header[4] = indexVersion
+	binary.BigEndian.PutUint16(header[6:], uint16(width))
+	binary.BigEndian.PutUint64(header[8:], uint64(count))
+	if _, err := w.Write(header); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", tmpPath, err)
+	}
+	record := make([]byte, width)
+	err = eachValidCode(src, func(code string) error {
+		clear(record[copy(record, code):])
+		_, err := w.Write(record)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", tmpPath, err)
+	}
+	if err := w.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", tmpPath, err)
+	}
+	if err := file.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, dst); err != nil {
+		return 0, fmt.Errorf("failed to rename %s: %w", tmpPath, err)
+	}
+	return count, nil
+}
+
+// eachValidCode calls fn with the codes of the file at path, like Sync reads them.
+func eachValidCode(path string, fn func(code string) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	codes := newCodeReader(file)
+	for {
+		code, ok, err := codes.peek()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		if err := fn(code); err != nil {
+			return err
+		}
+		codes.next()
+	}
+}
+
+// Index is a coupon store that looks the codes up in an index file built by BuildIndex, memory-mapped, with a binary
+// search. The index is read-only: rebuilding the file, which replaces it, does not change an open index.
+type Index struct {
+	records []byte
+	width   int
+	count   int
+	unmap   func() error
+}
+
+// OpenIndex opens the index file at path. The index must be closed once no longer used.
+func OpenIndex(path string) (*Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	if info.Size() < indexHeaderSize || info.Size() > math.MaxInt {
+		return nil, fmt.Errorf("%w: %s has %d bytes", ErrIndexFormat, path, info.Size())
+	}
+
+	data, unmap, err := mmap(file, int(info.Size()))
+	if err != nil {
+		return nil, err
+	}
+	width := uint64(binary.BigEndian.Uint16(data[6:]))
+	count := binary.BigEndian.Uint64(data[8:])
+	size := uint64(len(data) - indexHeaderSize)
+	switch {
+	case string(data[:4]) != indexMagic:
+		err = fmt.Errorf("%w: %s does not start with %q", ErrIndexFormat, path, indexMagic)
+	case data[4] != indexVersion:
+		err = fmt.Errorf("%w: %s has version %d, expected %d", ErrIndexFormat, path, data[4], indexVersion)
+	case width == 0 && (count != 0 || size != 0), width > 0 && (size%width != 0 || size/width != count):
+		err = fmt.Errorf("%w: %s has %d bytes for %d codes of %d bytes", ErrIndexFormat, path, len(data), count, width)
+	}
+	if err != nil {
+		_ = unmap()
+		return nil, err
+	}
+	return &Index{records: data[indexHeaderSize:], width: int(width), count: int(count), unmap: unmap}, nil
+}
+
+// Len returns the number of coupon codes of the index.
+func (x *Index) Len() int {
+	return x.count
+}
+
+// FindOneCoupon returns the coupon with the code, or aperr.ErrNotFound if the code is not in the index.
+func (x *Index) FindOneCoupon(_ context.Context, code string) (*mongo.Coupon, error) {
+	if code == "" || len(code) > x.width {
+		return nil, aperr.ErrNotFound
+	}
+	i := sort.Search(x.count, func(i int) bool {
+		return string(x.code(i)) >= code
+	})
+	if i == x.count || string(x.code(i)) != code {
+		return nil, aperr.ErrNotFound
+	}
+	return &mongo.Coupon{Code: code}, nil
+}
+
+// code returns the code i, without its padding.
+func (x *Index) code(i int) []byte {
+	record := x.records[i*x.width : (i+1)*x.width]
+	if n := bytes.IndexByte(record, 0); n >= 0 {
+		return record[:n]
+	}
+	return record
+}
+
+// Close unmaps the index file. The index must not be used once closed.
+func (x *Index) Close() error {
+	if err := x.unmap(); err != nil {
+		return fmt.Errorf("failed to close index: %w", err)
+	}
+	return nil
+}
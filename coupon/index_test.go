@@ -0,0 +1,146 @@
+package coupon_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/coupon"
+	aperr "github.com/y7ls8i/kart/error"
+)
+
+// buildIndex builds the index of the valid coupons and opens it.
+func buildIndex(tb testing.TB, valid string) *coupon.Index {
+	tb.Helper()
+	dir := tb.TempDir()
+	src, dst := filepath.Join(dir, "valid"), filepath.Join(dir, "valid.idx")
+	require.NoError(tb, os.WriteFile(src, []byte(valid), 0o600))
+	_, err := coupon.BuildIndex(src, dst)
+	require.NoError(tb, err)
+	index, err := coupon.OpenIndex(dst)
+	require.NoError(tb, err)
+	tb.Cleanup(func() {
+		require.NoError(tb, index.Close())
+	})
+	return index
+}
+
+func TestIndex(t *testing.T) {
+	index := buildIndex(t, "\nBIRTHDAY\nFIFTYOFF\nFIFTYOFF\n  happy-hrs  \nSUPER100OFF\n")
+	assert.Equal(t, 4, index.Len())
+
+	testCases := []struct {
+		name     string
+		code     string
+		expected *mongo.Coupon
+	}{
+		{name: "first", code: "BIRTHDAY", expected: &mongo.Coupon{Code: "BIRTHDAY"}},
+		{name: "repeated", code: "FIFTYOFF", expected: &mongo.Coupon{Code: "FIFTYOFF"}},
+		{name: "canonical", code: "HAPPYHRS", expected: &mongo.Coupon{Code: "HAPPYHRS"}},
+		{name: "longest", code: "SUPER100OFF", expected: &mongo.Coupon{Code: "SUPER100OFF"}},
+		{name: "before the first", code: "AAAAAAAA"},
+		{name: "after the last", code: "ZZZZZZZZ"},
+		{name: "between", code: "CHEAPEST"},
+		{name: "prefix", code: "FIFTY"},
+		{name: "longer than any", code: "SUPER100OFFF"},
+		{name: "empty", code: ""},
+		{name: "case", code: "birthday"},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := index.FindOneCoupon(context.Background(), test.code)
+			if test.expected == nil {
+				require.ErrorIs(t, err, aperr.ErrNotFound)
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, got)
+		})
+	}
+}
+
+func TestIndex_empty(t *testing.T) {
+	index := buildIndex(t, "\n")
+	assert.Equal(t, 0, index.Len())
+	_, err := index.FindOneCoupon(context.Background(), "BIRTHDAY")
+	require.ErrorIs(t, err, aperr.ErrNotFound)
+}
+
+func TestBuildIndex_errors(t *testing.T) {
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "valid.idx")
+	require.NoError(t, os.WriteFile(dst, []byte("previous"), 0o600))
+
+	src := filepath.Join(dir, "valid")
+	require.NoError(t, os.WriteFile(src, []byte("FIFTYOFF\nBIRTHDAY\n"), 0o600))
+	_, err := coupon.BuildIndex(src, dst)
+	require.ErrorIs(t, err, coupon.ErrUnsorted)
+
+	_, err = coupon.BuildIndex(filepath.Join(dir, "missing"), dst)
+	require.ErrorContains(t, err, "failed to open")
+
+	// the previous index is kept, and no temporary file is left
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "previous", string(data))
+	assert.NoFileExists(t, dst+".tmp")
+}
+
+func TestOpenIndex_errors(t *testing.T) {
+	valid := filepath.Join(t.TempDir(), "valid")
+	require.NoError(t, os.WriteFile(valid, []byte("BIRTHDAY\nFIFTYOFF\n"), 0o600))
+	index := filepath.Join(t.TempDir(), "valid.idx")
+	_, err := coupon.BuildIndex(valid, index)
+	require.NoError(t, err)
+	data, err := os.ReadFile(index)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name        string
+		content     []byte
+		expectedErr string
+	}{
+		{name: "too short", content: data[:10], expectedErr: "has 10 bytes"},
+		{name: "not an index", content: append([]byte("NOPE"), data[4:]...), expectedErr: `does not start with "KCPI"`},
+		{name: "version", content: append([]byte("KCPI\x09"), data[5:]...), expectedErr: "has version 9, expected 1"},
+		{name: "truncated", content: data[:len(data)-1], expectedErr: "has 31 bytes for 2 codes of 8 bytes"},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "valid.idx")
+			require.NoError(t, os.WriteFile(path, test.content, 0o600))
+			_, err := coupon.OpenIndex(path)
+			require.ErrorIs(t, err, coupon.ErrIndexFormat)
+			assert.ErrorContains(t, err, test.expectedErr)
+		})
+	}
+}
+
+// benchmarkCodes is the number of coupons of the benchmarks; BenchmarkFindOneCoupon of adapter/mongo looks them up in
+// MongoDB, to compare.
+const benchmarkCodes = 100_000
+
+func BenchmarkIndex_FindOneCoupon(b *testing.B) {
+	// the index has the even codes, so every other lookup is a miss
+	codes := make([]string, 2*benchmarkCodes)
+	valid := strings.Builder{}
+	for i := range codes {
+		codes[i] = fmt.Sprintf("CODE%06d", i)
+		if i%2 == 0 {
+			valid.WriteString(codes[i] + "\n")
+		}
+	}
+	index := buildIndex(b, valid.String())
+	ctx := context.Background()
+
+	for i := 0; b.Loop(); i++ {
+		_, _ = index.FindOneCoupon(ctx, codes[i%len(codes)])
+	}
+}
@@ -0,0 +1,157 @@
+package coupon
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrChecksum is returned when a coupon base does not have the expected SHA-256 checksum.
+var ErrChecksum = errors.New("checksum mismatch")
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Inputs tells how the coupon bases are read. A coupon base is either a file or an http or https URL, whose body is
+// streamed into the validation without being written to disk. Either may be plain, gzipped or zstd-compressed; the
+// format is detected from the first bytes.
+type Inputs struct {
+	// Client downloads the coupon bases given as URLs. NewHTTPClient if nil.
+	Client *http.Client
+	// SHA256 are the expected hexadecimal SHA-256 checksums of the coupon bases as stored or downloaded, that is
+	// before decompression, by path or URL. The coupon bases without a checksum are not checked.
+	SHA256 map[string]string
+}
+
+// isURL reports whether the coupon base at path is downloaded.
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// input is an open coupon base.
+type input struct {
+	io.Reader // the decompressed content
+
+	path     string
+	raw      io.Reader // the content as stored or downloaded
+	hash     hash.Hash
+	expected string
+	closers  []func() error
+}
+
+// open opens the coupon base at path and counts the bytes read, before decompression, in p.
+func (in Inputs) open(ctx context.Context, path string, p *progress) (_ *input, err error) {
+	i := &input{path: path, expected: in.SHA256[path]}
+	defer func() {
+		if err != nil {
+			_ = i.Close()
+		}
+	}()
+
+	if isURL(path) {
+		body, size, err := in.download(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		i.closers = append(i.closers, body.Close)
+		if size > 0 {
+			p.total.Add(size)
+		}
+		i.raw = body
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		i.closers = append(i.closers, file.Close)
+		i.raw = file
+	}
+	i.raw = p.reader(i.raw)
+	if i.expected != "" {
+		i.hash = sha256.New()
+		i.raw = io.TeeReader(i.raw, i.hash)
+	}
+
+	buffered := bufio.NewReader(i.raw)
+	magic, _ := buffered.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzipped %s: %w", path, err)
+		}
+		i.closers = append(i.closers, gz.Close)
+		i.Reader = gz
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zstd-compressed %s: %w", path, err)
+		}
+		i.closers = append(i.closers, func() error {
+			zr.Close()
+			return nil
+		})
+		i.Reader = zr
+	default:
+		i.Reader = buffered
+	}
+	return i, nil
+}
+
+// download starts downloading the coupon base at url and returns its body and its size, -1 if unknown.
+func (in Inputs) download(ctx context.Context, url string) (io.ReadCloser, int64, error) {
+	client := in.Client
+	if client == nil {
+		client = NewHTTPClient()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, 0, fmt.Errorf("bad status downloading %s: %d", url, resp.StatusCode)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// verify reads the rest of the coupon base, which the decompressor may have left, and checks its checksum.
+func (i *input) verify() error {
+	if i.hash == nil {
+		return nil
+	}
+	if _, err := io.Copy(io.Discard, i.raw); err != nil {
+		return fmt.Errorf("failed to read %s: %w", i.path, err)
+	}
+	if sum := hex.EncodeToString(i.hash.Sum(nil)); !strings.EqualFold(sum, i.expected) {
+		return fmt.Errorf("%w: %s has SHA-256 %s, expected %s", ErrChecksum, i.path, sum, i.expected)
+	}
+	return nil
+}
+
+// Close closes the decompressor and the file or the download.
+func (i *input) Close() error {
+	var errs []error
+	for j := len(i.closers) - 1; j >= 0; j-- {
+		errs = append(errs, i.closers[j]())
+	}
+	return errors.Join(errs...)
+}
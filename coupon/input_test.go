@@ -0,0 +1,149 @@
+package coupon_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/coupon"
+)
+
+func gzipped(t *testing.T, content string) []byte {
+	t.Helper()
+	b := &bytes.Buffer{}
+	w := gzip.NewWriter(b)
+	_, err := w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return b.Bytes()
+}
+
+func zstdCompressed(t *testing.T, content string) []byte {
+	t.Helper()
+	w, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	return w.EncodeAll([]byte(content), nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestInputs(t *testing.T) {
+	const (
+		base1 = "HAPPYHRS\nFIFTYOFF\nONLYINONE\n"
+		base2 = "FIFTYOFF\nHAPPYHRS\n"
+		base3 = "BIRTHDAY\nFIFTYOFF\n"
+	)
+	compressed := map[string][]byte{
+		"/couponbase1.gz":  gzipped(t, base1),
+		"/couponbase2.zst": zstdCompressed(t, base2),
+		"/couponbase3":     []byte(base3),
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := compressed[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	files := make([]string, 0, len(compressed))
+	urls := make([]string, 0, len(compressed))
+	checksums := map[string]string{}
+	for _, name := range []string{"/couponbase1.gz", "/couponbase2.zst", "/couponbase3"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, compressed[name], 0o600))
+		files = append(files, path)
+		urls = append(urls, ts.URL+name)
+		checksums[ts.URL+name] = sha256Hex(compressed[name])
+	}
+
+	testCases := []struct {
+		name        string
+		paths       []string
+		inputs      coupon.Inputs
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     "compressed files",
+			paths:    files,
+			expected: "FIFTYOFF\nHAPPYHRS\n",
+		},
+		{
+			name:     "streamed",
+			paths:    urls,
+			inputs:   coupon.Inputs{Client: ts.Client(), SHA256: checksums},
+			expected: "FIFTYOFF\nHAPPYHRS\n",
+		},
+		{
+			name:     "files and streams",
+			paths:    []string{files[0], urls[1], files[2]},
+			inputs:   coupon.Inputs{Client: ts.Client()},
+			expected: "FIFTYOFF\nHAPPYHRS\n",
+		},
+		{
+			name:     "file checksum",
+			paths:    files,
+			inputs:   coupon.Inputs{SHA256: map[string]string{files[0]: sha256Hex(compressed["/couponbase1.gz"])}},
+			expected: "FIFTYOFF\nHAPPYHRS\n",
+		},
+		{
+			name:   "checksum mismatch",
+			paths:  urls,
+			inputs: coupon.Inputs{Client: ts.Client(), SHA256: map[string]string{urls[1]: checksums[urls[0]]}},
+			expectedErr: "checksum mismatch: " + urls[1] + " has SHA-256 " + checksums[urls[1]] +
+				", expected " + checksums[urls[0]],
+		},
+		{
+			name:        "not found",
+			paths:       []string{urls[0], ts.URL + "/missing"},
+			inputs:      coupon.Inputs{Client: ts.Client()},
+			expectedErr: "bad status downloading " + ts.URL + "/missing: 404",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			_, err := coupon.Validate(context.Background(), test.paths, minFiles(2), out, coupon.Options{Inputs: test.inputs})
+			if test.expectedErr != "" {
+				require.EqualError(t, err, test.expectedErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, test.expected, out.String())
+			}
+
+			out.Reset()
+			_, err = coupon.ValidateExternal(context.Background(), test.paths, minFiles(2), out,
+				coupon.ExternalOptions{TempDir: t.TempDir(), Inputs: test.inputs})
+			if test.expectedErr != "" {
+				require.EqualError(t, err, test.expectedErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, test.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestInputs_checksumError(t *testing.T) {
+	path := writeFiles(t, "HAPPYHRS\n")[0]
+	_, err := coupon.Validate(context.Background(), []string{path}, minFiles(1), &bytes.Buffer{},
+		coupon.Options{Inputs: coupon.Inputs{SHA256: map[string]string{path: "00"}}})
+	require.ErrorIs(t, err, coupon.ErrChecksum)
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package coupon
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// mmap reads the first size bytes of file into memory, where memory-mapped files are not supported.
+func mmap(file *os.File, size int) ([]byte, func() error, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(file, data); err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", file.Name(), err)
+	}
+	return data, func() error { return nil }, nil
+}
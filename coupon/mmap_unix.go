@@ -0,0 +1,19 @@
+//go:build unix
+
+package coupon
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mmap maps the first size bytes of file into memory, read-only, and returns the function that unmaps them. The
+// mapping stays valid once the file is closed.
+func mmap(file *os.File, size int) ([]byte, func() error, error) {
+	data, err := syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to map %s: %w", file.Name(), err)
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,86 @@
+package coupon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultProgressInterval is how often the progress of a validation is logged by default.
+const DefaultProgressInterval = 10 * time.Second
+
+// progress counts the lines and bytes read from the coupon bases, from any number of goroutines, and logs the rate
+// and the estimated time left.
+type progress struct {
+	start time.Time
+	total atomic.Int64
+	lines atomic.Int64
+	bytes atomic.Int64
+}
+
+// newProgress returns the progress of reading the coupon bases at paths. The total size starts as the size of the
+// files now, and the size of the downloads is added as they start.
+func newProgress(paths []string) (*progress, error) {
+	p := &progress{start: time.Now()}
+	for _, path := range paths {
+		if isURL(path) {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		p.total.Add(info.Size())
+	}
+	return p, nil
+}
+
+// report logs the progress every interval until ctx is done.
+func (p *progress) report(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.log()
+		}
+	}
+}
+
+func (p *progress) log() {
+	elapsed := time.Since(p.start)
+	lines, bytes, total := p.lines.Load(), p.bytes.Load(), p.total.Load()
+	attrs := []any{
+		"lines", lines,
+		"linesPerSecond", int64(float64(lines) / elapsed.Seconds()),
+		"bytes", bytes,
+		"totalBytes", total,
+	}
+	if bytes > 0 && bytes <= total {
+		eta := time.Duration(float64(elapsed) * float64(total-bytes) / float64(bytes))
+		attrs = append(attrs, "eta", eta.Round(time.Second).String())
+	}
+	slog.Info("Validating coupons", attrs...)
+}
+
+// reader returns a reader that counts the bytes read from r.
+func (p *progress) reader(r io.Reader) io.Reader {
+	return &countingReader{r: r, n: &p.bytes}
+}
+
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,52 @@
+package coupon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanCodes_progress(t *testing.T) {
+	testCases := []struct {
+		name  string
+		lines int
+	}{
+		{name: "empty", lines: 0},
+		{name: "less than a block", lines: 12},
+		{name: "exactly a block", lines: 100_000},
+		{name: "more than a block", lines: 100_001},
+		{name: "exactly two blocks", lines: 200_000},
+		{name: "between blocks", lines: 250_000},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			b := &strings.Builder{}
+			for i := range test.lines {
+				_, _ = fmt.Fprintf(b, "CODE%06d\n", i)
+			}
+			path := filepath.Join(t.TempDir(), "couponbase")
+			require.NoError(t, os.WriteFile(path, []byte(b.String()), 0o600))
+
+			codeOf, err := Rules{MinLength: MinLength, MaxLength: MaxLength, MinFiles: 1}.compile(1)
+			require.NoError(t, err)
+			p, err := newProgress([]string{path})
+			require.NoError(t, err)
+			codes := 0
+			err = scanCodes(t.Context(), Inputs{}, path, p, codeOf, func(string) error {
+				codes++
+				return nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, test.lines, codes)
+			assert.Equal(t, int64(test.lines), p.lines.Load())
+			assert.Equal(t, int64(b.Len()), p.bytes.Load())
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package coupon
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/y7ls8i/kart/business"
+)
+
+// MaxFiles is the maximum number of coupon bases the validation can read.
+const MaxFiles = 64
+
+// Case is how the codes are normalised before they are compared.
+type Case string
+
+const (
+	// CaseKeep keeps the codes as they are.
+	CaseKeep Case = ""
+	// CaseUpper turns the codes to upper case.
+	CaseUpper Case = "upper"
+	// CaseLower turns the codes to lower case.
+	CaseLower Case = "lower"
+)
+
+// Rules are the rules of the valid coupon codes. A line of a coupon base is trimmed and normalised to Case, and the
+// code is valid if it is MinLength to MaxLength characters long, matches Pattern entirely if it is set, and appears
+// in at least MinFiles of the coupon bases.
+type Rules struct {
+	MinLength int
+	MaxLength int
+	// Pattern is a regular expression, e.g. [A-Z0-9]+, the whole code must match.
+	Pattern  string
+	Case     Case
+	MinFiles int
+	// Canonical turns the lines to the canonical form of the codes instead of Case, see business.CanonicalCouponCode,
+	// so that happy-hrs and HAPPYHRS are the same code, which is the form Sync and BuildIndex read.
+	Canonical bool
+}
+
+// DefaultRules returns the rules of the valid coupon codes of the coupon bases.
+func DefaultRules() Rules {
+	return Rules{MinLength: MinLength, MaxLength: MaxLength, MinFiles: MinFiles}
+}
+
+// codeFunc normalises a line of a coupon base into a code, and reports whether the code is of the right length and
+// pattern.
+type codeFunc func(line string) (string, bool)
+
+// compile checks the rules for files coupon bases and returns the function that turns their lines into codes.
+func (r Rules) compile(files int) (codeFunc, error) {
+	var errs []error
+	if files == 0 || files > MaxFiles {
+		errs = append(errs, fmt.Errorf("between 1 and %d coupon bases are required, got %d", MaxFiles, files))
+	}
+	if r.MinFiles < 1 || (files > 0 && r.MinFiles > files) {
+		errs = append(errs, fmt.Errorf("the minimum number of files must be between 1 and %d, got %d", max(files, 1), r.MinFiles))
+	}
+	if r.MinLength < 1 || r.MaxLength < r.MinLength {
+		errs = append(errs, fmt.Errorf("the length must be between a minimum of at least 1 and a maximum of at least the minimum, got %d and %d",
+			r.MinLength, r.MaxLength))
+	}
+	var pattern *regexp.Regexp
+	if r.Pattern != "" {
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			errs = append(errs, fmt.Errorf("invalid pattern: %w", err))
+		} else {
+			pattern = regexp.MustCompile(`^(?:` + r.Pattern + `)$`)
+		}
+	}
+	var normalise func(string) string
+	if r.Canonical {
+		normalise = business.CanonicalCouponCode
+	}
+	switch r.Case {
+	case CaseKeep:
+	case CaseUpper:
+		if !r.Canonical {
+			normalise = strings.ToUpper
+		}
+	case CaseLower:
+		if !r.Canonical {
+			normalise = strings.ToLower
+		}
+	default:
+		errs = append(errs, fmt.Errorf("the case must be upper, lower or empty, got %q", r.Case))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return func(line string) (string, bool) {
+		code := strings.TrimSpace(line)
+		if r.Canonical {
+			// the separators do not count in the length of the code
+			code = normalise(code)
+		}
+		// the byte length bounds the number of characters, which skips counting them for most of the lines
+		if len(code) < r.MinLength || len(code) > r.MaxLength*utf8.UTFMax {
+			return "", false
+		}
+		if n := utf8.RuneCountInString(code); n < r.MinLength || n > r.MaxLength {
+			return "", false
+		}
+		if normalise != nil && !r.Canonical {
+			code = normalise(code)
+		}
+		if pattern != nil && !pattern.MatchString(code) {
+			return "", false
+		}
+		return code, true
+	}, nil
+}
@@ -0,0 +1,141 @@
+package coupon_test
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/coupon"
+)
+
+// ruleBases are the fixture coupon bases of the rules, with the same codes in different cases.
+var ruleBases = []string{"testdata/rules/couponbase1", "testdata/rules/couponbase2", "testdata/rules/couponbase3"}
+
+func TestRules(t *testing.T) {
+	testCases := []struct {
+		name     string
+		rules    coupon.Rules
+		expected string
+	}{
+		{
+			name:     "default rules",
+			rules:    coupon.DefaultRules(),
+			expected: "FIFTY-OFF\n",
+		},
+		{
+			name:     "upper case",
+			rules:    coupon.Rules{MinLength: 8, MaxLength: 10, Case: coupon.CaseUpper, MinFiles: 2},
+			expected: "FIFTY-OFF\nHAPPYHRS\nSUPER100\nSÜPERDEAL\n",
+		},
+		{
+			name:     "lower case",
+			rules:    coupon.Rules{MinLength: 8, MaxLength: 10, Case: coupon.CaseLower, MinFiles: 2},
+			expected: "fifty-off\nhappyhrs\nsuper100\nsüperdeal\n",
+		},
+		{
+			name:     "pattern",
+			rules:    coupon.Rules{MinLength: 8, MaxLength: 10, Pattern: "[A-Z0-9]+", Case: coupon.CaseUpper, MinFiles: 2},
+			expected: "HAPPYHRS\nSUPER100\n",
+		},
+		{
+			name:     "pattern matches the whole code",
+			rules:    coupon.Rules{MinLength: 8, MaxLength: 10, Pattern: "[A-Z]+|[0-9]+", Case: coupon.CaseUpper, MinFiles: 2},
+			expected: "HAPPYHRS\n",
+		},
+		{
+			name:     "in every file",
+			rules:    coupon.Rules{MinLength: 8, MaxLength: 10, Case: coupon.CaseUpper, MinFiles: 3},
+			expected: "FIFTY-OFF\nSUPER100\nSÜPERDEAL\n",
+		},
+		{
+			name:     "in any file",
+			rules:    coupon.Rules{MinLength: 3, MaxLength: 3, MinFiles: 1},
+			expected: "ABC\n",
+		},
+		{
+			name:     "length in characters",
+			rules:    coupon.Rules{MinLength: 9, MaxLength: 9, Case: coupon.CaseUpper, MinFiles: 2},
+			expected: "FIFTY-OFF\nSÜPERDEAL\n",
+		},
+		{
+			name:     "trimmed",
+			rules:    coupon.Rules{MinLength: 8, MaxLength: 8, Case: coupon.CaseLower, MinFiles: 1},
+			expected: "birthday\nhappyhrs\nsuper100\n",
+		},
+		{
+			name:     "canonical",
+			rules:    coupon.Rules{MinLength: 8, MaxLength: 10, Case: coupon.CaseLower, MinFiles: 2, Canonical: true},
+			expected: "FIFTYOFF\nHAPPYHRS\nSUPER100\nSÜPERDEAL\n",
+		},
+		{
+			name:     "canonical length without separators",
+			rules:    coupon.Rules{MinLength: 9, MaxLength: 9, MinFiles: 2, Canonical: true},
+			expected: "SÜPERDEAL\n",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			out := &bytes.Buffer{}
+			count, err := coupon.Validate(context.Background(), ruleBases, test.rules, out, coupon.Options{})
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, out.String())
+			assert.Equal(t, bytes.Count(out.Bytes(), []byte("\n")), count)
+
+			out.Reset()
+			_, err = coupon.ValidateExternal(context.Background(), ruleBases, test.rules, out, coupon.ExternalOptions{TempDir: t.TempDir()})
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, out.String())
+		})
+	}
+}
+
+func TestRules_invalid(t *testing.T) {
+	testCases := []struct {
+		name        string
+		paths       []string
+		rules       coupon.Rules
+		expectedErr string
+	}{
+		{
+			name:        "too many files",
+			paths:       slices.Repeat(ruleBases[:1], coupon.MaxFiles+1),
+			rules:       coupon.DefaultRules(),
+			expectedErr: "between 1 and 64 coupon bases are required, got 65",
+		},
+		{
+			name:  "lengths",
+			paths: ruleBases,
+			rules: coupon.Rules{MinLength: 10, MaxLength: 8, MinFiles: 2},
+			expectedErr: "the length must be between a minimum of at least 1 and a maximum of at least the minimum, " +
+				"got 10 and 8",
+		},
+		{
+			name:        "pattern",
+			paths:       ruleBases,
+			rules:       coupon.Rules{MinLength: 8, MaxLength: 10, Pattern: "[A-Z", MinFiles: 2},
+			expectedErr: "invalid pattern: error parsing regexp: missing closing ]: `[A-Z`",
+		},
+		{
+			name:  "case and minimum files",
+			paths: ruleBases,
+			rules: coupon.Rules{MinLength: 8, MaxLength: 10, Case: "title", MinFiles: 0},
+			expectedErr: "the minimum number of files must be between 1 and 3, got 0\n" +
+				`the case must be upper, lower or empty, got "title"`,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := coupon.Validate(context.Background(), test.paths, test.rules, &bytes.Buffer{}, coupon.Options{})
+			require.EqualError(t, err, test.expectedErr)
+			_, err = coupon.ValidateExternal(context.Background(), test.paths, test.rules, &bytes.Buffer{}, coupon.ExternalOptions{})
+			require.EqualError(t, err, test.expectedErr)
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package coupon
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/business"
+)
+
+// Removal is what Sync does with the coupons that are no longer valid.
+type Removal string
+
+const (
+	// RemoveNone keeps them valid.
+	RemoveNone Removal = ""
+	// RemoveDeactivate deactivates them, so they can be reactivated by a later sync.
+	RemoveDeactivate Removal = "deactivate"
+	// RemoveDelete deletes them, and the coupons deactivated before too.
+	RemoveDelete Removal = "delete"
+)
+
+// SyncDB is the interface for the database layer that is required by Sync.
+type SyncDB interface {
+	EachCoupon(ctx context.Context, fn func(mongo.Coupon) error) error
+	UpsertCoupons(ctx context.Context, codes []string) (inserted, reactivated int, err error)
+	DeactivateCoupons(ctx context.Context, codes []string, at time.Time) (int, error)
+	DeleteCoupons(ctx context.Context, codes []string) (int, error)
+}
+
+// SyncOptions are the options of Sync.
+// BatchSize is the number of coupons written at once, DefaultBatchSize if 0. Remove is what is done with the coupons
+// that are not in the valid coupons. If DryRun is set, nothing is written to the database. Every change is written
+// to Diff, if not nil, as a line "+CODE" for a coupon that becomes valid and "-CODE" for one that is removed.
+type SyncOptions struct {
+	BatchSize int
+	Remove    Removal
+	DryRun    bool
+	Diff      io.Writer
+}
+
+// SyncResult counts the changes of Sync. In a dry run, they are the changes that would be made.
+type SyncResult struct {
+	Inserted    int
+	Reactivated int
+	Removed     int
+	Unchanged   int
+}
+
+// ErrUnsorted is returned by Sync when the valid coupons are not sorted.
+var ErrUnsorted = errors.New("the valid coupons are not sorted")
+
+// Sync makes the coupons of db the valid coupon codes read from r, one per line and sorted, as Validate writes them.
+// The codes are saved in their canonical form, see business.CanonicalCouponCode, and must be sorted in that form,
+// which they are if the codes are upper case without separators or Validate wrote them with Rules.Canonical. The blank
+// lines and the repeated codes are skipped. It can be run again: the codes that are already valid are left as they
+// are, and so are the coupons generated by Generate.
+//
+// The codes of r and the coupons of db, sorted by code, are read side by side, so neither is held in memory.
+// Codes that are not sorted stop the sync with ErrUnsorted, once the batches before them are written; a dry run
+// finds them first.
+func Sync(ctx context.Context, db SyncDB, r io.Reader, opts SyncOptions) (SyncResult, error) {
+	if opts.BatchSize < 1 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	switch opts.Remove {
+	case RemoveNone, RemoveDeactivate, RemoveDelete:
+	default:
+		return SyncResult{}, fmt.Errorf("the removal must be deactivate, delete or empty, got %q", opts.Remove)
+	}
+
+	s := &syncer{db: db, opts: opts, codes: newCodeReader(r), now: time.Now()}
+	if opts.Diff != nil {
+		s.diffWriter = bufio.NewWriter(opts.Diff)
+	}
+	result, err := s.sync(ctx)
+	if s.diffWriter != nil {
+		if flushErr := s.diffWriter.Flush(); err == nil && flushErr != nil {
+			return result, fmt.Errorf("failed to write diff: %w", flushErr)
+		}
+	}
+	return result, err
+}
+
+func (s *syncer) sync(ctx context.Context) (SyncResult, error) {
+	err := s.db.EachCoupon(ctx, func(coupon mongo.Coupon) error {
+		// the codes before the coupon are not in db
+		for {
+			code, ok, err := s.codes.peek()
+			if err != nil {
+				return err
+			}
+			if !ok || code >= coupon.Code {
+				break
+			}
+			if err := s.upsert(ctx, code, false); err != nil {
+				return err
+			}
+			s.codes.next()
+		}
+
+		code, ok, _ := s.codes.peek()
+		if ok && code == coupon.Code {
+			s.codes.next()
+			if coupon.DeactivatedAt != nil {
+				return s.upsert(ctx, code, true)
+			}
+			s.result.Unchanged++
+			return nil
+		}
+		if coupon.Generation != nil || coupon.DeactivatedAt != nil && s.opts.Remove != RemoveDelete {
+			return nil
+		}
+		return s.remove(ctx, coupon)
+	})
+	if err != nil {
+		return s.result, err
+	}
+
+	for {
+		code, ok, err := s.codes.peek()
+		if err != nil {
+			return s.result, err
+		}
+		if !ok {
+			break
+		}
+		if err := s.upsert(ctx, code, false); err != nil {
+			return s.result, err
+		}
+		s.codes.next()
+	}
+	return s.result, s.flush(ctx)
+}
+
+// syncer batches the changes of Sync.
+type syncer struct {
+	db    SyncDB
+	opts  SyncOptions
+	codes *codeReader
+	// diffWriter buffers the lines written to opts.Diff, nil if there is no diff
+	diffWriter *bufio.Writer
+	now        time.Time
+	result     SyncResult
+
+	upserts  []string
+	removals []string
+	// counts of the batched changes, added to the result once written
+	inserted, reactivated int
+}
+
+func (s *syncer) upsert(ctx context.Context, code string, reactivated bool) error {
+	if err := s.diff("+", code); err != nil {
+		return err
+	}
+	if reactivated {
+		s.reactivated++
+	} else {
+		s.inserted++
+	}
+	s.upserts = append(s.upserts, code)
+	if len(s.upserts) >= s.opts.BatchSize {
+		return s.flushUpserts(ctx)
+	}
+	return nil
+}
+
+func (s *syncer) remove(ctx context.Context, coupon mongo.Coupon) error {
+	if s.opts.Remove == RemoveNone {
+		s.result.Unchanged++
+		return nil
+	}
+	if coupon.DeactivatedAt == nil {
+		if err := s.diff("-", coupon.Code); err != nil {
+			return err
+		}
+		s.result.Removed++
+	}
+	s.removals = append(s.removals, coupon.Code)
+	if len(s.removals) >= s.opts.BatchSize {
+		return s.flushRemovals(ctx)
+	}
+	return nil
+}
+
+func (s *syncer) diff(change, code string) error {
+	if s.diffWriter == nil {
+		return nil
+	}
+	if _, err := s.diffWriter.WriteString(change + code + "\n"); err != nil {
+		return fmt.Errorf("failed to write diff: %w", err)
+	}
+	return nil
+}
+
+func (s *syncer) flush(ctx context.Context) error {
+	if err := s.flushUpserts(ctx); err != nil {
+		return err
+	}
+	return s.flushRemovals(ctx)
+}
+
+func (s *syncer) flushUpserts(ctx context.Context) error {
+	if len(s.upserts) == 0 {
+		return nil
+	}
+	if !s.opts.DryRun {
+		if _, _, err := s.db.UpsertCoupons(ctx, s.upserts); err != nil {
+			return fmt.Errorf("failed to upsert coupons after %d: %w", s.result.Inserted+s.result.Reactivated, err)
+		}
+	}
+	s.result.Inserted += s.inserted
+	s.result.Reactivated += s.reactivated
+	s.inserted, s.reactivated = 0, 0
+	s.upserts = s.upserts[:0]
+	return nil
+}
+
+func (s *syncer) flushRemovals(ctx context.Context) error {
+	if len(s.removals) == 0 {
+		return nil
+	}
+	if !s.opts.DryRun {
+		var err error
+		if s.opts.Remove == RemoveDelete {
+			_, err = s.db.DeleteCoupons(ctx, s.removals)
+		} else {
+			_, err = s.db.DeactivateCoupons(ctx, s.removals, s.now)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to remove coupons: %w", err)
+		}
+	}
+	s.removals = s.removals[:0]
+	return nil
+}
+
+// codeReader reads codes one per line, sorted in their canonical form, and returns them in that form, skipping the
+// blank lines and the repeated codes.
+type codeReader struct {
+	scanner *bufio.Scanner
+	code    string
+	ok      bool
+	err     error
+	read    bool
+	last    string
+	line    int
+}
+
+func newCodeReader(r io.Reader) *codeReader {
+	return &codeReader{scanner: bufio.NewScanner(r)}
+}
+
+// peek returns the current code, and false at the end of the codes.
+func (c *codeReader) peek() (string, bool, error) {
+	if c.read {
+		return c.code, c.ok, c.err
+	}
+	c.read = true
+	for c.scanner.Scan() {
+		c.line++
+		code := business.CanonicalCouponCode(c.scanner.Text())
+		if code == "" || code == c.last {
+			continue
+		}
+		if c.last != "" && code < c.last {
+			c.err = fmt.Errorf("%w: %q on line %d is before %q", ErrUnsorted, code, c.line, c.last)
+			return "", false, c.err
+		}
+		c.code, c.ok, c.last = code, true, code
+		return c.code, true, nil
+	}
+	if err := c.scanner.Err(); err != nil {
+		c.err = fmt.Errorf("failed to read coupons: %w", err)
+	}
+	c.code, c.ok = "", false
+	return "", false, c.err
+}
+
+// next moves past the current code.
+func (c *codeReader) next() {
+	c.read = false
+}
@@ -0,0 +1,236 @@
+package coupon_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/coupon"
+)
+
+func TestSync(t *testing.T) {
+	deactivatedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name           string
+		coupons        []mongo.Coupon
+		input          string
+		opts           coupon.SyncOptions
+		expected       []mongo.Coupon
+		expectedResult coupon.SyncResult
+		expectedDiff   string
+		expectedErr    string
+	}{
+		{
+			name:           "empty collection",
+			input:          "BIRTHDAY\nFIFTYOFF\nHAPPYHRS\n",
+			expected:       []mongo.Coupon{{Code: "BIRTHDAY"}, {Code: "FIFTYOFF"}, {Code: "HAPPYHRS"}},
+			expectedResult: coupon.SyncResult{Inserted: 3},
+			expectedDiff:   "+BIRTHDAY\n+FIFTYOFF\n+HAPPYHRS\n",
+		},
+		{
+			name:           "already synced",
+			coupons:        []mongo.Coupon{{Code: "BIRTHDAY"}, {Code: "FIFTYOFF"}},
+			input:          "BIRTHDAY\nFIFTYOFF\n",
+			expected:       []mongo.Coupon{{Code: "BIRTHDAY"}, {Code: "FIFTYOFF"}},
+			expectedResult: coupon.SyncResult{Unchanged: 2},
+		},
+		{
+			name:           "removed coupons are kept",
+			coupons:        []mongo.Coupon{{Code: "BIRTHDAY"}, {Code: "FIFTYOFF"}},
+			input:          "FIFTYOFF\nHAPPYHRS\n",
+			expected:       []mongo.Coupon{{Code: "BIRTHDAY"}, {Code: "FIFTYOFF"}, {Code: "HAPPYHRS"}},
+			expectedResult: coupon.SyncResult{Inserted: 1, Unchanged: 2},
+			expectedDiff:   "+HAPPYHRS\n",
+		},
+		{
+			name:    "deactivate removed coupons",
+			coupons: []mongo.Coupon{{Code: "BIRTHDAY"}, {Code: "FIFTYOFF"}, {Code: "ZEROFEES"}},
+			input:   "FIFTYOFF\nHAPPYHRS\n",
+			opts:    coupon.SyncOptions{Remove: coupon.RemoveDeactivate},
+			expected: []mongo.Coupon{
+				{Code: "BIRTHDAY", DeactivatedAt: &deactivatedAt},
+				{Code: "FIFTYOFF"},
+				{Code: "HAPPYHRS"},
+				{Code: "ZEROFEES", DeactivatedAt: &deactivatedAt},
+			},
+			expectedResult: coupon.SyncResult{Inserted: 1, Removed: 2, Unchanged: 1},
+			expectedDiff:   "-BIRTHDAY\n+HAPPYHRS\n-ZEROFEES\n",
+		},
+		{
+			name:           "reactivate",
+			coupons:        []mongo.Coupon{{Code: "BIRTHDAY", DeactivatedAt: &deactivatedAt}, {Code: "FIFTYOFF", DeactivatedAt: &deactivatedAt}},
+			input:          "BIRTHDAY\n",
+			opts:           coupon.SyncOptions{Remove: coupon.RemoveDeactivate},
+			expected:       []mongo.Coupon{{Code: "BIRTHDAY"}, {Code: "FIFTYOFF", DeactivatedAt: &deactivatedAt}},
+			expectedResult: coupon.SyncResult{Reactivated: 1},
+			expectedDiff:   "+BIRTHDAY\n",
+		},
+		{
+			name:           "delete removed and deactivated coupons",
+			coupons:        []mongo.Coupon{{Code: "BIRTHDAY"}, {Code: "FIFTYOFF"}, {Code: "HAPPYHRS", DeactivatedAt: &deactivatedAt}},
+			input:          "FIFTYOFF\n",
+			opts:           coupon.SyncOptions{Remove: coupon.RemoveDelete},
+			expected:       []mongo.Coupon{{Code: "FIFTYOFF"}},
+			expectedResult: coupon.SyncResult{Removed: 1, Unchanged: 1},
+			expectedDiff:   "-BIRTHDAY\n",
+		},
+		{
+			name:           "generated coupons are kept",
+			coupons:        []mongo.Coupon{{Code: "BIRTHDAY"}, {Code: "SUMMERK7MQ2XPAF", Generation: &mongo.CouponGeneration{Batch: "1"}}},
+			input:          "FIFTYOFF\n",
+			opts:           coupon.SyncOptions{Remove: coupon.RemoveDelete},
+			expected:       []mongo.Coupon{{Code: "FIFTYOFF"}, {Code: "SUMMERK7MQ2XPAF", Generation: &mongo.CouponGeneration{Batch: "1"}}},
+			expectedResult: coupon.SyncResult{Inserted: 1, Removed: 1},
+			expectedDiff:   "-BIRTHDAY\n+FIFTYOFF\n",
+		},
+		{
+			name:           "dry run",
+			coupons:        []mongo.Coupon{{Code: "BIRTHDAY"}, {Code: "FIFTYOFF", DeactivatedAt: &deactivatedAt}},
+			input:          "FIFTYOFF\nHAPPYHRS\n",
+			opts:           coupon.SyncOptions{Remove: coupon.RemoveDelete, DryRun: true},
+			expected:       []mongo.Coupon{{Code: "BIRTHDAY"}, {Code: "FIFTYOFF", DeactivatedAt: &deactivatedAt}},
+			expectedResult: coupon.SyncResult{Inserted: 1, Reactivated: 1, Removed: 1},
+			expectedDiff:   "-BIRTHDAY\n+FIFTYOFF\n+HAPPYHRS\n",
+		},
+		{
+			name:           "blank lines and repeated codes",
+			input:          "\nBIRTHDAY\n  BIRTHDAY  \n\nFIFTYOFF\n",
+			expected:       []mongo.Coupon{{Code: "BIRTHDAY"}, {Code: "FIFTYOFF"}},
+			expectedResult: coupon.SyncResult{Inserted: 2},
+			expectedDiff:   "+BIRTHDAY\n+FIFTYOFF\n",
+		},
+		{
+			name:           "canonical form",
+			input:          "birthday\nFIFTY-OFF\n fifty_off\nHAPPY HRS\n",
+			expected:       []mongo.Coupon{{Code: "BIRTHDAY"}, {Code: "FIFTYOFF"}, {Code: "HAPPYHRS"}},
+			expectedResult: coupon.SyncResult{Inserted: 3},
+			expectedDiff:   "+BIRTHDAY\n+FIFTYOFF\n+HAPPYHRS\n",
+		},
+		{
+			name:        "unsorted",
+			coupons:     []mongo.Coupon{{Code: "BIRTHDAY"}},
+			input:       "FIFTYOFF\nBIRTHDAY\n",
+			opts:        coupon.SyncOptions{DryRun: true},
+			expected:    []mongo.Coupon{{Code: "BIRTHDAY"}},
+			expectedErr: `the valid coupons are not sorted: "BIRTHDAY" on line 2 is before "FIFTYOFF"`,
+		},
+		{
+			name:        "invalid removal",
+			input:       "BIRTHDAY\n",
+			opts:        coupon.SyncOptions{Remove: "archive"},
+			expectedErr: `the removal must be deactivate, delete or empty, got "archive"`,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			db := &mockSyncDB{coupons: slices.Clone(test.coupons), now: deactivatedAt}
+			diff := &bytes.Buffer{}
+			test.opts.Diff = diff
+			result, err := coupon.Sync(context.Background(), db, strings.NewReader(test.input), test.opts)
+			if test.expectedErr != "" {
+				require.EqualError(t, err, test.expectedErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, test.expectedResult, result)
+				assert.Equal(t, test.expectedDiff, diff.String())
+			}
+			assert.Equal(t, test.expected, db.coupons)
+		})
+	}
+}
+
+func TestSync_batches(t *testing.T) {
+	db := &mockSyncDB{coupons: []mongo.Coupon{{Code: "A"}, {Code: "C"}, {Code: "E"}}}
+	result, err := coupon.Sync(context.Background(), db, strings.NewReader("B\nD\nF\nG\nH\n"),
+		coupon.SyncOptions{BatchSize: 2, Remove: coupon.RemoveDelete})
+	require.NoError(t, err)
+	assert.Equal(t, coupon.SyncResult{Inserted: 5, Removed: 3}, result)
+	assert.Equal(t, [][]string{{"B", "D"}, {"F", "G"}, {"H"}}, db.upserts)
+	assert.Equal(t, [][]string{{"A", "C"}, {"E"}}, db.deletes)
+}
+
+func TestSync_error(t *testing.T) {
+	db := &mockSyncDB{coupons: []mongo.Coupon{{Code: "A"}}, err: errors.New("connection refused")}
+	result, err := coupon.Sync(context.Background(), db, strings.NewReader("B\nC\nD\n"), coupon.SyncOptions{BatchSize: 2})
+	require.EqualError(t, err, "failed to upsert coupons after 0: connection refused")
+	assert.Equal(t, coupon.SyncResult{Unchanged: 1}, result)
+}
+
+// mockSyncDB keeps the coupons sorted by code, like the collection is read.
+type mockSyncDB struct {
+	coupons []mongo.Coupon
+	now     time.Time
+	err     error
+	upserts [][]string
+	deletes [][]string
+}
+
+func (m *mockSyncDB) EachCoupon(ctx context.Context, fn func(mongo.Coupon) error) error {
+	// the changes made while iterating are not seen, like with a cursor that already passed them
+	for _, c := range slices.Clone(m.coupons) {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockSyncDB) UpsertCoupons(_ context.Context, codes []string) (int, int, error) {
+	if m.err != nil {
+		return 0, 0, m.err
+	}
+	m.upserts = append(m.upserts, slices.Clone(codes))
+	inserted, reactivated := 0, 0
+	for _, code := range codes {
+		i, found := m.find(code)
+		switch {
+		case !found:
+			m.coupons = slices.Insert(m.coupons, i, mongo.Coupon{Code: code})
+			inserted++
+		case m.coupons[i].DeactivatedAt != nil:
+			m.coupons[i].DeactivatedAt = nil
+			reactivated++
+		}
+	}
+	return inserted, reactivated, nil
+}
+
+func (m *mockSyncDB) DeactivateCoupons(_ context.Context, codes []string, _ time.Time) (int, error) {
+	n := 0
+	for _, code := range codes {
+		if i, found := m.find(code); found && m.coupons[i].DeactivatedAt == nil {
+			at := m.now
+			m.coupons[i].DeactivatedAt = &at
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *mockSyncDB) DeleteCoupons(_ context.Context, codes []string) (int, error) {
+	m.deletes = append(m.deletes, slices.Clone(codes))
+	n := 0
+	for _, code := range codes {
+		if i, found := m.find(code); found {
+			m.coupons = slices.Delete(m.coupons, i, i+1)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *mockSyncDB) find(code string) (int, bool) {
+	return slices.BinarySearchFunc(m.coupons, code, func(c mongo.Coupon, code string) int {
+		return strings.Compare(c.Code, code)
+	})
+}
@@ -0,0 +1,200 @@
+package coupon
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"log/slog"
+	"math/bits"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// shardBatchSize is the number of codes a reader sends to a shard at once, to keep the channel overhead low.
+const shardBatchSize = 4096
+
+// Options are the options of Validate.
+type Options struct {
+	// Shards is the number of maps the codes are partitioned into, each filled by its own goroutine. GOMAXPROCS if 0.
+	Shards int
+	// ProgressInterval is how often the progress is logged. DefaultProgressInterval if 0.
+	ProgressInterval time.Duration
+	Inputs
+}
+
+// shardBatch is a batch of codes of one coupon base sent to a shard.
+type shardBatch struct {
+	bit   uint64
+	codes []string
+}
+
+// Validate reads the coupon bases at paths and writes the codes valid according to rules to w, one per line and
+// sorted. It returns the number of valid codes.
+//
+// Every code of the right length is kept in memory with the set of the bases it appears in. The bases are read
+// concurrently, and the codes are partitioned by hash into opts.Shards maps, each owned by one goroutine, so that no
+// map is shared. Nothing is written to w if ctx is canceled.
+func Validate(ctx context.Context, paths []string, rules Rules, w io.Writer, opts Options) (int, error) {
+	codeOf, err := rules.compile(len(paths))
+	if err != nil {
+		return 0, err
+	}
+	if opts.Shards == 0 {
+		opts.Shards = runtime.GOMAXPROCS(0)
+	}
+	if opts.ProgressInterval == 0 {
+		opts.ProgressInterval = DefaultProgressInterval
+	}
+	if opts.Shards < 0 || opts.ProgressInterval < 0 {
+		return 0, fmt.Errorf("invalid number of shards %d or progress interval %s", opts.Shards, opts.ProgressInterval)
+	}
+
+	p, err := newProgress(paths)
+	if err != nil {
+		return 0, err
+	}
+	reportCtx, stopReport := context.WithCancel(ctx)
+	defer stopReport()
+	go p.report(reportCtx, opts.ProgressInterval)
+
+	shards := make([]map[string]uint64, opts.Shards)
+	inputs := make([]chan shardBatch, opts.Shards)
+	var wg sync.WaitGroup
+	for i := range shards {
+		shards[i] = map[string]uint64{}
+		inputs[i] = make(chan shardBatch, 4)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// a shard drains its input even once the readers failed, so that they never block
+			for batch := range inputs[i] {
+				for _, code := range batch.codes {
+					shards[i][code] |= batch.bit
+				}
+			}
+		}()
+	}
+
+	seed := maphash.MakeSeed()
+	readers, readCtx := errgroup.WithContext(ctx)
+	for i, path := range paths {
+		readers.Go(func() error {
+			slog.Info("Reading coupon base", "path", path)
+			bit := uint64(1) << i
+			pending := make([][]string, len(shards))
+			send := func(shard int) error {
+				select {
+				case inputs[shard] <- shardBatch{bit: bit, codes: pending[shard]}:
+					pending[shard] = nil
+					return nil
+				case <-readCtx.Done():
+					return readCtx.Err()
+				}
+			}
+
+			err := scanCodes(readCtx, opts.Inputs, path, p, codeOf, func(code string) error {
+				shard := int(maphash.String(seed, code) % uint64(len(shards)))
+				if pending[shard] == nil {
+					pending[shard] = make([]string, 0, shardBatchSize)
+				}
+				pending[shard] = append(pending[shard], code)
+				if len(pending[shard]) == shardBatchSize {
+					return send(shard)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for shard := range pending {
+				if len(pending[shard]) > 0 {
+					if err := send(shard); err != nil {
+						return err
+					}
+				}
+			}
+			slog.Info("Coupon base read", "path", path)
+			return nil
+		})
+	}
+	err = readers.Wait()
+	for _, input := range inputs {
+		close(input)
+	}
+	wg.Wait()
+	if err != nil {
+		return 0, err
+	}
+	stopReport()
+
+	var valid []string
+	codes := 0
+	for _, shard := range shards {
+		codes += len(shard)
+		for code, files := range shard {
+			if bits.OnesCount64(files) >= rules.MinFiles {
+				valid = append(valid, code)
+			}
+		}
+	}
+	slices.Sort(valid)
+	slog.Info("Coupon bases read", "codes", codes, "valid", len(valid), "duration", time.Since(p.start).Round(time.Millisecond).String())
+
+	bw := bufio.NewWriter(w)
+	for _, code := range valid {
+		if _, err := bw.WriteString(code + "\n"); err != nil {
+			return 0, fmt.Errorf("failed to write valid coupons: %w", err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to write valid coupons: %w", err)
+	}
+	return len(valid), nil
+}
+
+// scanCodes calls fn with the code of every line of the coupon base at path that codeOf accepts, in the order of the
+// coupon base, and counts the lines and bytes read in p. The checksum of the coupon base is checked once it is read.
+func scanCodes(ctx context.Context, in Inputs, path string, p *progress, codeOf codeFunc, fn func(code string) error) error {
+	base, err := in.open(ctx, path, p)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = base.Close()
+	}()
+
+	scanner := bufio.NewScanner(base)
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, 1024*1024)
+
+	lines, reported := int64(0), int64(0)
+	defer func() {
+		p.lines.Add(lines - reported)
+	}()
+	for ; scanner.Scan(); lines++ {
+		// checking the context and counting the lines on every line would slow the scan down
+		if lines%100_000 == 0 {
+			p.lines.Add(lines - reported)
+			reported = lines
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+		}
+		if code, ok := codeOf(scanner.Text()); ok {
+			if err := fn(code); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error scanning %s: %w", path, err)
+	}
+	return base.verify()
+}
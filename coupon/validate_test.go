@@ -0,0 +1,136 @@
+package coupon_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/coupon"
+)
+
+// writeFiles writes the files with the contents in a temporary directory and returns their paths.
+func writeFiles(t *testing.T, contents ...string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	paths := make([]string, 0, len(contents))
+	for i, content := range contents {
+		path := filepath.Join(dir, "couponbase"+string(rune('1'+i)))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// minFiles returns the default rules with the minimum number of files n.
+func minFiles(n int) coupon.Rules {
+	rules := coupon.DefaultRules()
+	rules.MinFiles = n
+	return rules
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name          string
+		files         []string
+		minFiles      int
+		expected      string
+		expectedCount int
+		opts          coupon.Options
+		expectedErr   string
+	}{
+		{
+			name: "in at least 2 files",
+			files: []string{
+				"HAPPYHRS\nFIFTYOFF\nSHORT\nONLYINONE\n",
+				"FIFTYOFF\n  HAPPYHRS  \nSHORT\nTOOLONGCODE1\n",
+				"BIRTHDAY\nTOOLONGCODE1\nFIFTYOFF\n",
+			},
+			minFiles:      2,
+			expected:      "FIFTYOFF\nHAPPYHRS\n",
+			expectedCount: 2,
+		},
+		{
+			name:          "in every file",
+			files:         []string{"HAPPYHRS\nFIFTYOFF\n", "FIFTYOFF\nHAPPYHRS\n", "FIFTYOFF\n"},
+			minFiles:      3,
+			expected:      "FIFTYOFF\n",
+			expectedCount: 1,
+		},
+		{
+			name:          "repeated in one file",
+			files:         []string{"HAPPYHRS\nHAPPYHRS\n", "FIFTYOFF\n"},
+			minFiles:      2,
+			expected:      "",
+			expectedCount: 0,
+		},
+		{
+			name:        "minimum files out of range",
+			files:       []string{"HAPPYHRS\n", "HAPPYHRS\n"},
+			minFiles:    3,
+			expectedErr: "the minimum number of files must be between 1 and 2, got 3",
+		},
+		{
+			name:        "no files",
+			minFiles:    1,
+			expectedErr: "between 1 and 64 coupon bases are required, got 0",
+		},
+		{
+			name:        "negative shards",
+			files:       []string{"HAPPYHRS\n"},
+			minFiles:    1,
+			opts:        coupon.Options{Shards: -1},
+			expectedErr: "invalid number of shards -1 or progress interval 10s",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			out := &bytes.Buffer{}
+			count, err := coupon.Validate(context.Background(), writeFiles(t, test.files...), minFiles(test.minFiles), out, test.opts)
+			if test.expectedErr != "" {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, out.String())
+			assert.Equal(t, test.expectedCount, count)
+		})
+	}
+}
+
+func TestValidate_missingFile(t *testing.T) {
+	_, err := coupon.Validate(context.Background(), []string{filepath.Join(t.TempDir(), "missing")}, minFiles(1), &bytes.Buffer{}, coupon.Options{})
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestValidate_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := coupon.Validate(ctx, writeFiles(t, "HAPPYHRS\n"), minFiles(1), &bytes.Buffer{}, coupon.Options{})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestValidate_shards(t *testing.T) {
+	paths := writeFiles(t, randomBases(4, 5000)...)
+	expected := &bytes.Buffer{}
+	expectedCount, err := coupon.Validate(context.Background(), paths, minFiles(2), expected, coupon.Options{Shards: 1})
+	require.NoError(t, err)
+	require.NotZero(t, expectedCount)
+
+	for _, shards := range []int{2, 3, 16} {
+		t.Run(fmt.Sprint(shards), func(t *testing.T) {
+			out := &bytes.Buffer{}
+			count, err := coupon.Validate(context.Background(), paths, minFiles(2), out, coupon.Options{Shards: shards, ProgressInterval: time.Millisecond})
+			require.NoError(t, err)
+			assert.Equal(t, expected.String(), out.String())
+			assert.Equal(t, expectedCount, count)
+		})
+	}
+}
@@ -1,7 +1,11 @@
-// Package error provides sentinel errors for the application.
+// Package error provides sentinel errors for the application, and the Error type that adds the details reported to
+// the client.
 package error
 
-import "errors"
+import (
+	"errors"
+	"strings"
+)
 
 var (
 	// ErrNotFound is returned when the requested resource is not found.
@@ -10,4 +14,94 @@ var (
 	ErrBadRequest = errors.New("bad request")
 	// ErrUnprocessableEntity is returned when the request is formed correctly but not valid.
 	ErrUnprocessableEntity = errors.New("unprocessable entity")
+	// ErrUnauthorized is returned when the request is not authenticated.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrTooLarge is returned when the request body is larger than allowed.
+	ErrTooLarge = errors.New("request too large")
+	// ErrTooManyRequests is returned when the client exceeded its rate limit.
+	ErrTooManyRequests = errors.New("too many requests")
+)
+
+// Machine-readable error codes reported to the client.
+const (
+	CodeNotFound              = "not_found"
+	CodeBadRequest            = "bad_request"
+	CodeUnprocessableEntity   = "unprocessable_entity"
+	CodeUnauthorized          = "unauthorized"
+	CodeTooLarge              = "request_too_large"
+	CodeTooManyRequests       = "too_many_requests"
+	CodeInternal              = "internal_error"
+	CodeRouteNotFound         = "route_not_found"
+	CodeInvalidBody           = "invalid_body"
+	CodeInvalidRequest        = "invalid_request"
+	CodeValidationFailed      = "validation_failed"
+	CodeRequired              = "required"
+	CodeInvalidProductID      = "invalid_product_id"
+	CodeProductNotFound       = "product_not_found"
+	CodeInvalidQuantity       = "invalid_quantity"
+	CodeDuplicateItem         = "duplicate_item"
+	CodeCouponNotFound        = "coupon_not_found"
+	CodeTooManyCouponAttempts = "too_many_coupon_attempts"
+	CodeInvalidOrderID        = "invalid_order_id"
+	CodeOrderNotFound         = "order_not_found"
 )
+
+// Error is an application error with the details reported to the client.
+// It matches its sentinel error Kind with errors.Is, so callers can keep checking e.g. errors.Is(err, ErrNotFound).
+type Error struct {
+	// Kind is one of the sentinel errors of this package.
+	Kind error
+	// Code is the machine-readable error code.
+	Code string
+	// Detail is the human-readable explanation of this occurrence of the error.
+	Detail string
+	// Extensions are additional members of the error response, e.g. missingProductIds.
+	Extensions map[string]any
+	// Err is the underlying error, it is not reported to the client.
+	Err error
+}
+
+// New returns an error of kind with the code and detail.
+func New(kind error, code, detail string) *Error {
+	return &Error{Kind: kind, Code: code, Detail: detail}
+}
+
+// With adds the extension member key to e and returns e.
+func (e *Error) With(key string, value any) *Error {
+	if e.Extensions == nil {
+		e.Extensions = map[string]any{}
+	}
+	e.Extensions[key] = value
+	return e
+}
+
+// WithCause sets the underlying error of e and returns e.
+func (e *Error) WithCause(err error) *Error {
+	e.Err = err
+	return e
+}
+
+// Error returns the kind, the detail and the underlying error, e.g. "not found: product 1 not found: no documents".
+func (e *Error) Error() string {
+	parts := make([]string, 0, 3)
+	if e.Kind != nil {
+		parts = append(parts, e.Kind.Error())
+	}
+	if e.Detail != "" {
+		parts = append(parts, e.Detail)
+	}
+	if e.Err != nil {
+		parts = append(parts, e.Err.Error())
+	}
+	return strings.Join(parts, ": ")
+}
+
+// Is reports whether target is the kind of e.
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
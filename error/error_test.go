@@ -0,0 +1,31 @@
+package error_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	aperr "github.com/y7ls8i/kart/error"
+)
+
+func TestError(t *testing.T) {
+	cause := errors.New("no documents")
+	err := aperr.New(aperr.ErrNotFound, aperr.CodeProductNotFound, "product 1 not found").
+		With("productId", "1").
+		WithCause(cause)
+
+	assert.Equal(t, "not found: product 1 not found: no documents", err.Error())
+	assert.Equal(t, map[string]any{"productId": "1"}, err.Extensions)
+
+	wrapped := fmt.Errorf("failed to get product: %w", err)
+	assert.True(t, errors.Is(wrapped, aperr.ErrNotFound))
+	assert.True(t, errors.Is(wrapped, cause))
+	assert.False(t, errors.Is(wrapped, aperr.ErrBadRequest))
+
+	var apErr *aperr.Error
+	assert.True(t, errors.As(wrapped, &apErr))
+	assert.Equal(t, aperr.CodeProductNotFound, apErr.Code)
+
+	assert.Equal(t, "unprocessable entity", aperr.New(aperr.ErrUnprocessableEntity, "", "").Error())
+}
@@ -0,0 +1,79 @@
+// Package logger carries a request-scoped slog.Logger through context.Context so that every layer of a request
+// logs with the same request ID.
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/y7ls8i/kart/config"
+)
+
+// level is the level of the default logger installed by Setup. It can be changed at runtime with SetLevel.
+var level = new(slog.LevelVar)
+
+// Setup installs the default logger that writes to w in the format and at the level of conf.
+func Setup(w io.Writer, conf config.Log) error {
+	if err := SetLevel(conf.Level); err != nil {
+		return err
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch conf.Format {
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	case "", "text":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return fmt.Errorf("unknown log format %q", conf.Format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// SetLevel changes the level of the default logger installed by Setup.
+func SetLevel(name string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.ToUpper(name))); err != nil {
+		return fmt.Errorf("unknown log level %q", name)
+	}
+	level.Set(l)
+	return nil
+}
+
+type loggerKey struct{}
+
+type requestIDKey struct{}
+
+// NewContext returns a copy of ctx that carries the logger l.
+func NewContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or slog.Default() if ctx does not carry one.
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok && l != nil {
+			return l
+		}
+	}
+	return slog.Default()
+}
+
+// WithRequestID returns a copy of ctx that carries the request ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID carried by ctx, or an empty string if there is none.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
@@ -0,0 +1,60 @@
+package logger_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/config"
+	"github.com/y7ls8i/kart/logger"
+)
+
+func TestFromContext(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		assert.Equal(t, slog.Default(), logger.FromContext(context.Background()))
+	})
+
+	t.Run("request scoped", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		l := slog.New(slog.NewTextHandler(buf, nil)).With("requestId", "abc")
+
+		ctx := logger.NewContext(context.Background(), l)
+		logger.FromContext(ctx).Info("hello")
+
+		assert.Equal(t, l, logger.FromContext(ctx))
+		assert.Contains(t, buf.String(), "requestId=abc")
+		assert.Contains(t, buf.String(), "msg=hello")
+	})
+}
+
+func TestRequestID(t *testing.T) {
+	assert.Equal(t, "", logger.RequestID(context.Background()))
+
+	ctx := logger.WithRequestID(context.Background(), "abc")
+	assert.Equal(t, "abc", logger.RequestID(ctx))
+}
+
+func TestSetup(t *testing.T) {
+	defaultLogger := slog.Default()
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+	})
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, logger.Setup(buf, config.Log{Level: "warn", Format: "json"}))
+
+	slog.Info("hidden")
+	slog.Warn("shown")
+	require.NoError(t, logger.SetLevel("debug"))
+	slog.Debug("shown after reload")
+
+	assert.NotContains(t, buf.String(), "hidden")
+	assert.Contains(t, buf.String(), `"level":"WARN","msg":"shown"`)
+	assert.Contains(t, buf.String(), `"level":"DEBUG","msg":"shown after reload"`)
+
+	assert.EqualError(t, logger.SetLevel("verbose"), `unknown log level "verbose"`)
+	assert.EqualError(t, logger.Setup(buf, config.Log{Level: "info", Format: "xml"}), `unknown log format "xml"`)
+}
@@ -0,0 +1,95 @@
+// Package metrics defines the Prometheus metrics of the application and serves them in the Prometheus text format.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace is the prefix of all the application metrics.
+const Namespace = "kart"
+
+// Coupon rejection reasons used as the reason label of CouponRejections.
+const (
+	CouponRejectionNotFound  = "not_found"
+	CouponRejectionThrottled = "throttled"
+)
+
+var registry = prometheus.NewRegistry()
+
+var factory = promauto.With(registry)
+
+var (
+	// HTTPRequests counts the served HTTP requests by method, route and status.
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests served, by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration observes the latency of the served HTTP requests by method, route and status.
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests, by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// MongoOperationDuration observes the latency of the MongoDB adapter methods.
+	MongoOperationDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "mongo",
+		Name:      "operation_duration_seconds",
+		Help:      "Latency of MongoDB operations, by adapter method.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14), // 0.5ms to ~4s
+	}, []string{"operation"})
+
+	// OrdersCreated counts the orders created.
+	OrdersCreated = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "business",
+		Name:      "orders_created_total",
+		Help:      "Number of orders created.",
+	})
+
+	// CouponRejections counts the orders rejected because of the coupon, by reason.
+	CouponRejections = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "business",
+		Name:      "coupon_rejections_total",
+		Help:      "Number of orders rejected because of the coupon, by reason.",
+	}, []string{"reason"})
+
+	// ProductsMissing counts the orders rejected because some of the requested products do not exist.
+	ProductsMissing = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "business",
+		Name:      "products_missing_total",
+		Help:      "Number of orders rejected because some of the requested products do not exist.",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// ObserveMongo records the latency of a MongoDB operation that started at start.
+// It is meant to be deferred at the beginning of an adapter method.
+func ObserveMongo(operation string, start time.Time) {
+	MongoOperationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// Handler returns the HTTP handler that serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
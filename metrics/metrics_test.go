@@ -0,0 +1,30 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/metrics"
+)
+
+func TestHandler(t *testing.T) {
+	metrics.OrdersCreated.Inc()
+	metrics.CouponRejections.WithLabelValues(metrics.CouponRejectionNotFound).Inc()
+	metrics.ObserveMongo("FindOneCoupon", time.Now())
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, 200, w.Code)
+
+	body, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, string(body), "kart_business_orders_created_total ")
+	assert.Contains(t, string(body), `kart_business_coupon_rejections_total{reason="not_found"} `)
+	assert.Contains(t, string(body), `kart_mongo_operation_duration_seconds_count{operation="FindOneCoupon"} `)
+	assert.Contains(t, string(body), "go_goroutines ")
+}
@@ -0,0 +1,69 @@
+// Package coupon contains the coupon requests handler.
+package coupon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/y7ls8i/kart/business"
+	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/server/sverr"
+	"github.com/y7ls8i/kart/validation"
+)
+
+// Business is the interface for the business layer that is required by the coupon requests handler.
+type Business interface {
+	CheckCoupon(ctx context.Context, code string) (result *business.CouponCheck, err error)
+	PreviewCoupon(ctx context.Context, code string, req business.CouponPreviewRequest) (result *business.CouponPreview, err error)
+}
+
+// Coupon struct represents the coupon requests handler.
+type Coupon struct {
+	buss Business
+}
+
+// NewCoupon returns a new coupon requests handler.
+func NewCoupon(buss Business) *Coupon {
+	return &Coupon{buss: buss}
+}
+
+// Get returns whether a coupon code is valid. An invalid code is not an error.
+func (c *Coupon) Get(ctx *gin.Context) {
+	check, err := c.buss.CheckCoupon(ctx, ctx.Param("code"))
+	if err != nil {
+		sverr.Abort(ctx, err, "Error checking coupon")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, check)
+}
+
+// Preview returns the discount a coupon code would give on an order of the items of the request.
+func (c *Coupon) Preview(ctx *gin.Context) {
+	req := business.CouponPreviewRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			sverr.Abort(ctx, aperr.New(aperr.ErrTooLarge, aperr.CodeTooLarge,
+				fmt.Sprintf("request body larger than %d bytes", maxBytesErr.Limit)).With("limit", maxBytesErr.Limit), "")
+			return
+		}
+		violations := validation.FromJSON(err)
+		if violations == nil {
+			violations.Add("", validation.CodeInvalidJSON, "invalid request body")
+		}
+		sverr.Abort(ctx, violations.Problem(aperr.ErrBadRequest, aperr.CodeInvalidBody).WithCause(err), "")
+		return
+	}
+
+	preview, err := c.buss.PreviewCoupon(ctx, ctx.Param("code"), req)
+	if err != nil {
+		sverr.Abort(ctx, err, "Error previewing coupon")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, preview)
+}
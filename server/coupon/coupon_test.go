@@ -0,0 +1,177 @@
+// This is for testing the http handlers, by sending http requests to a router, like the order handler tests.
+package coupon_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/business"
+	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/server/coupon"
+	"github.com/y7ls8i/kart/server/sverr"
+	"github.com/y7ls8i/kart/validation"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestGetCoupon(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	testCases := []struct {
+		name           string
+		path           string
+		mock           *mockBusiness
+		expectedStatus int
+		expectedBody   string
+		expectedCode   string
+	}{
+		{
+			name:           "valid",
+			path:           "/api/coupon/HAPPYHRS",
+			mock:           &mockBusiness{checkResult: &business.CouponCheck{Code: "HAPPYHRS", Valid: true}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"code":"HAPPYHRS","valid":true}`,
+			expectedCode:   "HAPPYHRS",
+		},
+		{
+			name:           "invalid",
+			path:           "/api/coupon/NOPE",
+			mock:           &mockBusiness{checkResult: &business.CouponCheck{Code: "NOPE"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"code":"NOPE","valid":false}`,
+			expectedCode:   "NOPE",
+		},
+		{
+			name:           "internal error",
+			path:           "/api/coupon/HAPPYHRS",
+			mock:           &mockBusiness{checkErr: errors.New("internal error")},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody: `{"code":"internal_error","instance":"/api/coupon/HAPPYHRS","status":500,"title":"Internal Server Error",` +
+				`"type":"urn:kart:problem:internal_error"}`,
+			expectedCode: "HAPPYHRS",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			router := gin.Default()
+			handler := coupon.NewCoupon(test.mock)
+			router.GET("/api/coupon/:code", handler.Get)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+
+			require.Equal(t, test.expectedStatus, w.Code)
+			assert.Equal(t, test.expectedBody, w.Body.String())
+			if test.expectedStatus != http.StatusOK {
+				assert.Equal(t, sverr.ContentType, w.Header().Get("Content-Type"))
+			}
+			assert.Equal(t, test.expectedCode, test.mock.code)
+		})
+	}
+}
+
+func TestPreviewCoupon(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	productID := bson.NewObjectID()
+
+	testCases := []struct {
+		name           string
+		req            any
+		mock           *mockBusiness
+		expectedStatus int
+		expectedBody   string
+		expectedReq    business.CouponPreviewRequest
+	}{
+		{
+			name: "success",
+			req:  map[string]any{"items": []map[string]any{{"productId": productID.Hex(), "quantity": 2}}},
+			mock: &mockBusiness{previewResult: &business.CouponPreview{
+				CouponCheck: business.CouponCheck{Code: "HAPPYHRS", Valid: true},
+				Subtotal:    13,
+				Total:       13,
+			}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"code":"HAPPYHRS","valid":true,"subtotal":13,"discount":0,"total":13}`,
+			expectedReq:    business.CouponPreviewRequest{Items: []mongo.ItemRequest{{ProductID: productID.Hex(), Quantity: 2}}},
+		},
+		{
+			name:           "bad request",
+			req:            "notjson",
+			mock:           &mockBusiness{},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: `{"code":"invalid_body","detail":"must be an object","errors":[{"pointer":"","code":"invalid_type","detail":"must be an object"}],` +
+				`"instance":"/api/coupon/HAPPYHRS/preview","status":400,"title":"Bad Request","type":"urn:kart:problem:invalid_body"}`,
+		},
+		{
+			name: "validation failed",
+			req:  map[string]any{"items": []map[string]any{{"productId": productID.Hex(), "quantity": 1}}},
+			mock: &mockBusiness{
+				previewErr: validation.Violations{
+					{Pointer: "/items/0/productId", Code: aperr.CodeProductNotFound, Detail: "product not found"},
+				}.Err(aperr.ErrUnprocessableEntity, aperr.CodeValidationFailed),
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody: `{"code":"validation_failed","detail":"/items/0/productId product not found",` +
+				`"errors":[{"pointer":"/items/0/productId","code":"product_not_found","detail":"product not found"}],` +
+				`"instance":"/api/coupon/HAPPYHRS/preview","status":422,"title":"Unprocessable Entity","type":"urn:kart:problem:validation_failed"}`,
+			expectedReq: business.CouponPreviewRequest{Items: []mongo.ItemRequest{{ProductID: productID.Hex(), Quantity: 1}}},
+		},
+		{
+			name:           "internal error",
+			req:            map[string]any{"items": []map[string]any{{"productId": productID.Hex(), "quantity": 1}}},
+			mock:           &mockBusiness{previewErr: errors.New("internal error")},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody: `{"code":"internal_error","instance":"/api/coupon/HAPPYHRS/preview","status":500,"title":"Internal Server Error",` +
+				`"type":"urn:kart:problem:internal_error"}`,
+			expectedReq: business.CouponPreviewRequest{Items: []mongo.ItemRequest{{ProductID: productID.Hex(), Quantity: 1}}},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			router := gin.Default()
+			handler := coupon.NewCoupon(test.mock)
+			router.POST("/api/coupon/:code/preview", handler.Preview)
+
+			w := httptest.NewRecorder()
+			jsonBytes, err := json.Marshal(test.req)
+			require.NoError(t, err)
+			router.ServeHTTP(w, httptest.NewRequest("POST", "/api/coupon/HAPPYHRS/preview", bytes.NewReader(jsonBytes)))
+
+			require.Equal(t, test.expectedStatus, w.Code)
+			assert.Equal(t, test.expectedBody, w.Body.String())
+			assert.Equal(t, test.expectedReq, test.mock.req)
+		})
+	}
+}
+
+type mockBusiness struct {
+	code          string
+	req           business.CouponPreviewRequest
+	checkResult   *business.CouponCheck
+	checkErr      error
+	previewResult *business.CouponPreview
+	previewErr    error
+}
+
+func (m *mockBusiness) CheckCoupon(_ context.Context, code string) (*business.CouponCheck, error) {
+	m.code = code
+	return m.checkResult, m.checkErr
+}
+
+func (m *mockBusiness) PreviewCoupon(_ context.Context, code string, req business.CouponPreviewRequest) (*business.CouponPreview, error) {
+	m.code, m.req = code, req
+	return m.previewResult, m.previewErr
+}
@@ -73,10 +73,10 @@ func setupTestData(t *testing.T) {
 func TestEndToEnd(t *testing.T) {
 	setupTestData(t)
 
-	client, err := mongo.NewClient(mongoURI, dbName)
+	client, err := mongo.NewClient(config.MongoDB{URI: mongoURI, DB: dbName, ServerSelectionTimeout: 2 * time.Second})
 	require.NoError(t, err)
 
-	buss := business.NewBusiness(client)
+	buss := business.NewBusiness(client, client, client)
 
 	port := getFreePort(t)
 	t.Logf("Listening on port %d", port)
@@ -145,4 +145,37 @@ func TestEndToEnd(t *testing.T) {
 		assert.Contains(t, string(body), fmt.Sprintf(`"items":[{"productId":%q,"quantity":1}]`, productID.Hex()))
 		assert.Contains(t, string(body), fmt.Sprintf(`"products":[{"id":%q,"category":"","name":%q,"price":0}]}`, productID.Hex(), productName))
 	})
+
+	t.Run("GET /api/coupon/:code", func(t *testing.T) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("http://localhost:%d/api/coupon/%s", port, couponCode), nil)
+		require.NoError(t, err)
+		req.Header.Set("Api_key", "apitest")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf(`{"code":%q,"valid":true}`, couponCode), string(body))
+	})
+
+	t.Run("POST /api/coupon/:code/preview", func(t *testing.T) {
+		jsonBytes, err := json.Marshal(map[string]any{"items": []map[string]any{{"productId": productID.Hex(), "quantity": 2}}})
+		require.NoError(t, err)
+		httpreq, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/api/coupon/%s/preview", port, couponCode), bytes.NewReader(jsonBytes))
+		require.NoError(t, err)
+		httpreq.Header.Set("Api_key", "apitest")
+		httpreq.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(httpreq)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf(`{"code":%q,"valid":true,"subtotal":0,"discount":0,"total":0}`, couponCode), string(body))
+	})
 }
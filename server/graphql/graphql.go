@@ -0,0 +1,132 @@
+// Package graphql contains the GraphQL requests handler over the products and the orders.
+// The product lookups behind the orders of a request are batched into one FindProducts call.
+package graphql
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	gql "github.com/graph-gophers/graphql-go"
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/business"
+	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/logger"
+	"github.com/y7ls8i/kart/server/sverr"
+	"github.com/y7ls8i/kart/validation"
+)
+
+// schema is the GraphQL schema.
+//
+//go:embed schema.graphql
+var schema string
+
+// MaxDepth is the maximum depth of a query.
+const MaxDepth = 10
+
+// DB is the interface for the database layer that is required by the GraphQL requests handler.
+type DB interface {
+	SearchProducts(ctx context.Context, filter mongo.ProductFilter, page int) ([]mongo.Product, error)
+	GetProduct(ctx context.Context, id string) (*mongo.Product, error)
+	FindProducts(ctx context.Context, ids []string) (missing []string, products []mongo.Product, err error)
+	ListOrders(ctx context.Context, page int) ([]mongo.Order, error)
+	GetOrder(ctx context.Context, id string) (*mongo.Order, error)
+}
+
+// Business is the interface for the business layer that is required by the GraphQL requests handler.
+type Business interface {
+	CreateOrder(ctx context.Context, req business.OrderRequest) (result *business.Order, err error)
+}
+
+// GraphQL struct represents the GraphQL requests handler.
+type GraphQL struct {
+	db     DB
+	schema *gql.Schema
+}
+
+// NewGraphQL returns a new GraphQL requests handler.
+func NewGraphQL(db DB, buss Business) (*GraphQL, error) {
+	s, err := gql.ParseSchema(schema, &resolver{db: db, buss: buss}, gql.MaxDepth(MaxDepth))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the GraphQL schema: %w", err)
+	}
+	return &GraphQL{db: db, schema: s}, nil
+}
+
+// Request is a GraphQL request.
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// Handle executes a GraphQL request.
+func (g *GraphQL) Handle(ctx *gin.Context) {
+	req := Request{}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			sverr.Abort(ctx, aperr.New(aperr.ErrTooLarge, aperr.CodeTooLarge,
+				fmt.Sprintf("request body larger than %d bytes", maxBytesErr.Limit)).With("limit", maxBytesErr.Limit), "")
+			return
+		}
+		violations := validation.FromJSON(err)
+		if violations == nil {
+			violations.Add("", validation.CodeInvalidJSON, "invalid request body")
+		}
+		sverr.Abort(ctx, violations.Problem(aperr.ErrBadRequest, aperr.CodeInvalidBody).WithCause(err), "")
+		return
+	}
+	if req.Query == "" {
+		sverr.Abort(ctx, validation.Violations{{Pointer: "/query", Code: aperr.CodeRequired, Detail: "is required"}}.
+			Err(aperr.ErrBadRequest, aperr.CodeInvalidBody), "")
+		return
+	}
+
+	// every request has its own loader, so the products are batched and cached within the request only
+	c := withLoader(ctx, newProductLoader(g.db))
+	ctx.JSON(http.StatusOK, g.schema.Exec(c, req.Query, req.OperationName, req.Variables))
+}
+
+// resolverError is an error returned to the GraphQL client, with the code of the error in its extensions.
+type resolverError struct {
+	message    string
+	extensions map[string]any
+}
+
+func (e *resolverError) Error() string {
+	return e.message
+}
+
+// Extensions returns the extensions of the error.
+func (e *resolverError) Extensions() map[string]any {
+	return e.extensions
+}
+
+// toResolverError returns the error reported to the GraphQL client.
+// The errors that are not one of the aperr sentinel errors are logged with the message log and reported as an
+// internal error without details.
+func toResolverError(ctx context.Context, err error, log string) error {
+	var apErr *aperr.Error
+	if errors.As(err, &apErr) {
+		extensions := map[string]any{"code": apErr.Code}
+		for k, v := range apErr.Extensions {
+			extensions[k] = v
+		}
+		return &resolverError{message: apErr.Detail, extensions: extensions}
+	}
+	for kind, code := range map[error]string{
+		aperr.ErrNotFound:            aperr.CodeNotFound,
+		aperr.ErrBadRequest:          aperr.CodeBadRequest,
+		aperr.ErrUnprocessableEntity: aperr.CodeUnprocessableEntity,
+	} {
+		if errors.Is(err, kind) {
+			return &resolverError{message: err.Error(), extensions: map[string]any{"code": code}}
+		}
+	}
+	logger.FromContext(ctx).Error(log, "error", err)
+	return &resolverError{message: "internal error", extensions: map[string]any{"code": aperr.CodeInternal}}
+}
@@ -0,0 +1,231 @@
+package graphql_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/business"
+	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/server/graphql"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestGraphQL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	product1 := mongo.Product{ID: bson.NewObjectID(), Category: "Waffle", Name: "product1", Price: 6.5}
+	product2 := mongo.Product{ID: bson.NewObjectID(), Category: "Cake", Name: "product2", Price: 4}
+	deletedID := bson.NewObjectID()
+	order1 := mongo.Order{ID: bson.NewObjectID(), Items: []mongo.OrderItem{{ProductID: product1.ID, Quantity: 2}}}
+	order2 := mongo.Order{ID: bson.NewObjectID(), Items: []mongo.OrderItem{
+		{ProductID: product2.ID, Quantity: 1},
+		{ProductID: deletedID, Quantity: 3},
+		{ProductID: product1.ID, Quantity: 1},
+	}}
+
+	testCases := []struct {
+		name                 string
+		body                 string
+		db                   *mockDB
+		buss                 *mockBusiness
+		expectedStatus       int
+		expectedBody         string
+		expectedFindProducts [][]string
+	}{
+		{
+			name: "products with filter",
+			body: `{"query":"query($f: ProductFilter) { products(filter: $f, page: 2) { id name price } }",` +
+				`"variables":{"f":{"category":"Waffle","minPrice":5}}}`,
+			db:             &mockDB{searchProductsResult: []mongo.Product{product1}},
+			expectedStatus: http.StatusOK,
+			expectedBody: fmt.Sprintf(`{"data":{"products":[{"id":%q,"name":"product1","price":6.5}]}}`,
+				product1.ID.Hex()),
+		},
+		{
+			name:           "product not found",
+			body:           `{"query":"{ product(id: \"6ad53824214bdddbd3ae8ef6\") { id } }"}`,
+			db:             &mockDB{getProductErr: fmt.Errorf("%w: product not found", aperr.ErrNotFound)},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"product":null}}`,
+		},
+		{
+			name: "product bad request",
+			body: `{"query":"{ product(id: \"badid\") { id } }"}`,
+			db: &mockDB{getProductErr: aperr.New(aperr.ErrBadRequest, aperr.CodeInvalidProductID,
+				`invalid product ID "badid"`)},
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"errors":[{"message":"invalid product ID \"badid\"","path":["product"],` +
+				`"extensions":{"code":"invalid_product_id"}}],"data":{"product":null}}`,
+		},
+		{
+			name:           "orders with products in one lookup",
+			body:           `{"query":"{ orders { id items { quantity product { name } } } }"}`,
+			db:             &mockDB{listOrdersResult: []mongo.Order{order1, order2}, findProductsResult: []mongo.Product{product1, product2}},
+			expectedStatus: http.StatusOK,
+			expectedBody: fmt.Sprintf(`{"data":{"orders":[`+
+				`{"id":%q,"items":[{"quantity":2,"product":{"name":"product1"}}]},`+
+				`{"id":%q,"items":[{"quantity":1,"product":{"name":"product2"}},{"quantity":3,"product":null},{"quantity":1,"product":{"name":"product1"}}]}`+
+				`]}}`, order1.ID.Hex(), order2.ID.Hex()),
+			expectedFindProducts: [][]string{{product1.ID.Hex(), product2.ID.Hex(), deletedID.Hex()}},
+		},
+		{
+			name:           "orders without products",
+			body:           `{"query":"{ orders { id } }"}`,
+			db:             &mockDB{listOrdersResult: []mongo.Order{order1}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   fmt.Sprintf(`{"data":{"orders":[{"id":%q}]}}`, order1.ID.Hex()),
+		},
+		{
+			name:           "order internal error",
+			body:           `{"query":"{ order(id: \"6ad53824214bdddbd3ae8ef6\") { id } }"}`,
+			db:             &mockDB{getOrderErr: errors.New("connection lost")},
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"errors":[{"message":"internal error","path":["order"],` +
+				`"extensions":{"code":"internal_error"}}],"data":{"order":null}}`,
+		},
+		{
+			name: "create order",
+			body: fmt.Sprintf(`{"query":"mutation { createOrder(input: {items: [{productId: \"%s\", quantity: 2}], couponCode: \"HAPPYHRS\"}) `+
+				`{ items { productId quantity product { name } } } }"}`, product1.ID.Hex()),
+			db: &mockDB{},
+			buss: &mockBusiness{createOrderResult: &business.Order{
+				Order:    &order1,
+				Products: []mongo.Product{product1},
+			}},
+			expectedStatus: http.StatusOK,
+			expectedBody: fmt.Sprintf(`{"data":{"createOrder":{"items":[{"productId":%q,"quantity":2,"product":{"name":"product1"}}]}}}`,
+				product1.ID.Hex()),
+		},
+		{
+			name: "create order validation failed",
+			body: `{"query":"mutation { createOrder(input: {items: [{productId: \"\", quantity: 1}]}) { id } }"}`,
+			db:   &mockDB{},
+			buss: &mockBusiness{createOrderErr: aperr.New(aperr.ErrUnprocessableEntity, aperr.CodeValidationFailed,
+				"/items/0/productId is required").With("missingProductIds", []string{})},
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"errors":[{"message":"/items/0/productId is required","path":["createOrder"],` +
+				`"extensions":{"code":"validation_failed","missingProductIds":[]}}],"data":null}`,
+		},
+		{
+			name:           "syntax error",
+			body:           `{"query":"{ products { id "}`,
+			db:             &mockDB{},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"errors":[{"message":"syntax error: unexpected \"\", expecting Ident","locations":[{"line":1,"column":17}]}]}`,
+		},
+		{
+			name:           "missing query",
+			body:           `{}`,
+			db:             &mockDB{},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: `{"code":"invalid_body","detail":"/query is required","errors":[{"pointer":"/query","code":"required","detail":"is required"}],` +
+				`"instance":"/graphql","status":400,"title":"Bad Request","type":"urn:kart:problem:invalid_body"}`,
+		},
+		{
+			name:           "invalid body",
+			body:           `{"query":1}`,
+			db:             &mockDB{},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: `{"code":"invalid_body","detail":"/query must be a string","errors":[{"pointer":"/query","code":"invalid_type","detail":"must be a string"}],` +
+				`"instance":"/graphql","status":400,"title":"Bad Request","type":"urn:kart:problem:invalid_body"}`,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			buss := test.buss
+			if buss == nil {
+				buss = &mockBusiness{}
+			}
+			handler, err := graphql.NewGraphQL(test.db, buss)
+			require.NoError(t, err)
+			router := gin.New()
+			router.POST("/graphql", handler.Handle)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", "/graphql", bytes.NewBufferString(test.body)))
+
+			require.Equal(t, test.expectedStatus, w.Code)
+			assert.JSONEq(t, test.expectedBody, w.Body.String())
+			assert.Equal(t, test.expectedFindProducts, test.db.findProductsIDs)
+		})
+	}
+}
+
+func TestGraphQL_depth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, err := graphql.NewGraphQL(&mockDB{}, &mockBusiness{})
+	require.NoError(t, err)
+	router := gin.New()
+	router.POST("/graphql", handler.Handle)
+
+	query := "name"
+	for range graphql.MaxDepth {
+		query = "ofType { " + query + " }"
+	}
+	body, err := json.Marshal(graphql.Request{Query: "{ __schema { types { " + query + " } } }"})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/graphql", bytes.NewBuffer(body)))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "exceeds max depth")
+}
+
+type mockDB struct {
+	searchProductsResult []mongo.Product
+	getProductErr        error
+	findProductsResult   []mongo.Product
+	findProductsIDs      [][]string
+	listOrdersResult     []mongo.Order
+	getOrderErr          error
+}
+
+func (m *mockDB) SearchProducts(_ context.Context, _ mongo.ProductFilter, _ int) ([]mongo.Product, error) {
+	return m.searchProductsResult, nil
+}
+
+func (m *mockDB) GetProduct(_ context.Context, _ string) (*mongo.Product, error) {
+	if m.getProductErr != nil {
+		return nil, m.getProductErr
+	}
+	return &mongo.Product{}, nil
+}
+
+func (m *mockDB) FindProducts(_ context.Context, ids []string) ([]string, []mongo.Product, error) {
+	m.findProductsIDs = append(m.findProductsIDs, ids)
+	return nil, m.findProductsResult, nil
+}
+
+func (m *mockDB) ListOrders(_ context.Context, _ int) ([]mongo.Order, error) {
+	return m.listOrdersResult, nil
+}
+
+func (m *mockDB) GetOrder(_ context.Context, _ string) (*mongo.Order, error) {
+	if m.getOrderErr != nil {
+		return nil, m.getOrderErr
+	}
+	return &mongo.Order{}, nil
+}
+
+type mockBusiness struct {
+	createOrderResult *business.Order
+	createOrderErr    error
+}
+
+func (m *mockBusiness) CreateOrder(_ context.Context, _ business.OrderRequest) (*business.Order, error) {
+	return m.createOrderResult, m.createOrderErr
+}
@@ -0,0 +1,86 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/y7ls8i/kart/adapter/mongo"
+)
+
+type loaderKey struct{}
+
+// withLoader returns a copy of ctx that carries the product loader l.
+func withLoader(ctx context.Context, l *productLoader) context.Context {
+	return context.WithValue(ctx, loaderKey{}, l)
+}
+
+// loaderFrom returns the product loader carried by ctx.
+func loaderFrom(ctx context.Context) *productLoader {
+	return ctx.Value(loaderKey{}).(*productLoader)
+}
+
+// productLoader batches the product lookups of a request.
+// The resolvers announce the products they may need with want, and the first load looks them all up with one
+// FindProducts call. The products are then cached for the rest of the request.
+type productLoader struct {
+	db DB
+
+	mu       sync.Mutex
+	wanted   []string
+	products map[string]*mongo.Product // nil for the products that do not exist
+}
+
+func newProductLoader(db DB) *productLoader {
+	return &productLoader{db: db, products: map[string]*mongo.Product{}}
+}
+
+// want announces that the products of ids may be loaded.
+func (l *productLoader) want(ids ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.wanted = append(l.wanted, ids...)
+}
+
+// prime caches products that were already looked up.
+func (l *productLoader) prime(products []mongo.Product) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := range products {
+		l.products[products[i].ID.Hex()] = &products[i]
+	}
+}
+
+// load returns the product of id, or nil if it does not exist.
+// If the product is not cached yet, it is looked up together with all the wanted products that are not cached.
+func (l *productLoader) load(ctx context.Context, id string) (*mongo.Product, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if product, ok := l.products[id]; ok {
+		return product, nil
+	}
+
+	seen := map[string]bool{}
+	ids := make([]string, 0, len(l.wanted)+1)
+	for _, wanted := range append(l.wanted, id) {
+		if _, cached := l.products[wanted]; cached || seen[wanted] {
+			continue
+		}
+		seen[wanted] = true
+		ids = append(ids, wanted)
+	}
+	l.wanted = nil
+
+	_, products, err := l.db.FindProducts(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find products: %w", err)
+	}
+	for _, id := range ids {
+		l.products[id] = nil
+	}
+	for i := range products {
+		l.products[products[i].ID.Hex()] = &products[i]
+	}
+	return l.products[id], nil
+}
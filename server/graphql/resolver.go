@@ -0,0 +1,190 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+
+	gql "github.com/graph-gophers/graphql-go"
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/business"
+	aperr "github.com/y7ls8i/kart/error"
+)
+
+// resolver is the root resolver of the queries and the mutations.
+type resolver struct {
+	db   DB
+	buss Business
+}
+
+type productFilterInput struct {
+	Category *string
+	Name     *string
+	MinPrice *float64
+	MaxPrice *float64
+}
+
+// Products resolves the products query.
+func (r *resolver) Products(ctx context.Context, args struct {
+	Filter *productFilterInput
+	Page   int32
+}) ([]*productResolver, error) {
+	filter := mongo.ProductFilter{}
+	if args.Filter != nil {
+		filter.MinPrice = args.Filter.MinPrice
+		filter.MaxPrice = args.Filter.MaxPrice
+		if args.Filter.Category != nil {
+			filter.Category = *args.Filter.Category
+		}
+		if args.Filter.Name != nil {
+			filter.Name = *args.Filter.Name
+		}
+	}
+
+	products, err := r.db.SearchProducts(ctx, filter, int(args.Page))
+	if err != nil {
+		return nil, toResolverError(ctx, err, "Error searching products")
+	}
+	loaderFrom(ctx).prime(products)
+
+	result := make([]*productResolver, 0, len(products))
+	for i := range products {
+		result = append(result, &productResolver{product: &products[i]})
+	}
+	return result, nil
+}
+
+// Product resolves the product query.
+func (r *resolver) Product(ctx context.Context, args struct{ ID gql.ID }) (*productResolver, error) {
+	product, err := r.db.GetProduct(ctx, string(args.ID))
+	if err != nil {
+		if errors.Is(err, aperr.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, toResolverError(ctx, err, "Error getting product")
+	}
+	return &productResolver{product: product}, nil
+}
+
+// Orders resolves the orders query.
+func (r *resolver) Orders(ctx context.Context, args struct{ Page int32 }) ([]*orderResolver, error) {
+	orders, err := r.db.ListOrders(ctx, int(args.Page))
+	if err != nil {
+		return nil, toResolverError(ctx, err, "Error listing orders")
+	}
+
+	result := make([]*orderResolver, 0, len(orders))
+	for i := range orders {
+		result = append(result, newOrderResolver(ctx, &orders[i]))
+	}
+	return result, nil
+}
+
+// Order resolves the order query.
+func (r *resolver) Order(ctx context.Context, args struct{ ID gql.ID }) (*orderResolver, error) {
+	order, err := r.db.GetOrder(ctx, string(args.ID))
+	if err != nil {
+		if errors.Is(err, aperr.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, toResolverError(ctx, err, "Error getting order")
+	}
+	return newOrderResolver(ctx, order), nil
+}
+
+type orderInput struct {
+	Items      []itemInput
+	CouponCode *string
+}
+
+type itemInput struct {
+	ProductID gql.ID
+	Quantity  int32
+}
+
+// CreateOrder resolves the createOrder mutation.
+func (r *resolver) CreateOrder(ctx context.Context, args struct{ Input orderInput }) (*orderResolver, error) {
+	req := business.OrderRequest{Items: make([]mongo.ItemRequest, 0, len(args.Input.Items))}
+	for _, item := range args.Input.Items {
+		req.Items = append(req.Items, mongo.ItemRequest{ProductID: string(item.ProductID), Quantity: int(item.Quantity)})
+	}
+	if args.Input.CouponCode != nil {
+		req.CouponCode = *args.Input.CouponCode
+	}
+
+	order, err := r.buss.CreateOrder(ctx, req)
+	if err != nil {
+		return nil, toResolverError(ctx, err, "Error creating order")
+	}
+	loaderFrom(ctx).prime(order.Products)
+	return newOrderResolver(ctx, order.Order), nil
+}
+
+type productResolver struct {
+	product *mongo.Product
+}
+
+func (r *productResolver) ID() gql.ID {
+	return gql.ID(r.product.ID.Hex())
+}
+
+func (r *productResolver) Category() string {
+	return r.product.Category
+}
+
+func (r *productResolver) Name() string {
+	return r.product.Name
+}
+
+func (r *productResolver) Price() float64 {
+	return r.product.Price
+}
+
+type orderResolver struct {
+	order *mongo.Order
+}
+
+// newOrderResolver returns the resolver of order, and announces its products to the loader of ctx so that the
+// products of all the orders of the request are looked up together.
+func newOrderResolver(ctx context.Context, order *mongo.Order) *orderResolver {
+	ids := make([]string, 0, len(order.Items))
+	for _, item := range order.Items {
+		ids = append(ids, item.ProductID.Hex())
+	}
+	loaderFrom(ctx).want(ids...)
+	return &orderResolver{order: order}
+}
+
+func (r *orderResolver) ID() gql.ID {
+	return gql.ID(r.order.ID.Hex())
+}
+
+func (r *orderResolver) Items() []*orderItemResolver {
+	result := make([]*orderItemResolver, 0, len(r.order.Items))
+	for _, item := range r.order.Items {
+		result = append(result, &orderItemResolver{item: item})
+	}
+	return result
+}
+
+type orderItemResolver struct {
+	item mongo.OrderItem
+}
+
+func (r *orderItemResolver) ProductID() gql.ID {
+	return gql.ID(r.item.ProductID.Hex())
+}
+
+func (r *orderItemResolver) Quantity() int32 {
+	return int32(r.item.Quantity)
+}
+
+func (r *orderItemResolver) Product(ctx context.Context) (*productResolver, error) {
+	product, err := loaderFrom(ctx).load(ctx, r.item.ProductID.Hex())
+	if err != nil {
+		return nil, toResolverError(ctx, err, "Error loading product")
+	}
+	if product == nil {
+		return nil, nil
+	}
+	return &productResolver{product: product}, nil
+}
@@ -0,0 +1,98 @@
+// Package health contains the liveness and readiness probes handler.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/y7ls8i/kart/logger"
+)
+
+// CheckTimeout bounds the time each dependency check of the readiness probe may take.
+const CheckTimeout = 2 * time.Second
+
+// Statuses reported by the probes.
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+)
+
+// DB is the interface for the database layer that is required by the probes handler.
+type DB interface {
+	Ping(ctx context.Context) error
+	CheckIndexes(ctx context.Context) error
+}
+
+// Check is the result of a dependency check.
+type Check struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is the response body of the probes.
+type Report struct {
+	Status string           `json:"status"`
+	Checks map[string]Check `json:"checks,omitempty"`
+}
+
+// Health struct represents the probes handler.
+type Health struct {
+	db       DB
+	draining atomic.Bool
+}
+
+// NewHealth returns a new probes handler.
+func NewHealth(db DB) *Health {
+	return &Health{db: db}
+}
+
+// Drain makes the readiness probe fail, so that load balancers stop sending new requests before the server shuts
+// down.
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// Live reports that the process is up. It does not check the dependencies, so that a database outage does not make
+// the orchestrator restart every instance.
+func (h *Health) Live(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, Report{Status: StatusOK})
+}
+
+// Ready reports whether the server can serve requests: it is not shutting down, MongoDB answers, and the indexes
+// are applied.
+func (h *Health) Ready(ctx *gin.Context) {
+	if h.draining.Load() {
+		ctx.JSON(http.StatusServiceUnavailable, Report{
+			Status: StatusFailing,
+			Checks: map[string]Check{"server": {Status: StatusFailing, Error: "shutting down"}},
+		})
+		return
+	}
+
+	report := Report{Status: StatusOK, Checks: map[string]Check{}}
+	for name, check := range map[string]func(context.Context) error{
+		"mongo":   h.db.Ping,
+		"indexes": h.db.CheckIndexes,
+	} {
+		checkCtx, cancel := context.WithTimeout(ctx, CheckTimeout)
+		err := check(checkCtx)
+		cancel()
+
+		if err != nil {
+			logger.FromContext(ctx).Warn("Readiness check failed", "check", name, "error", err)
+			report.Status = StatusFailing
+			report.Checks[name] = Check{Status: StatusFailing, Error: err.Error()}
+			continue
+		}
+		report.Checks[name] = Check{Status: StatusOK}
+	}
+
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.JSON(status, report)
+}
@@ -0,0 +1,97 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/server/health"
+)
+
+func TestLive(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	handler := health.NewHealth(&mockDB{pingErr: errors.New("connection refused")})
+	router.GET("/healthz", handler.Live)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestReady(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	testCases := []struct {
+		name           string
+		mock           *mockDB
+		drain          bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "ready",
+			mock:           &mockDB{},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"ok","checks":{"indexes":{"status":"ok"},"mongo":{"status":"ok"}}}`,
+		},
+		{
+			name:           "mongo down",
+			mock:           &mockDB{pingErr: errors.New("connection refused"), checkIndexesErr: errors.New("connection refused")},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   `{"status":"failing","checks":{"indexes":{"status":"failing","error":"connection refused"},"mongo":{"status":"failing","error":"connection refused"}}}`,
+		},
+		{
+			name:           "indexes missing",
+			mock:           &mockDB{checkIndexesErr: errors.New("coupons index is missing")},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   `{"status":"failing","checks":{"indexes":{"status":"failing","error":"coupons index is missing"},"mongo":{"status":"ok"}}}`,
+		},
+		{
+			name:           "draining",
+			mock:           &mockDB{},
+			drain:          true,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   `{"status":"failing","checks":{"server":{"status":"failing","error":"shutting down"}}}`,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			router := gin.New()
+			handler := health.NewHealth(test.mock)
+			if test.drain {
+				handler.Drain()
+			}
+			router.GET("/readyz", handler.Ready)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+
+			require.Equal(t, test.expectedStatus, w.Code)
+			assert.Equal(t, test.expectedBody, w.Body.String())
+		})
+	}
+}
+
+type mockDB struct {
+	pingErr         error
+	checkIndexesErr error
+}
+
+func (m *mockDB) Ping(_ context.Context) error {
+	return m.pingErr
+}
+
+func (m *mockDB) CheckIndexes(_ context.Context) error {
+	return m.checkIndexesErr
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/y7ls8i/kart/business"
+	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/logger"
+	"github.com/y7ls8i/kart/metrics"
+	"github.com/y7ls8i/kart/server/sverr"
+	"github.com/y7ls8i/kart/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HeaderRequestID is the header that carries the request ID.
+const HeaderRequestID = "X-Request-ID"
+
+// maxRequestIDLength is the longest client supplied request ID that is propagated as is.
+const maxRequestIDLength = 128
+
+// RequestLogger is a middleware that assigns or propagates the request ID, attaches a request-scoped logger to the
+// request context, and logs every request once it is served.
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(HeaderRequestID)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		c.Header(HeaderRequestID, requestID)
+
+		l := slog.Default().With("requestId", requestID)
+		ctx := logger.NewContext(c.Request.Context(), l)
+		ctx = logger.WithRequestID(ctx, requestID)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		route := routeOf(c)
+		status := c.Writer.Status()
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("clientIp", c.ClientIP()),
+			slog.String("userAgent", c.Request.UserAgent()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		l.LogAttrs(ctx, level, "HTTP request", attrs...)
+	}
+}
+
+// Metrics is a middleware that counts the served requests and observes their latency by method, route and status.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := routeOf(c)
+		status := strconv.Itoa(c.Writer.Status())
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Tracing is a middleware that starts the server span of the request, continuing the trace of the W3C traceparent
+// header if the client sent one, and adds the trace ID to the request-scoped logger.
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := routeOf(c)
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := tracing.Tracer().Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(c.Request.URL.Path),
+				semconv.ClientAddress(c.ClientIP()),
+				semconv.UserAgentOriginal(c.Request.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		if sc := span.SpanContext(); sc.IsValid() {
+			ctx = logger.NewContext(ctx, logger.FromContext(ctx).With("traceId", sc.TraceID().String()))
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		if len(c.Errors) > 0 {
+			span.RecordError(c.Errors.Last())
+		}
+	}
+}
+
+// BodyLimit is a middleware that limits the size of the request body to limit bytes; 0 means no limit.
+// Reading past the limit fails with *http.MaxBytesError.
+func BodyLimit(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > limit {
+			sverr.Abort(c, aperr.New(aperr.ErrTooLarge, aperr.CodeTooLarge,
+				fmt.Sprintf("request body larger than %d bytes", limit)).With("limit", limit), "")
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// ClientContext is a middleware that attaches the client IP to the request context, so that the business layer can
+// throttle the failed coupon attempts of each client.
+func ClientContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(business.WithClient(c.Request.Context(), c.ClientIP()))
+		c.Next()
+	}
+}
+
+// routeOf returns the route pattern that matched the request, so that path parameters do not explode the label
+// cardinality of logs and metrics.
+func routeOf(c *gin.Context) string {
+	if route := c.FullPath(); route != "" {
+		return route
+	}
+	return "unmatched"
+}
+
+// validRequestID reports whether a client supplied request ID is safe to propagate.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit request ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,156 @@
+package server_test
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/business"
+	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/logger"
+	"github.com/y7ls8i/kart/server"
+	"github.com/y7ls8i/kart/server/sverr"
+	"github.com/y7ls8i/kart/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestRequestLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	buf := &bytes.Buffer{}
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(buf, nil)))
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+	})
+
+	var ctxRequestID string
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(server.RequestLogger())
+	router.GET("/api/thing/:id", func(c *gin.Context) {
+		ctxRequestID = logger.RequestID(c)
+		logger.FromContext(c).Info("inside handler")
+		c.Status(http.StatusTeapot)
+	})
+
+	testCases := []struct {
+		name           string
+		header         string
+		expectedHeader string
+	}{
+		{
+			name:           "propagated",
+			header:         "req-123",
+			expectedHeader: "req-123",
+		},
+		{
+			name:           "generated",
+			header:         "",
+			expectedHeader: "",
+		},
+		{
+			name:           "invalid replaced",
+			header:         "has space",
+			expectedHeader: "",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			buf.Reset()
+
+			req := httptest.NewRequest("GET", "/api/thing/42", nil)
+			if test.header != "" {
+				req.Header.Set(server.HeaderRequestID, test.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			requestID := w.Header().Get(server.HeaderRequestID)
+			if test.expectedHeader != "" {
+				assert.Equal(t, test.expectedHeader, requestID)
+			} else {
+				require.Len(t, requestID, 32)
+			}
+			assert.Equal(t, requestID, ctxRequestID)
+
+			logs := buf.String()
+			assert.Contains(t, logs, "msg=\"inside handler\" requestId="+requestID)
+			assert.Contains(t, logs, "msg=\"HTTP request\" requestId="+requestID)
+			assert.Contains(t, logs, "method=GET route=/api/thing/:id path=/api/thing/42 status=418")
+		})
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var client string
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(server.ClientContext())
+	router.POST("/api/order", func(c *gin.Context) {
+		client = business.Client(c)
+		sverr.Abort(c, aperr.New(aperr.ErrTooManyRequests, aperr.CodeTooManyCouponAttempts, "too many failed coupon attempts").
+			With("retryAfter", 60), "")
+	})
+
+	req := httptest.NewRequest("POST", "/api/order", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, "10.0.0.1", client)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), `"code":"too_many_coupon_attempts"`)
+}
+
+func TestTracing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(server.Tracing())
+	router.GET("/api/thing/:id", func(c *gin.Context) {
+		_, span := tracing.Tracer().Start(c, "inside handler")
+		span.End()
+		c.Status(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest("GET", "/api/thing/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+
+	child, root := spans[0], spans[1]
+	assert.Equal(t, "GET /api/thing/:id", root.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", root.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", root.Parent().SpanID().String())
+	assert.True(t, root.Parent().IsRemote())
+	assert.Equal(t, codes.Error, root.Status().Code)
+	assert.Contains(t, root.Attributes(), attribute.Int("http.response.status_code", http.StatusInternalServerError))
+
+	assert.Equal(t, "inside handler", child.Name())
+	assert.Equal(t, root.SpanContext().SpanID(), child.Parent().SpanID())
+}
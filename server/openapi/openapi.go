@@ -0,0 +1,266 @@
+// Package openapi serves the OpenAPI 3 document of the API, and validates the requests and the responses against it.
+package openapi
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/server/sverr"
+	"github.com/y7ls8i/kart/validation"
+)
+
+// document is the OpenAPI document of the API. Partner teams generate their clients from it.
+//
+//go:embed openapi.json
+var document []byte
+
+// routeParam matches the parameters of a gin route path, e.g. :id.
+var routeParam = regexp.MustCompile(`:([^/]+)`)
+
+// Load parses and validates the OpenAPI document.
+func Load() (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the OpenAPI document: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	return doc, nil
+}
+
+// Path returns the OpenAPI path of a gin route path, e.g. /api/product/{id} for /api/product/:id.
+func Path(route string) string {
+	return routeParam.ReplaceAllString(route, "{$1}")
+}
+
+// Handler serves the OpenAPI document.
+func Handler(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", document)
+}
+
+// Validator is a middleware that rejects the requests that do not match the OpenAPI document.
+// If validateResponses is true, the responses that do not match the document are replaced with an internal error;
+// it is meant for the tests, as the responses are buffered to be validated.
+// The routes that are not in the document are not validated.
+func Validator(validateResponses bool) (gin.HandlerFunc, error) {
+	doc, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	options := &openapi3filter.Options{
+		MultiError: true,
+		// the API key is checked by the authentication middleware
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		// the handlers apply the defaults
+		SkipSettingDefaults: true,
+	}
+
+	return func(c *gin.Context) {
+		path := Path(c.FullPath())
+		pathItem := doc.Paths.Value(path)
+		if pathItem == nil {
+			c.Next()
+			return
+		}
+		operation := pathItem.GetOperation(c.Request.Method)
+		if operation == nil {
+			c.Next()
+			return
+		}
+
+		pathParams := make(map[string]string, len(c.Params))
+		for _, param := range c.Params {
+			pathParams[param.Key] = param.Value
+		}
+		input := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: pathParams,
+			Route: &routers.Route{
+				Spec:      doc,
+				Path:      path,
+				PathItem:  pathItem,
+				Method:    c.Request.Method,
+				Operation: operation,
+			},
+			Options: options,
+		}
+		if err := openapi3filter.ValidateRequest(c, input); err != nil {
+			sverr.Abort(c, requestError(err), "")
+			return
+		}
+
+		if !validateResponses {
+			c.Next()
+			return
+		}
+
+		w := &bufferedWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		responseInput := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 w.status,
+			Header:                 w.Header(),
+			Options:                options,
+		}
+		responseInput.SetBodyBytes(w.body.Bytes())
+		if err := openapi3filter.ValidateResponse(c, responseInput); err != nil {
+			w.Header().Del("Content-Length")
+			sverr.Abort(c, fmt.Errorf("response does not match the OpenAPI document: %w", err), "Invalid response")
+			return
+		}
+		w.flush()
+	}, nil
+}
+
+// requestError returns the error reported to the client for a request that does not match the OpenAPI document.
+func requestError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return aperr.New(aperr.ErrTooLarge, aperr.CodeTooLarge,
+			fmt.Sprintf("request body larger than %d bytes", maxBytesErr.Limit)).With("limit", maxBytesErr.Limit)
+	}
+
+	var violations validation.Violations
+	addViolations(&violations, "", err)
+	return violations.Problem(aperr.ErrBadRequest, aperr.CodeInvalidRequest).WithCause(err)
+}
+
+// addViolations adds the violations of err, the error of the request validation. param is the parameter err is
+// about, if any.
+func addViolations(violations *validation.Violations, param string, err error) {
+	var multiErr openapi3.MultiError
+	if errors.As(err, &multiErr) {
+		for _, err := range multiErr {
+			addViolations(violations, param, err)
+		}
+		return
+	}
+
+	var requestErr *openapi3filter.RequestError
+	if errors.As(err, &requestErr) {
+		if requestErr.Parameter != nil {
+			param = fmt.Sprintf("%s parameter %q", requestErr.Parameter.In, requestErr.Parameter.Name)
+		}
+		if requestErr.Err == nil {
+			violations.Add("", aperr.CodeInvalidRequest, prefix(param, requestErr.Reason))
+			return
+		}
+		addViolations(violations, param, requestErr.Err)
+		return
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		code := validation.CodeInvalidValue
+		switch schemaErr.SchemaField {
+		case "type":
+			code = validation.CodeInvalidType
+		case "required":
+			code = aperr.CodeRequired
+		}
+		reason := schemaErr.Reason
+		if reason == "" {
+			reason = fmt.Sprintf("does not match the schema %q", schemaErr.SchemaField)
+		}
+		if param != "" {
+			violations.Add("", code, prefix(param, reason))
+			return
+		}
+		violations.Add(validation.Pointer(toAny(schemaErr.JSONPointer())...), code, reason)
+		return
+	}
+
+	var parseErr *openapi3filter.ParseError
+	if errors.As(err, &parseErr) {
+		code := validation.CodeInvalidValue
+		if param == "" {
+			code = validation.CodeInvalidJSON
+		}
+		violations.Add("", code, prefix(param, parseErr.Error()))
+		return
+	}
+
+	violations.Add("", aperr.CodeInvalidRequest, prefix(param, err.Error()))
+}
+
+func prefix(param, reason string) string {
+	if param == "" {
+		return reason
+	}
+	return param + ": " + reason
+}
+
+func toAny(tokens []string) []any {
+	result := make([]any, len(tokens))
+	for i, token := range tokens {
+		result[i] = token
+	}
+	return result
+}
+
+// bufferedWriter buffers the response so that it can be validated before it is sent.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status  int
+	written bool
+	body    bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	if status > 0 && !w.written {
+		w.status = status
+	}
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.written
+}
+
+// flush sends the buffered response.
+func (w *bufferedWriter) flush() {
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.body.Len() == 0 {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	_, _ = w.ResponseWriter.Write(w.body.Bytes())
+}
@@ -0,0 +1,117 @@
+package openapi_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/server"
+	"github.com/y7ls8i/kart/server/openapi"
+	"github.com/y7ls8i/kart/server/sverr"
+)
+
+func TestLoad(t *testing.T) {
+	doc, err := openapi.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+}
+
+func TestPath(t *testing.T) {
+	assert.Equal(t, "/api/product", openapi.Path("/api/product"))
+	assert.Equal(t, "/api/product/{id}", openapi.Path("/api/product/:id"))
+	assert.Equal(t, "/a/{b}/c/{d}", openapi.Path("/a/:b/c/:d"))
+}
+
+func TestValidator(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(t *testing.T, validateResponses bool, handler gin.HandlerFunc) *gin.Engine {
+		t.Helper()
+		validator, err := openapi.Validator(validateResponses)
+		require.NoError(t, err)
+		router := gin.New()
+		router.Use(server.BodyLimit(32), validator)
+		router.GET("/api/product/:id", handler)
+		router.POST("/api/order", handler)
+		router.GET("/unknown", handler)
+		return router
+	}
+	invalidProduct := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"id": "notanid", "name": 1})
+	}
+
+	testCases := []struct {
+		name              string
+		validateResponses bool
+		method            string
+		path              string
+		body              string
+		expectedStatus    int
+		expectedBody      string
+	}{
+		{
+			name:           "response not validated",
+			method:         "GET",
+			path:           "/api/product/000000000000000000000000",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"id":"notanid","name":1}`,
+		},
+		{
+			name:              "invalid response",
+			validateResponses: true,
+			method:            "GET",
+			path:              "/api/product/000000000000000000000000",
+			expectedStatus:    http.StatusInternalServerError,
+			expectedBody: `{"code":"internal_error","instance":"/api/product/000000000000000000000000","status":500,` +
+				`"title":"Internal Server Error","type":"urn:kart:problem:internal_error"}`,
+		},
+		{
+			name:              "route not in the document",
+			validateResponses: true,
+			method:            "GET",
+			path:              "/unknown",
+			expectedStatus:    http.StatusOK,
+			expectedBody:      `{"id":"notanid","name":1}`,
+		},
+		{
+			name:           "body too large",
+			method:         "POST",
+			path:           "/api/order",
+			body:           `{"items":[],"couponCode":"` + strings.Repeat("a", 32) + `"}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedBody: `{"code":"request_too_large","detail":"request body larger than 32 bytes","instance":"/api/order","limit":32,` +
+				`"status":413,"title":"Request Entity Too Large","type":"urn:kart:problem:request_too_large"}`,
+		},
+		{
+			name:           "missing body",
+			method:         "POST",
+			path:           "/api/order",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: `{"code":"invalid_request","detail":"value is required but missing","errors":[{"pointer":"","code":"invalid_request",` +
+				`"detail":"value is required but missing"}],"instance":"/api/order","status":400,"title":"Bad Request","type":"urn:kart:problem:invalid_request"}`,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			router := newRouter(t, test.validateResponses, invalidProduct)
+
+			req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			req.ContentLength = -1
+			if test.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, test.expectedStatus, w.Code)
+			assert.Equal(t, test.expectedBody, w.Body.String())
+			if test.expectedStatus != http.StatusOK {
+				assert.Equal(t, sverr.ContentType, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -3,12 +3,15 @@ package order
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/y7ls8i/kart/business"
+	aperr "github.com/y7ls8i/kart/error"
 	"github.com/y7ls8i/kart/server/sverr"
+	"github.com/y7ls8i/kart/validation"
 )
 
 // Business is the interface for the business layer that is required by the order requests handler.
@@ -29,8 +32,18 @@ func NewOrder(buss Business) *Order {
 // Create creates a new order.
 func (o *Order) Create(ctx *gin.Context) {
 	req := business.OrderRequest{}
-	if err := ctx.BindJSON(&req); err != nil {
-		_ = ctx.AbortWithError(http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			sverr.Abort(ctx, aperr.New(aperr.ErrTooLarge, aperr.CodeTooLarge,
+				fmt.Sprintf("request body larger than %d bytes", maxBytesErr.Limit)).With("limit", maxBytesErr.Limit), "")
+			return
+		}
+		violations := validation.FromJSON(err)
+		if violations == nil {
+			violations.Add("", validation.CodeInvalidJSON, "invalid request body")
+		}
+		sverr.Abort(ctx, violations.Problem(aperr.ErrBadRequest, aperr.CodeInvalidBody).WithCause(err), "")
 		return
 	}
 
@@ -20,6 +20,8 @@ import (
 	"github.com/y7ls8i/kart/business"
 	aperr "github.com/y7ls8i/kart/error"
 	"github.com/y7ls8i/kart/server/order"
+	"github.com/y7ls8i/kart/server/sverr"
+	"github.com/y7ls8i/kart/validation"
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
@@ -56,8 +58,22 @@ func TestCreateOrder(t *testing.T) {
 				createOrderErr:    nil,
 			},
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   "",
-			expectedReq:    business.OrderRequest{},
+			expectedBody: `{"code":"invalid_body","detail":"must be an object","errors":[{"pointer":"","code":"invalid_type","detail":"must be an object"}],` +
+				`"instance":"/api/order","status":400,"title":"Bad Request","type":"urn:kart:problem:invalid_body"}`,
+			expectedReq: business.OrderRequest{},
+		},
+		{
+			name: "wrong field type",
+			req:  map[string]any{"items": []map[string]any{{"productId": productID.Hex(), "quantity": "1"}}},
+			mock: &mockBusiness{
+				createOrderResult: nil,
+				createOrderErr:    nil,
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: `{"code":"invalid_body","detail":"/items/0/quantity must be a number",` +
+				`"errors":[{"pointer":"/items/0/quantity","code":"invalid_type","detail":"must be a number"}],` +
+				`"instance":"/api/order","status":400,"title":"Bad Request","type":"urn:kart:problem:invalid_body"}`,
+			expectedReq: business.OrderRequest{},
 		},
 		{
 			name: "internal error",
@@ -67,7 +83,7 @@ func TestCreateOrder(t *testing.T) {
 				createOrderErr:    errors.New("internal error"),
 			},
 			expectedStatus: http.StatusInternalServerError,
-			expectedBody:   "",
+			expectedBody:   `{"code":"internal_error","instance":"/api/order","status":500,"title":"Internal Server Error","type":"urn:kart:problem:internal_error"}`,
 			expectedReq:    business.OrderRequest{Items: []mongo.ItemRequest{{ProductID: productID.Hex(), Quantity: 1}}, CouponCode: "coupon1"},
 		},
 		{
@@ -78,8 +94,24 @@ func TestCreateOrder(t *testing.T) {
 				createOrderErr:    fmt.Errorf("%w: coupon not found", aperr.ErrUnprocessableEntity),
 			},
 			expectedStatus: http.StatusUnprocessableEntity,
-			expectedBody:   "",
-			expectedReq:    business.OrderRequest{CouponCode: "invalid"},
+			expectedBody: `{"code":"unprocessable_entity","detail":"unprocessable entity: coupon not found","instance":"/api/order",` +
+				`"status":422,"title":"Unprocessable Entity","type":"urn:kart:problem:unprocessable_entity"}`,
+			expectedReq: business.OrderRequest{CouponCode: "invalid"},
+		},
+		{
+			name: "validation failed",
+			req:  map[string]any{"items": []map[string]any{{"productId": productID.Hex(), "quantity": 1}}},
+			mock: &mockBusiness{
+				createOrderResult: nil,
+				createOrderErr: validation.Violations{
+					{Pointer: "/items/0/productId", Code: aperr.CodeProductNotFound, Detail: "product not found"},
+				}.Err(aperr.ErrUnprocessableEntity, aperr.CodeValidationFailed),
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody: `{"code":"validation_failed","detail":"/items/0/productId product not found",` +
+				`"errors":[{"pointer":"/items/0/productId","code":"product_not_found","detail":"product not found"}],` +
+				`"instance":"/api/order","status":422,"title":"Unprocessable Entity","type":"urn:kart:problem:validation_failed"}`,
+			expectedReq: business.OrderRequest{Items: []mongo.ItemRequest{{ProductID: productID.Hex(), Quantity: 1}}},
 		},
 	}
 	for _, test := range testCases {
@@ -97,6 +129,9 @@ func TestCreateOrder(t *testing.T) {
 
 			require.Equal(t, test.expectedStatus, w.Code)
 			assert.Equal(t, test.expectedBody, w.Body.String())
+			if test.expectedStatus != http.StatusOK {
+				assert.Equal(t, sverr.ContentType, w.Header().Get("Content-Type"))
+			}
 			assert.Equal(t, test.expectedReq, test.mock.req)
 		})
 	}
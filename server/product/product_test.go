@@ -72,7 +72,7 @@ func TestListProduct(t *testing.T) {
 				listProductsErr:    errors.New("internal error"),
 			},
 			expectedStatus: http.StatusInternalServerError,
-			expectedBody:   "",
+			expectedBody:   `{"code":"internal_error","instance":"/api/product","status":500,"title":"Internal Server Error","type":"urn:kart:problem:internal_error"}`,
 			expectedPage:   1,
 		},
 	}
@@ -130,19 +130,22 @@ func TestGetProduct(t *testing.T) {
 				getProductErr:    fmt.Errorf("%w: something wrong", aperr.ErrBadRequest),
 			},
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   "",
-			expectedID:     "badid",
+			expectedBody: `{"code":"bad_request","detail":"bad request: something wrong","instance":"/api/product/badid",` +
+				`"status":400,"title":"Bad Request","type":"urn:kart:problem:bad_request"}`,
+			expectedID: "badid",
 		},
 		{
 			name:    "not found",
 			idParam: productID.Hex(),
 			mock: &mockProductDB{
 				getProductResult: nil,
-				getProductErr:    fmt.Errorf("%w: something wrong", aperr.ErrNotFound),
+				getProductErr: aperr.New(aperr.ErrNotFound, aperr.CodeProductNotFound, "product not found").
+					WithCause(errors.New("no documents")),
 			},
 			expectedStatus: http.StatusNotFound,
-			expectedBody:   "",
-			expectedID:     productID.Hex(),
+			expectedBody: fmt.Sprintf(`{"code":"product_not_found","detail":"product not found","instance":"/api/product/%s",`+
+				`"status":404,"title":"Not Found","type":"urn:kart:problem:product_not_found"}`, productID.Hex()),
+			expectedID: productID.Hex(),
 		},
 	}
 	for _, test := range testCases {
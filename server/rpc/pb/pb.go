@@ -0,0 +1,4 @@
+// Package pb contains the Go code generated from kart.proto, the gRPC API of kart.
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative kart.proto
@@ -0,0 +1,125 @@
+// Package rpc contains the gRPC services of the products and the orders, for the internal services.
+// They sit on the same interfaces as the HTTP requests handlers.
+package rpc
+
+import (
+	"context"
+
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/business"
+	"github.com/y7ls8i/kart/server/order"
+	"github.com/y7ls8i/kart/server/product"
+	"github.com/y7ls8i/kart/server/rpc/pb"
+	"google.golang.org/grpc"
+)
+
+// DB is the interface for the database layer that is required by the gRPC services.
+type DB interface {
+	product.DB
+	GetOrder(ctx context.Context, id string) (*mongo.Order, error)
+	FindProducts(ctx context.Context, ids []string) (missing []string, products []mongo.Product, err error)
+}
+
+// Business is the interface for the business layer that is required by the gRPC services.
+type Business interface {
+	order.Business
+}
+
+// Register registers the product and order services on s.
+func Register(s grpc.ServiceRegistrar, db DB, buss Business) {
+	pb.RegisterProductServiceServer(s, &productService{db: db})
+	pb.RegisterOrderServiceServer(s, &orderService{db: db, buss: buss})
+}
+
+type productService struct {
+	pb.UnimplementedProductServiceServer
+	db DB
+}
+
+// List returns a list of products.
+func (s *productService) List(ctx context.Context, req *pb.ListProductsRequest) (*pb.ListProductsResponse, error) {
+	products, err := s.db.ListProducts(ctx, int(req.GetPage()))
+	if err != nil {
+		return nil, Status(ctx, err, "Error listing products")
+	}
+	return &pb.ListProductsResponse{Products: toProducts(products)}, nil
+}
+
+// Get returns a single product by ID.
+func (s *productService) Get(ctx context.Context, req *pb.GetProductRequest) (*pb.Product, error) {
+	product, err := s.db.GetProduct(ctx, req.GetId())
+	if err != nil {
+		return nil, Status(ctx, err, "Error getting product")
+	}
+	return toProduct(product), nil
+}
+
+type orderService struct {
+	pb.UnimplementedOrderServiceServer
+	db   DB
+	buss Business
+}
+
+// Create creates a new order.
+func (s *orderService) Create(ctx context.Context, req *pb.CreateOrderRequest) (*pb.Order, error) {
+	orderReq := business.OrderRequest{
+		Items:      make([]mongo.ItemRequest, 0, len(req.GetItems())),
+		CouponCode: req.GetCouponCode(),
+	}
+	for _, item := range req.GetItems() {
+		orderReq.Items = append(orderReq.Items, mongo.ItemRequest{ProductID: item.GetProductId(), Quantity: int(item.GetQuantity())})
+	}
+
+	order, err := s.buss.CreateOrder(ctx, orderReq)
+	if err != nil {
+		return nil, Status(ctx, err, "Error creating order")
+	}
+	return toOrder(order.Order, order.Products), nil
+}
+
+// Get returns a single order by ID, with its products.
+func (s *orderService) Get(ctx context.Context, req *pb.GetOrderRequest) (*pb.Order, error) {
+	order, err := s.db.GetOrder(ctx, req.GetId())
+	if err != nil {
+		return nil, Status(ctx, err, "Error getting order")
+	}
+
+	ids := make([]string, 0, len(order.Items))
+	for _, item := range order.Items {
+		ids = append(ids, item.ProductID.Hex())
+	}
+	_, products, err := s.db.FindProducts(ctx, ids)
+	if err != nil {
+		return nil, Status(ctx, err, "Error finding order products")
+	}
+	return toOrder(order, products), nil
+}
+
+func toProduct(product *mongo.Product) *pb.Product {
+	return &pb.Product{
+		Id:       product.ID.Hex(),
+		Category: product.Category,
+		Name:     product.Name,
+		Price:    product.Price,
+	}
+}
+
+func toProducts(products []mongo.Product) []*pb.Product {
+	result := make([]*pb.Product, 0, len(products))
+	for i := range products {
+		result = append(result, toProduct(&products[i]))
+	}
+	return result
+}
+
+func toOrder(order *mongo.Order, products []mongo.Product) *pb.Order {
+	items := make([]*pb.OrderItem, 0, len(order.Items))
+	for _, item := range order.Items {
+		items = append(items, &pb.OrderItem{ProductId: item.ProductID.Hex(), Quantity: int32(item.Quantity)})
+	}
+	return &pb.Order{
+		Id:       order.ID.Hex(),
+		Items:    items,
+		Products: toProducts(products),
+	}
+}
@@ -0,0 +1,250 @@
+package rpc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/business"
+	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/server/rpc"
+	"github.com/y7ls8i/kart/server/rpc/pb"
+	"github.com/y7ls8i/kart/validation"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// dial serves the gRPC services in memory and returns a client connection to them.
+func dial(t *testing.T, db rpc.DB, buss rpc.Business) *grpc.ClientConn {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	rpc.Register(s, db, buss)
+	go func() {
+		_ = s.Serve(listener)
+	}()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return conn
+}
+
+func TestProductService(t *testing.T) {
+	productID := bson.NewObjectID()
+
+	testCases := []struct {
+		name            string
+		mock            *mockDB
+		expectedProduct *pb.Product
+		expectedCode    codes.Code
+		expectedMessage string
+		expectedReason  string
+	}{
+		{
+			name:            "success",
+			mock:            &mockDB{getProductResult: &mongo.Product{ID: productID, Name: "product1", Price: 3.5}},
+			expectedProduct: &pb.Product{Id: productID.Hex(), Name: "product1", Price: 3.5},
+			expectedCode:    codes.OK,
+		},
+		{
+			name:            "not found",
+			mock:            &mockDB{getProductErr: aperr.New(aperr.ErrNotFound, aperr.CodeProductNotFound, "product not found")},
+			expectedCode:    codes.NotFound,
+			expectedMessage: "product not found",
+			expectedReason:  aperr.CodeProductNotFound,
+		},
+		{
+			name:            "bad request",
+			mock:            &mockDB{getProductErr: fmt.Errorf("%w: something wrong", aperr.ErrBadRequest)},
+			expectedCode:    codes.InvalidArgument,
+			expectedMessage: "bad request: something wrong",
+			expectedReason:  aperr.CodeBadRequest,
+		},
+		{
+			name:            "internal error",
+			mock:            &mockDB{getProductErr: errors.New("connection lost")},
+			expectedCode:    codes.Internal,
+			expectedMessage: "internal error",
+			expectedReason:  aperr.CodeInternal,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := pb.NewProductServiceClient(dial(t, test.mock, &mockBusiness{}))
+			product, err := client.Get(context.Background(), &pb.GetProductRequest{Id: productID.Hex()})
+
+			st := status.Convert(err)
+			require.Equal(t, test.expectedCode, st.Code())
+			assert.Equal(t, productID.Hex(), test.mock.id)
+			if test.expectedCode == codes.OK {
+				assert.True(t, proto.Equal(test.expectedProduct, product))
+				return
+			}
+			assert.Equal(t, test.expectedMessage, st.Message())
+			require.Len(t, st.Details(), 1)
+			assert.Equal(t, test.expectedReason, st.Details()[0].(*errdetails.ErrorInfo).GetReason())
+		})
+	}
+}
+
+func TestProductService_List(t *testing.T) {
+	productID := bson.NewObjectID()
+	mock := &mockDB{listProductsResult: []mongo.Product{{ID: productID, Category: "Cake", Name: "product1"}}}
+	client := pb.NewProductServiceClient(dial(t, mock, &mockBusiness{}))
+
+	resp, err := client.List(context.Background(), &pb.ListProductsRequest{Page: 3})
+	require.NoError(t, err)
+	assert.Equal(t, 3, mock.page)
+	require.Len(t, resp.GetProducts(), 1)
+	assert.True(t, proto.Equal(&pb.Product{Id: productID.Hex(), Category: "Cake", Name: "product1"}, resp.GetProducts()[0]))
+}
+
+func TestOrderService_Create(t *testing.T) {
+	productID := bson.NewObjectID()
+	orderID := bson.NewObjectID()
+
+	t.Run("success", func(t *testing.T) {
+		buss := &mockBusiness{createOrderResult: &business.Order{
+			Order:    &mongo.Order{ID: orderID, Items: []mongo.OrderItem{{ProductID: productID, Quantity: 2}}},
+			Products: []mongo.Product{{ID: productID, Name: "product1"}},
+		}}
+		client := pb.NewOrderServiceClient(dial(t, &mockDB{}, buss))
+
+		order, err := client.Create(context.Background(), &pb.CreateOrderRequest{
+			Items:      []*pb.ItemRequest{{ProductId: productID.Hex(), Quantity: 2}},
+			CouponCode: "HAPPYHRS",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, business.OrderRequest{
+			Items:      []mongo.ItemRequest{{ProductID: productID.Hex(), Quantity: 2}},
+			CouponCode: "HAPPYHRS",
+		}, buss.req)
+		assert.True(t, proto.Equal(&pb.Order{
+			Id:       orderID.Hex(),
+			Items:    []*pb.OrderItem{{ProductId: productID.Hex(), Quantity: 2}},
+			Products: []*pb.Product{{Id: productID.Hex(), Name: "product1"}},
+		}, order))
+	})
+
+	t.Run("validation failed", func(t *testing.T) {
+		var violations validation.Violations
+		violations.Add("/items/0/productId", aperr.CodeProductNotFound, "product not found")
+		violations.Add("/couponCode", aperr.CodeCouponNotFound, "coupon not found")
+		buss := &mockBusiness{createOrderErr: violations.Problem(aperr.ErrUnprocessableEntity, aperr.CodeValidationFailed).
+			With("missingProductIds", []string{productID.Hex()})}
+		client := pb.NewOrderServiceClient(dial(t, &mockDB{}, buss))
+
+		_, err := client.Create(context.Background(), &pb.CreateOrderRequest{
+			Items: []*pb.ItemRequest{{ProductId: productID.Hex(), Quantity: 1}},
+		})
+		st := status.Convert(err)
+		require.Equal(t, codes.InvalidArgument, st.Code())
+		assert.Equal(t, "/items/0/productId product not found; /couponCode coupon not found", st.Message())
+		require.Len(t, st.Details(), 2)
+		assert.True(t, proto.Equal(&errdetails.ErrorInfo{
+			Reason:   aperr.CodeValidationFailed,
+			Domain:   rpc.Domain,
+			Metadata: map[string]string{"missingProductIds": fmt.Sprintf(`[%q]`, productID.Hex())},
+		}, st.Details()[0].(*errdetails.ErrorInfo)))
+		assert.True(t, proto.Equal(&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: "items[0].product_id", Description: "product not found", Reason: aperr.CodeProductNotFound},
+			{Field: "coupon_code", Description: "coupon not found", Reason: aperr.CodeCouponNotFound},
+		}}, st.Details()[1].(*errdetails.BadRequest)))
+	})
+}
+
+func TestOrderService_Get(t *testing.T) {
+	productID := bson.NewObjectID()
+	orderID := bson.NewObjectID()
+
+	t.Run("success", func(t *testing.T) {
+		mock := &mockDB{
+			getOrderResult:     &mongo.Order{ID: orderID, Items: []mongo.OrderItem{{ProductID: productID, Quantity: 1}}},
+			findProductsResult: []mongo.Product{{ID: productID, Name: "product1"}},
+		}
+		client := pb.NewOrderServiceClient(dial(t, mock, &mockBusiness{}))
+
+		order, err := client.Get(context.Background(), &pb.GetOrderRequest{Id: orderID.Hex()})
+		require.NoError(t, err)
+		assert.Equal(t, orderID.Hex(), mock.id)
+		assert.Equal(t, []string{productID.Hex()}, mock.ids)
+		assert.True(t, proto.Equal(&pb.Order{
+			Id:       orderID.Hex(),
+			Items:    []*pb.OrderItem{{ProductId: productID.Hex(), Quantity: 1}},
+			Products: []*pb.Product{{Id: productID.Hex(), Name: "product1"}},
+		}, order))
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mock := &mockDB{getOrderErr: aperr.New(aperr.ErrNotFound, aperr.CodeOrderNotFound, "order not found")}
+		client := pb.NewOrderServiceClient(dial(t, mock, &mockBusiness{}))
+
+		_, err := client.Get(context.Background(), &pb.GetOrderRequest{Id: orderID.Hex()})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
+
+type mockDB struct {
+	listProductsResult []mongo.Product
+	getProductResult   *mongo.Product
+	getProductErr      error
+	getOrderResult     *mongo.Order
+	getOrderErr        error
+	findProductsResult []mongo.Product
+	page               int
+	id                 string
+	ids                []string
+}
+
+func (m *mockDB) ListProducts(_ context.Context, page int) ([]mongo.Product, error) {
+	m.page = page
+	return m.listProductsResult, nil
+}
+
+func (m *mockDB) GetProduct(_ context.Context, id string) (*mongo.Product, error) {
+	m.id = id
+	return m.getProductResult, m.getProductErr
+}
+
+func (m *mockDB) GetOrder(_ context.Context, id string) (*mongo.Order, error) {
+	m.id = id
+	return m.getOrderResult, m.getOrderErr
+}
+
+func (m *mockDB) FindProducts(_ context.Context, ids []string) ([]string, []mongo.Product, error) {
+	m.ids = ids
+	return nil, m.findProductsResult, nil
+}
+
+type mockBusiness struct {
+	createOrderResult *business.Order
+	createOrderErr    error
+	req               business.OrderRequest
+}
+
+func (m *mockBusiness) CreateOrder(_ context.Context, req business.OrderRequest) (*business.Order, error) {
+	m.req = req
+	return m.createOrderResult, m.createOrderErr
+}
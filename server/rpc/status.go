@@ -0,0 +1,133 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+
+	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/logger"
+	"github.com/y7ls8i/kart/validation"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Domain is the domain of the google.rpc.ErrorInfo details of the errors.
+const Domain = "kart"
+
+// kinds maps the sentinel errors to their gRPC code and default error code.
+var kinds = []struct {
+	err      error
+	grpcCode codes.Code
+	code     string
+}{
+	{aperr.ErrNotFound, codes.NotFound, aperr.CodeNotFound},
+	{aperr.ErrBadRequest, codes.InvalidArgument, aperr.CodeBadRequest},
+	{aperr.ErrUnprocessableEntity, codes.InvalidArgument, aperr.CodeUnprocessableEntity},
+	{aperr.ErrUnauthorized, codes.Unauthenticated, aperr.CodeUnauthorized},
+	{aperr.ErrTooLarge, codes.ResourceExhausted, aperr.CodeTooLarge},
+	{aperr.ErrTooManyRequests, codes.ResourceExhausted, aperr.CodeTooManyRequests},
+}
+
+// Status returns the gRPC status error of err.
+// The error code is the reason of the google.rpc.ErrorInfo details, with the extensions of the error in its metadata,
+// and the validation violations are google.rpc.BadRequest details.
+// The errors that are not one of the aperr sentinel errors are logged with the message log and reported as an
+// internal error without details.
+func Status(ctx context.Context, err error, log string) error {
+	grpcCode, code, detail := codes.Internal, aperr.CodeInternal, "internal error"
+	for _, kind := range kinds {
+		if errors.Is(err, kind.err) {
+			grpcCode, code, detail = kind.grpcCode, kind.code, err.Error()
+			break
+		}
+	}
+	if grpcCode == codes.Internal {
+		logger.FromContext(ctx).Error(log, "error", err)
+	}
+
+	info := &errdetails.ErrorInfo{Domain: Domain}
+	var badRequest *errdetails.BadRequest
+	var apErr *aperr.Error
+	if grpcCode != codes.Internal && errors.As(err, &apErr) {
+		if apErr.Code != "" {
+			code = apErr.Code
+		}
+		detail = apErr.Detail
+		for k, v := range apErr.Extensions {
+			if violations, ok := v.([]validation.Violation); ok && k == "errors" {
+				badRequest = toBadRequest(violations)
+				continue
+			}
+			if info.Metadata == nil {
+				info.Metadata = map[string]string{}
+			}
+			info.Metadata[k] = metadataValue(v)
+		}
+	}
+	info.Reason = code
+
+	st, withErr := status.New(grpcCode, detail).WithDetails(info)
+	if withErr != nil {
+		logger.FromContext(ctx).Error("Error adding status details", "error", withErr)
+		return status.Error(grpcCode, detail)
+	}
+	if badRequest != nil {
+		if withBadRequest, withErr := st.WithDetails(badRequest); withErr == nil {
+			st = withBadRequest
+		}
+	}
+	return st.Err()
+}
+
+// metadataValue returns the ErrorInfo metadata value of an extension: strings as they are, the other values as JSON.
+func metadataValue(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func toBadRequest(violations []validation.Violation) *errdetails.BadRequest {
+	badRequest := &errdetails.BadRequest{}
+	for _, violation := range violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       fieldPath(violation.Pointer),
+			Description: violation.Detail,
+			Reason:      violation.Code,
+		})
+	}
+	return badRequest
+}
+
+// fieldPath returns the path of the protobuf field of a JSON pointer of the request body, e.g. items[2].product_id
+// for /items/2/productId.
+func fieldPath(pointer string) string {
+	var b strings.Builder
+	for _, token := range strings.Split(pointer, "/")[1:] {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		if _, err := strconv.Atoi(token); err == nil {
+			b.WriteString("[" + token + "]")
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		for _, r := range token {
+			if unicode.IsUpper(r) {
+				b.WriteByte('_')
+				r = unicode.ToLower(r)
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
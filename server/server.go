@@ -3,37 +3,71 @@ package server
 
 import (
 	"context"
+	"crypto/subtle"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/y7ls8i/kart/business"
 	"github.com/y7ls8i/kart/config"
+	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/metrics"
+	"github.com/y7ls8i/kart/server/coupon"
+	"github.com/y7ls8i/kart/server/graphql"
+	"github.com/y7ls8i/kart/server/health"
+	"github.com/y7ls8i/kart/server/openapi"
 	"github.com/y7ls8i/kart/server/order"
 	"github.com/y7ls8i/kart/server/product"
+	"github.com/y7ls8i/kart/server/rpc"
+	"github.com/y7ls8i/kart/server/sverr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 )
 
+// DefaultShutdownTimeout is the shutdown timeout used when the config does not set one.
+const DefaultShutdownTimeout = 5 * time.Second
+
 // DB is the interface for the database layer.
 type DB interface {
 	product.DB
+	graphql.DB
+	rpc.DB
+	health.DB
 }
 
 // Business is the interface for the business layer.
 type Business interface {
 	order.Business
+	coupon.Business
+	graphql.Business
+	rpc.Business
 }
 
 // Server is the server struct.
 type Server struct {
 	config config.Server
 	router *gin.Engine
+	grpc   *grpc.Server
 	db     DB
 	buss   Business
+	health *health.Health
+
+	settings    atomic.Pointer[settings]
+	certificate atomic.Pointer[tls.Certificate]
+	workers     []func(ctx context.Context)
 }
 
 // NewServer creates a new server.
@@ -42,7 +76,12 @@ func NewServer(config config.Server, db DB, buss Business) *Server {
 		config: config,
 		db:     db,
 		buss:   buss,
+		health: health.NewHealth(db),
 	}
+	server.settings.Store(&settings{
+		corsOrigins: slices.Clone(config.CORSOrigins),
+		limiter:     newRateLimiter(config.RateLimit, config.RateBurst),
+	})
 
 	switch server.config.Mode {
 	case gin.DebugMode, gin.TestMode:
@@ -50,70 +89,280 @@ func NewServer(config config.Server, db DB, buss Business) *Server {
 	default:
 		gin.SetMode(gin.ReleaseMode)
 	}
-	server.router = gin.Default()
+	server.router = gin.New()
+	// let handlers pass *gin.Context down as context.Context and keep the request-scoped values
+	server.router.ContextWithFallback = true
+	// the client IP address is the peer address, unless the peer is a trusted proxy
+	if err := server.router.SetTrustedProxies(server.config.TrustedProxies); err != nil {
+		// the proxies are checked by config.Validate
+		panic(err)
+	}
 
-	server.router.Use(AuthMiddleware())
+	server.router.Use(RequestLogger(), Tracing(), Metrics(), gin.Recovery(), server.CORS(), ClientContext())
 
 	// setup routes
+	server.router.GET("/metrics", gin.WrapH(metrics.Handler()))
+	server.router.GET("/healthz", server.health.Live)
+	server.router.GET("/readyz", server.health.Ready)
+	server.router.GET("/openapi.json", openapi.Handler)
+
+	api := server.router.Group("/api", server.RateLimit(), server.AuthMiddleware(), BodyLimit(server.config.MaxBodyBytes))
+	if server.config.OpenAPIValidation {
+		// the responses are validated too in test mode
+		validator, err := openapi.Validator(server.config.Mode == gin.TestMode)
+		if err != nil {
+			// the document is embedded, and checked by the tests
+			panic(err)
+		}
+		api.Use(validator)
+	}
 	productHandler := product.NewProduct(server.db)
 	orderHandler := order.NewOrder(server.buss)
-	server.router.GET("/api/product", productHandler.List)
-	server.router.GET("/api/product/:id", productHandler.Get)
-	server.router.POST("/api/order", orderHandler.Create)
+	couponHandler := coupon.NewCoupon(server.buss)
+	api.GET("/product", productHandler.List)
+	api.GET("/product/:id", productHandler.Get)
+	api.POST("/order", orderHandler.Create)
+	api.GET("/coupon/:code", couponHandler.Get)
+	api.POST("/coupon/:code/preview", couponHandler.Preview)
+
+	graphqlHandler, err := graphql.NewGraphQL(server.db, server.buss)
+	if err != nil {
+		// the schema is embedded, and checked by the tests
+		panic(err)
+	}
+	server.router.POST("/graphql", server.RateLimit(), server.AuthMiddleware(), BodyLimit(server.config.MaxBodyBytes), graphqlHandler.Handle)
+
+	// an unknown route is not revealed to the callers without an API key, who get 401 as on the API routes
+	server.router.NoRoute(server.AuthMiddleware(), func(c *gin.Context) {
+		sverr.Abort(c, aperr.New(aperr.ErrNotFound, aperr.CodeRouteNotFound, "no route for "+c.Request.URL.Path), "")
+	})
+
+	var grpcOptions []grpc.ServerOption
+	if len(server.config.Certfile) > 0 && len(server.config.Keyfile) > 0 {
+		grpcOptions = append(grpcOptions, grpc.Creds(credentials.NewTLS(&tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: server.getCertificate,
+		})))
+	}
+	grpcOptions = append(grpcOptions, grpc.ChainUnaryInterceptor(server.GRPCAuthInterceptor, GRPCClientInterceptor))
+	server.grpc = grpc.NewServer(grpcOptions...)
+	rpc.Register(server.grpc, server.db, server.buss)
 
 	return server
 }
 
-// Start starts listening for HTTP requests
-func (s *Server) Start(ctx context.Context) {
+// Routes returns the routes registered by NewServer.
+func (s *Server) Routes() gin.RoutesInfo {
+	return s.router.Routes()
+}
+
+// ServeHTTP serves an HTTP request with the server routes, so that the server can be used as an http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+// ServeGRPC serves the gRPC API on listener until the server is shut down.
+func (s *Server) ServeGRPC(listener net.Listener) error {
+	return s.grpc.Serve(listener)
+}
+
+// AddWorker registers a background worker that runs while the server is running.
+// The worker must return when its context is done; it is stopped after the in-flight requests are drained.
+// AddWorker must be called before Start.
+func (s *Server) AddWorker(worker func(ctx context.Context)) {
+	s.workers = append(s.workers, worker)
+}
+
+// Start starts listening for HTTP requests, and gRPC requests if GRPCListen is set, and blocks until ctx is done, the
+// process receives SIGINT or SIGTERM, or the server fails. It returns an error if the server cannot start or does not
+// shut down cleanly.
+func (s *Server) Start(ctx context.Context) error {
 	srv := &http.Server{
 		Addr:    s.config.Listen,
 		Handler: s.router.Handler(),
 		TLSConfig: &tls.Config{
-			MinVersion: tls.VersionTLS12, // TLS 1.2 or higher
+			MinVersion:     tls.VersionTLS12, // TLS 1.2 or higher
+			GetCertificate: s.getCertificate, // the certificate can be reloaded
 		},
+		ReadHeaderTimeout: s.config.ReadHeaderTimeout,
+		ReadTimeout:       s.config.ReadTimeout,
+		WriteTimeout:      s.config.WriteTimeout,
+		IdleTimeout:       s.config.IdleTimeout,
+		MaxHeaderBytes:    s.config.MaxHeaderBytes,
+	}
+
+	useTLS := len(s.config.Certfile) > 0 && len(s.config.Keyfile) > 0
+	if useTLS {
+		if err := s.loadCertificate(s.config.Certfile, s.config.Keyfile); err != nil {
+			return fmt.Errorf("error starting HTTPS server: %w", err)
+		}
+	}
+
+	// listen before serving, so that an address already in use is reported to the caller
+	listener, err := net.Listen("tcp", s.config.Listen)
+	if err != nil {
+		return fmt.Errorf("error starting HTTP server: %w", err)
+	}
+	var grpcListener net.Listener
+	if s.config.GRPCListen != "" {
+		grpcListener, err = net.Listen("tcp", s.config.GRPCListen)
+		if err != nil {
+			_ = listener.Close()
+			return fmt.Errorf("error starting gRPC server: %w", err)
+		}
 	}
+	slog.Info("Server listening", "listen", listener.Addr().String(), "tls", useTLS)
 
 	// start server
+	serveErr := make(chan error, 2)
 	go func() {
-		if len(s.config.Certfile) > 0 && len(s.config.Keyfile) > 0 {
-			if err := srv.ListenAndServeTLS(s.config.Certfile, s.config.Keyfile); err != nil && !errors.Is(err, http.ErrServerClosed) {
-				slog.Error("Error starting HTTPS server", "error", err, "listen", s.config.Listen)
-				os.Exit(1)
-			}
+		var err error
+		if useTLS {
+			err = srv.ServeTLS(listener, "", "")
 		} else {
-			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-				slog.Error("Error starting HTTP server", "error", err, "listen", s.config.Listen)
-				os.Exit(1)
-			}
+			err = srv.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- fmt.Errorf("error serving HTTP: %w", err)
 		}
 	}()
+	if grpcListener != nil {
+		slog.Info("gRPC server listening", "listen", grpcListener.Addr().String(), "tls", useTLS)
+		go func() {
+			if err := s.ServeGRPC(grpcListener); err != nil {
+				serveErr <- fmt.Errorf("error serving gRPC: %w", err)
+			}
+		}()
+	}
+
+	// start background workers
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	workers := &sync.WaitGroup{}
+	for _, worker := range s.workers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			worker(workersCtx)
+		}()
+	}
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
 	select {
 	case <-ctx.Done():
 	case <-quit:
+	case err = <-serveErr:
 	}
+
+	return errors.Join(err, s.shutdown(srv, stopWorkers, workers))
+}
+
+// shutdown stops the server in order: the readiness probe fails first and the load balancers are given DrainDelay
+// to stop sending traffic, then the in-flight requests are drained, and finally the background workers are stopped.
+// Draining and stopping share ShutdownTimeout.
+func (s *Server) shutdown(srv *http.Server, stopWorkers context.CancelFunc, workers *sync.WaitGroup) error {
 	slog.Info("Shutting down server")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	s.health.Drain()
+	if s.config.DrainDelay > 0 {
+		slog.Info("Draining traffic", "delay", s.config.DrainDelay)
+		time.Sleep(s.config.DrainDelay)
+	}
+
+	timeout := s.config.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
+
+	var errs []error
 	if err := srv.Shutdown(ctx); err != nil {
-		slog.Error("Server Shutdown:", "error", err)
+		errs = append(errs, fmt.Errorf("error draining in-flight requests: %w", err))
+		_ = srv.Close()
 	}
+	grpcStopped := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(grpcStopped)
+	}()
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("error draining in-flight gRPC calls: %w", ctx.Err()))
+		s.grpc.Stop()
+	}
+
+	stopWorkers()
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("error stopping background workers: %w", ctx.Err()))
+	}
+
+	return errors.Join(errs...)
 }
 
 // AuthMiddleware is a middleware that checks if the request has the correct API key.
-// The key is hardcoded for this exercise.
-func AuthMiddleware() gin.HandlerFunc {
+func (s *Server) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Api_key")
 
-		if authHeader != "apitest" {
-			c.AbortWithStatus(http.StatusUnauthorized)
+		if !s.validAPIKey(authHeader) {
+			sverr.Abort(c, aperr.New(aperr.ErrUnauthorized, aperr.CodeUnauthorized, "missing or invalid API key"), "")
 			return
 		}
 
 		c.Next()
 	}
 }
+
+// GRPCAuthInterceptor is a gRPC interceptor that checks if the call has the correct API key in its api_key metadata,
+// like AuthMiddleware does for the HTTP requests.
+func (s *Server) GRPCAuthInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if keys := md.Get("api_key"); len(keys) != 1 || !s.validAPIKey(keys[0]) {
+		return nil, rpc.Status(ctx, aperr.New(aperr.ErrUnauthorized, aperr.CodeUnauthorized, "missing or invalid API key"), "")
+	}
+	return handler(ctx, req)
+}
+
+// GRPCClientInterceptor is a gRPC interceptor that attaches the IP of the peer to the call context, like
+// ClientContext does for the HTTP requests.
+func GRPCClientInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		client := p.Addr.String()
+		if host, _, err := net.SplitHostPort(client); err == nil {
+			client = host
+		}
+		ctx = business.WithClient(ctx, client)
+	}
+	return handler(ctx, req)
+}
+
+// DevelopmentAPIKey is the API key accepted when the config has no APIKeys, in the debug and test modes only.
+const DevelopmentAPIKey = "apitest"
+
+// validAPIKey reports whether key is one of the API keys of the config, or the development key if there is none and
+// the server is not in release mode, which then rejects every key.
+func (s *Server) validAPIKey(key string) bool {
+	keys := s.config.APIKeys
+	if len(keys) == 0 && s.config.Mode != gin.ReleaseMode {
+		keys = []string{DevelopmentAPIKey}
+	}
+	valid := false
+	for _, k := range keys {
+		// compare every key in constant time, so the timing does not tell which key is close
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
@@ -0,0 +1,464 @@
+package server_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/adapter/mongo"
+	"github.com/y7ls8i/kart/business"
+	"github.com/y7ls8i/kart/config"
+	"github.com/y7ls8i/kart/server"
+	"github.com/y7ls8i/kart/server/openapi"
+	"github.com/y7ls8i/kart/server/rpc/pb"
+	"github.com/y7ls8i/kart/server/sverr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func newTestServer(t *testing.T) *server.Server {
+	t.Helper()
+	return server.NewServer(config.Server{Mode: "test"}, &mockDB{}, &mockBusiness{})
+}
+
+func TestMetrics(t *testing.T) {
+	s := newTestServer(t)
+
+	req := httptest.NewRequest("GET", "/api/product", nil)
+	req.Header.Set("Api_key", "apitest")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// metrics are not behind the API key
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	body, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `kart_http_requests_total{method="GET",route="/api/product",status="200"} `)
+	assert.Contains(t, string(body), `kart_http_request_duration_seconds_bucket{method="GET",route="/api/product",status="200",le="+Inf"} `)
+}
+
+func TestProbes(t *testing.T) {
+	s := newTestServer(t)
+
+	// probes are not behind the API key
+	for _, path := range []string{"/healthz", "/readyz"} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusOK, w.Code, path)
+	}
+}
+
+func TestStart(t *testing.T) {
+	t.Run("address in use", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer func() {
+			_ = listener.Close()
+		}()
+
+		s := server.NewServer(config.Server{Mode: "test", Listen: listener.Addr().String()}, &mockDB{}, &mockBusiness{})
+		err = s.Start(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "error starting HTTP server")
+		assert.Contains(t, err.Error(), "address already in use")
+	})
+
+	t.Run("gRPC address in use", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer func() {
+			_ = listener.Close()
+		}()
+
+		s := server.NewServer(config.Server{Mode: "test", Listen: "127.0.0.1:0", GRPCListen: listener.Addr().String()}, &mockDB{}, &mockBusiness{})
+		err = s.Start(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "error starting gRPC server")
+	})
+
+	t.Run("shutdown stops workers", func(t *testing.T) {
+		s := server.NewServer(config.Server{Mode: "test", Listen: "127.0.0.1:0"}, &mockDB{}, &mockBusiness{})
+
+		workerStopped := make(chan struct{})
+		s.AddWorker(func(ctx context.Context) {
+			<-ctx.Done()
+			close(workerStopped)
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- s.Start(ctx)
+		}()
+		cancel()
+
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("server did not shut down")
+		}
+		select {
+		case <-workerStopped:
+		default:
+			t.Fatal("worker was not stopped")
+		}
+	})
+
+	t.Run("worker stuck", func(t *testing.T) {
+		s := server.NewServer(config.Server{Mode: "test", Listen: "127.0.0.1:0", ShutdownTimeout: 50 * time.Millisecond}, &mockDB{}, &mockBusiness{})
+
+		release := make(chan struct{})
+		defer close(release)
+		s.AddWorker(func(_ context.Context) {
+			<-release
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := s.Start(ctx)
+		require.Error(t, err)
+		assert.Equal(t, "error stopping background workers: context deadline exceeded", err.Error())
+	})
+}
+
+func TestGRPC(t *testing.T) {
+	s := newTestServer(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = s.ServeGRPC(listener)
+	}()
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+	client := pb.NewProductServiceClient(conn)
+
+	testCases := []struct {
+		name         string
+		apiKey       string
+		expectedCode codes.Code
+	}{
+		{name: "missing API key", expectedCode: codes.Unauthenticated},
+		{name: "invalid API key", apiKey: "wrong", expectedCode: codes.Unauthenticated},
+		{name: "valid API key", apiKey: "apitest", expectedCode: codes.OK},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.apiKey != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "api_key", test.apiKey)
+			}
+			_, err := client.List(ctx, &pb.ListProductsRequest{Page: 1})
+			assert.Equal(t, test.expectedCode, status.Code(err))
+		})
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	s := server.NewServer(config.Server{Mode: "test", MaxBodyBytes: 16}, &mockDB{}, &mockBusiness{})
+
+	testCases := []struct {
+		name           string
+		body           string
+		chunked        bool
+		expectedStatus int
+	}{
+		{name: "within limit", body: `{"items":[]}`, expectedStatus: http.StatusOK},
+		{name: "content length too large", body: `{"items":[],"couponCode":"abc"}`, expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "chunked too large", body: `{"items":[],"couponCode":"abc"}`, chunked: true, expectedStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/order", strings.NewReader(test.body))
+			if test.chunked {
+				req.ContentLength = -1
+			}
+			req.Header.Set("Api_key", "apitest")
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, req)
+			assert.Equal(t, test.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	testCases := []struct {
+		name           string
+		config         config.Server
+		apiKey         string
+		expectedStatus int
+	}{
+		{
+			name:           "configured key",
+			config:         config.Server{Mode: "test", APIKeys: []string{"key1", "key2"}},
+			apiKey:         "key2",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "development key with configured keys",
+			config:         config.Server{Mode: "test", APIKeys: []string{"key1", "key2"}},
+			apiKey:         server.DevelopmentAPIKey,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "prefix of a key",
+			config:         config.Server{Mode: "test", APIKeys: []string{"key1", "key2"}},
+			apiKey:         "key",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "development key without configured keys",
+			config:         config.Server{Mode: "debug"},
+			apiKey:         server.DevelopmentAPIKey,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "development key in release mode",
+			config:         config.Server{Mode: "release"},
+			apiKey:         server.DevelopmentAPIKey,
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			s := server.NewServer(test.config, &mockDB{}, &mockBusiness{})
+
+			req := httptest.NewRequest("GET", "/api/product", nil)
+			req.Header.Set("Api_key", test.apiKey)
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, req)
+
+			assert.Equal(t, test.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestProblems(t *testing.T) {
+	s := newTestServer(t)
+
+	testCases := []struct {
+		name           string
+		path           string
+		apiKey         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "unauthorized",
+			path:           "/api/product",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody: `{"code":"unauthorized","detail":"missing or invalid API key","instance":"/api/product","requestId":"req-1",` +
+				`"status":401,"title":"Unauthorized","type":"urn:kart:problem:unauthorized"}`,
+		},
+		{
+			name:           "unknown route without API key",
+			path:           "/unknown",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody: `{"code":"unauthorized","detail":"missing or invalid API key","instance":"/unknown","requestId":"req-1",` +
+				`"status":401,"title":"Unauthorized","type":"urn:kart:problem:unauthorized"}`,
+		},
+		{
+			name:           "unknown route",
+			path:           "/api/unknown",
+			apiKey:         "apitest",
+			expectedStatus: http.StatusNotFound,
+			expectedBody: `{"code":"route_not_found","detail":"no route for /api/unknown","instance":"/api/unknown","requestId":"req-1",` +
+				`"status":404,"title":"Not Found","type":"urn:kart:problem:route_not_found"}`,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", test.path, nil)
+			req.Header.Set("Api_key", test.apiKey)
+			req.Header.Set(server.HeaderRequestID, "req-1")
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, req)
+
+			assert.Equal(t, test.expectedStatus, w.Code)
+			assert.Equal(t, sverr.ContentType, w.Header().Get("Content-Type"))
+			assert.Equal(t, test.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestOpenAPI_routes(t *testing.T) {
+	doc, err := openapi.Load()
+	require.NoError(t, err)
+
+	registered := map[string]bool{}
+	for _, route := range newTestServer(t).Routes() {
+		path := openapi.Path(route.Path)
+		registered[route.Method+" "+path] = true
+
+		pathItem := doc.Paths.Value(path)
+		if !assert.NotNil(t, pathItem, "route %s %s is missing from the OpenAPI document", route.Method, route.Path) {
+			continue
+		}
+		assert.NotNil(t, pathItem.GetOperation(route.Method), "route %s %s is missing from the OpenAPI document", route.Method, route.Path)
+	}
+
+	for path, pathItem := range doc.Paths.Map() {
+		for method := range pathItem.Operations() {
+			assert.True(t, registered[method+" "+path], "operation %s %s of the OpenAPI document is not registered", method, path)
+		}
+	}
+}
+
+func TestOpenAPIValidation(t *testing.T) {
+	s := server.NewServer(config.Server{Mode: "test", OpenAPIValidation: true}, &mockDB{}, &mockBusiness{})
+
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "list products",
+			method:         "GET",
+			path:           "/api/product?page=2",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[]`,
+		},
+		{
+			name:           "invalid page",
+			method:         "GET",
+			path:           "/api/product?page=abc",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `"errors":[{"pointer":"","code":"invalid_value","detail":"query parameter \"page\": value abc: an invalid integer: invalid syntax"}]`,
+		},
+		{
+			name:           "get product",
+			method:         "GET",
+			path:           "/api/product/000000000000000000000000",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"id":"000000000000000000000000","category":"","name":"","price":0}`,
+		},
+		{
+			name:           "invalid product id",
+			method:         "GET",
+			path:           "/api/product/abc",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `"code":"invalid_request"`,
+		},
+		{
+			name:           "create order",
+			method:         "POST",
+			path:           "/api/order",
+			body:           `{"items":[{"productId":"000000000000000000000000","quantity":1}]}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"id":"000000000000000000000000","items":null,"products":null}`,
+		},
+		{
+			name:           "invalid order",
+			method:         "POST",
+			path:           "/api/order",
+			body:           `{"items":[{"productId":"000000000000000000000000","quantity":"1"}],"couponCode":1}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: `"errors":[{"pointer":"/couponCode","code":"invalid_type","detail":"value must be a string"},` +
+				`{"pointer":"/items/0/quantity","code":"invalid_type","detail":"value must be an integer"}]`,
+		},
+		{
+			name:           "check coupon",
+			method:         "GET",
+			path:           "/api/coupon/HAPPYHRS",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"code":"HAPPYHRS","valid":false}`,
+		},
+		{
+			name:           "preview coupon",
+			method:         "POST",
+			path:           "/api/coupon/HAPPYHRS/preview",
+			body:           `{"items":[{"productId":"000000000000000000000000","quantity":1}]}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"code":"HAPPYHRS","valid":false,"subtotal":0,"discount":0,"total":0}`,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			req.Header.Set("Api_key", "apitest")
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, req)
+
+			assert.Equal(t, test.expectedStatus, w.Code)
+			assert.Contains(t, w.Body.String(), test.expectedBody)
+		})
+	}
+
+	// the document is served without the API key
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"openapi": "3.0.3"`)
+}
+
+type mockDB struct{}
+
+func (m *mockDB) Ping(_ context.Context) error {
+	return nil
+}
+
+func (m *mockDB) CheckIndexes(_ context.Context) error {
+	return nil
+}
+
+func (m *mockDB) ListProducts(_ context.Context, _ int) ([]mongo.Product, error) {
+	return []mongo.Product{}, nil
+}
+
+func (m *mockDB) GetProduct(_ context.Context, _ string) (*mongo.Product, error) {
+	return &mongo.Product{}, nil
+}
+
+func (m *mockDB) SearchProducts(_ context.Context, _ mongo.ProductFilter, _ int) ([]mongo.Product, error) {
+	return []mongo.Product{}, nil
+}
+
+func (m *mockDB) FindProducts(_ context.Context, _ []string) ([]string, []mongo.Product, error) {
+	return nil, []mongo.Product{}, nil
+}
+
+func (m *mockDB) ListOrders(_ context.Context, _ int) ([]mongo.Order, error) {
+	return []mongo.Order{}, nil
+}
+
+func (m *mockDB) GetOrder(_ context.Context, _ string) (*mongo.Order, error) {
+	return &mongo.Order{}, nil
+}
+
+type mockBusiness struct{}
+
+func (m *mockBusiness) CreateOrder(_ context.Context, _ business.OrderRequest) (*business.Order, error) {
+	return &business.Order{Order: &mongo.Order{}}, nil
+}
+
+func (m *mockBusiness) CheckCoupon(_ context.Context, code string) (*business.CouponCheck, error) {
+	return &business.CouponCheck{Code: code}, nil
+}
+
+func (m *mockBusiness) PreviewCoupon(_ context.Context, code string, _ business.CouponPreviewRequest) (*business.CouponPreview, error) {
+	return &business.CouponPreview{CouponCheck: business.CouponCheck{Code: code}}, nil
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/y7ls8i/kart/config"
+	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/server/sverr"
+	"golang.org/x/time/rate"
+)
+
+// rateLimiterIdle is how long a client is remembered by the rate limiter after its last request.
+const rateLimiterIdle = 3 * time.Minute
+
+// settings are the server settings that can be changed while the server is running.
+type settings struct {
+	corsOrigins []string
+	limiter     *rateLimiter // nil when rate limiting is disabled
+}
+
+// Reload applies the reloadable settings of conf: the CORS origins, the rate limits and the TLS certificate.
+// If the TLS certificate cannot be loaded, the current certificate is kept and an error is returned.
+func (s *Server) Reload(conf config.Server) error {
+	current := s.settings.Load()
+	next := &settings{
+		corsOrigins: slices.Clone(conf.CORSOrigins),
+		limiter:     current.limiter,
+	}
+	// keep the clients' state unless the limits changed
+	if current.limiter == nil || current.limiter.limit != rate.Limit(conf.RateLimit) || current.limiter.burst != conf.RateBurst {
+		next.limiter = newRateLimiter(conf.RateLimit, conf.RateBurst)
+	}
+	s.settings.Store(next)
+
+	if conf.Certfile != "" && conf.Keyfile != "" {
+		if err := s.loadCertificate(conf.Certfile, conf.Keyfile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadCertificate loads the TLS certificate served to the new connections.
+func (s *Server) loadCertificate(certfile, keyfile string) error {
+	cert, err := tls.LoadX509KeyPair(certfile, keyfile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	s.certificate.Store(&cert)
+	slog.Info("TLS certificate loaded", "certfile", certfile)
+	return nil
+}
+
+// getCertificate returns the current TLS certificate; it is used as tls.Config.GetCertificate.
+func (s *Server) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert := s.certificate.Load()
+	if cert == nil {
+		return nil, fmt.Errorf("no TLS certificate loaded")
+	}
+	return cert, nil
+}
+
+// CORS is a middleware that allows the configured origins to call the API from a browser and answers the
+// preflight requests.
+func (s *Server) CORS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Origin")
+
+		origins := s.settings.Load().corsOrigins
+		if !slices.Contains(origins, "*") && !slices.Contains(origins, origin) {
+			c.Next()
+			return
+		}
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Access-Control-Expose-Headers", HeaderRequestID)
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			c.Header("Access-Control-Allow-Headers", strings.Join([]string{"Content-Type", "Api_key", HeaderRequestID, "traceparent"}, ", "))
+			c.Header("Access-Control-Max-Age", "600")
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RateLimit is a middleware that limits the number of requests per second of each client.
+func (s *Server) RateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limiter := s.settings.Load().limiter
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		if wait, ok := limiter.allow(c.ClientIP(), time.Now()); !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			sverr.Abort(c, aperr.New(aperr.ErrTooManyRequests, aperr.CodeTooManyRequests, "rate limit exceeded").
+				With("retryAfter", retryAfter), "")
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimiter is a token bucket per client.
+type rateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	clients   map[string]*rateClient
+	lastSweep time.Time
+}
+
+type rateClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newRateLimiter returns a rate limiter of perSecond requests per second per client, or nil if perSecond is 0.
+func newRateLimiter(perSecond float64, burst int) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		limit:   rate.Limit(perSecond),
+		burst:   burst,
+		clients: map[string]*rateClient{},
+	}
+}
+
+// allow reports whether the client may make a request now, and if not, how long it should wait.
+func (l *rateLimiter) allow(key string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > rateLimiterIdle {
+		for k, c := range l.clients {
+			if now.Sub(c.lastSeen) > rateLimiterIdle {
+				delete(l.clients, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	c, ok := l.clients[key]
+	if !ok {
+		c = &rateClient{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[key] = c
+	}
+	c.lastSeen = now
+
+	r := c.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return delay, false
+	}
+	return 0, true
+}
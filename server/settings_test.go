@@ -0,0 +1,110 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/config"
+	"github.com/y7ls8i/kart/server"
+)
+
+func TestCORS(t *testing.T) {
+	s := server.NewServer(config.Server{Mode: "test", CORSOrigins: []string{"https://shop.example.com"}}, &mockDB{}, &mockBusiness{})
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("OPTIONS", "/api/order", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("allowed origin", func(t *testing.T) {
+		w := preflight("https://shop.example.com")
+		require.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "https://shop.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "Api_key")
+	})
+
+	t.Run("other origin", func(t *testing.T) {
+		w := preflight("https://evil.example.com")
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("reloaded", func(t *testing.T) {
+		require.NoError(t, s.Reload(config.Server{CORSOrigins: []string{"https://evil.example.com"}}))
+
+		assert.Empty(t, preflight("https://shop.example.com").Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "https://evil.example.com", preflight("https://evil.example.com").Header().Get("Access-Control-Allow-Origin"))
+	})
+}
+
+func TestRateLimit(t *testing.T) {
+	s := server.NewServer(config.Server{Mode: "test", RateLimit: 0.001, RateBurst: 2}, &mockDB{}, &mockBusiness{})
+
+	get := func(clientIP string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/product", nil)
+		req.RemoteAddr = clientIP + ":1234"
+		req.Header.Set("Api_key", "apitest")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, get("10.0.0.1").Code)
+	assert.Equal(t, http.StatusOK, get("10.0.0.1").Code)
+	w := get("10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// other clients have their own bucket
+	assert.Equal(t, http.StatusOK, get("10.0.0.2").Code)
+
+	// probes are not rate limited
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest("GET", "/healthz", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		rw := httptest.NewRecorder()
+		s.ServeHTTP(rw, r)
+		assert.Equal(t, http.StatusOK, rw.Code)
+	}
+
+	// disabled on reload
+	require.NoError(t, s.Reload(config.Server{}))
+	assert.Equal(t, http.StatusOK, get("10.0.0.1").Code)
+}
+
+func TestRateLimit_trustedProxies(t *testing.T) {
+	testCases := []struct {
+		name           string
+		trustedProxies []string
+		expected       int
+	}{
+		{name: "no trusted proxy", expected: http.StatusTooManyRequests},
+		{name: "trusted proxy", trustedProxies: []string{"10.0.0.0/8"}, expected: http.StatusOK},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			s := server.NewServer(config.Server{Mode: "test", RateLimit: 0.001, RateBurst: 1, TrustedProxies: test.trustedProxies},
+				&mockDB{}, &mockBusiness{})
+
+			get := func(forwardedFor string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest("GET", "/api/product", nil)
+				req.RemoteAddr = "10.0.0.1:1234"
+				req.Header.Set("X-Forwarded-For", forwardedFor)
+				req.Header.Set("Api_key", "apitest")
+				w := httptest.NewRecorder()
+				s.ServeHTTP(w, req)
+				return w
+			}
+
+			// the clients behind the proxy have their own bucket only if the proxy is trusted
+			assert.Equal(t, http.StatusOK, get("192.0.2.1").Code)
+			assert.Equal(t, test.expected, get("192.0.2.2").Code)
+		})
+	}
+}
@@ -1,29 +1,96 @@
 // Package sverr provides functions for handling errors.
+// Errors are returned to the client as RFC 9457 problem details.
 package sverr
 
 import (
+	"encoding/json"
 	"errors"
-	"log/slog"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/logger"
 )
 
+const (
+	// ContentType is the content type of the error responses.
+	ContentType = "application/problem+json"
+	// TypePrefix is the prefix of the problem type URIs, it is followed by the error code.
+	TypePrefix = "urn:kart:problem:"
+)
+
+// kinds maps the sentinel errors to their status and default code.
+var kinds = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{aperr.ErrNotFound, http.StatusNotFound, aperr.CodeNotFound},
+	{aperr.ErrBadRequest, http.StatusBadRequest, aperr.CodeBadRequest},
+	{aperr.ErrUnprocessableEntity, http.StatusUnprocessableEntity, aperr.CodeUnprocessableEntity},
+	{aperr.ErrUnauthorized, http.StatusUnauthorized, aperr.CodeUnauthorized},
+	{aperr.ErrTooLarge, http.StatusRequestEntityTooLarge, aperr.CodeTooLarge},
+	{aperr.ErrTooManyRequests, http.StatusTooManyRequests, aperr.CodeTooManyRequests},
+}
+
+// reserved are the members of a problem that cannot be overridden by the extensions.
+var reserved = map[string]bool{"type": true, "title": true, "status": true, "detail": true, "instance": true, "code": true}
+
 // Abort aborts the request with the appropriate error code.
+// The errors that are not one of the aperr sentinel errors are logged with the message log and reported as an
+// internal error without details. The retryAfter extension, in seconds, is sent as the Retry-After header too.
 func Abort(ctx *gin.Context, err error, log string) {
-	if errors.Is(err, aperr.ErrNotFound) {
-		_ = ctx.AbortWithError(http.StatusNotFound, err)
-		return
+	_ = ctx.Error(err)
+
+	status, code, detail := http.StatusInternalServerError, aperr.CodeInternal, ""
+	for _, kind := range kinds {
+		if errors.Is(err, kind.err) {
+			status, code, detail = kind.status, kind.code, err.Error()
+			break
+		}
 	}
-	if errors.Is(err, aperr.ErrBadRequest) {
-		_ = ctx.AbortWithError(http.StatusBadRequest, err)
-		return
+	if status == http.StatusInternalServerError {
+		logger.FromContext(ctx).Error(log, "error", err)
 	}
-	if errors.Is(err, aperr.ErrUnprocessableEntity) {
-		_ = ctx.AbortWithError(http.StatusUnprocessableEntity, err)
+
+	problem := map[string]any{}
+	var apErr *aperr.Error
+	if status != http.StatusInternalServerError && errors.As(err, &apErr) {
+		for k, v := range apErr.Extensions {
+			if !reserved[k] {
+				problem[k] = v
+			}
+		}
+		if apErr.Code != "" {
+			code = apErr.Code
+		}
+		detail = apErr.Detail
+	}
+
+	problem["type"] = TypePrefix + code
+	problem["title"] = http.StatusText(status)
+	problem["status"] = status
+	problem["code"] = code
+	problem["instance"] = ctx.Request.URL.Path
+	if detail != "" {
+		problem["detail"] = detail
+	}
+	if retryAfter, ok := problem["retryAfter"].(int); ok {
+		ctx.Header("Retry-After", strconv.Itoa(retryAfter))
+	}
+	if requestID := logger.RequestID(ctx); requestID != "" {
+		problem["requestId"] = requestID
+	}
+
+	body, err := json.Marshal(problem)
+	if err != nil {
+		logger.FromContext(ctx).Error("Error encoding problem", "error", err)
+		ctx.AbortWithStatus(status)
 		return
 	}
-	slog.Error(log, "error", err)
-	ctx.AbortWithStatus(http.StatusInternalServerError)
+	ctx.Abort()
+	// replace the content type of a response that was started and discarded
+	ctx.Header("Content-Type", ContentType)
+	ctx.Data(status, ContentType, body)
 }
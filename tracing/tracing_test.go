@@ -0,0 +1,50 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/y7ls8i/kart/config"
+	"github.com/y7ls8i/kart/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestSetup(t *testing.T) {
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		shutdown, err := tracing.Setup(context.Background(), config.Tracing{})
+		require.NoError(t, err)
+		require.NoError(t, shutdown(context.Background()))
+	})
+
+	t.Run("unknown exporter", func(t *testing.T) {
+		_, err := tracing.Setup(context.Background(), config.Tracing{Exporter: "zipkin"})
+		require.Error(t, err)
+		assert.Equal(t, `unknown tracing exporter "zipkin"`, err.Error())
+	})
+
+	t.Run("stdout to file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "spans.json")
+		shutdown, err := tracing.Setup(context.Background(), config.Tracing{Exporter: tracing.ExporterStdout, File: file, ServiceName: "kart-test"})
+		require.NoError(t, err)
+
+		_, span := tracing.Tracer().Start(context.Background(), "test.Span")
+		tracing.End(span, errors.New("boom"))
+		require.NoError(t, shutdown(context.Background()))
+
+		b, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Contains(t, string(b), `"Name":"test.Span"`)
+		assert.Contains(t, string(b), `"Description":"boom"`)
+		assert.Contains(t, string(b), `"Value":"kart-test"`)
+	})
+}
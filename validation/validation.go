@@ -0,0 +1,129 @@
+// Package validation collects the violations of a request, so that they are all reported at once with the JSON
+// pointer (RFC 6901) of the field they are about, e.g. /items/2/quantity.
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	aperr "github.com/y7ls8i/kart/error"
+)
+
+// Violation codes that are not specific to a request.
+const (
+	CodeInvalidType  = "invalid_type"
+	CodeInvalidValue = "invalid_value"
+	CodeInvalidJSON  = "invalid_json"
+)
+
+// Violation is a problem with one field of a request.
+type Violation struct {
+	// Pointer is the JSON pointer of the field in the request body, "" is the whole body.
+	Pointer string `json:"pointer"`
+	// Code is the machine-readable code of the violation.
+	Code string `json:"code"`
+	// Detail is the human-readable explanation of the violation.
+	Detail string `json:"detail"`
+}
+
+// Violations are the violations of a request, in the order they were found.
+type Violations []Violation
+
+// Add adds a violation of the field at pointer.
+func (v *Violations) Add(pointer, code, detail string) {
+	*v = append(*v, Violation{Pointer: pointer, Code: code, Detail: detail})
+}
+
+// Err returns nil if there are no violations, or the error returned by Problem.
+func (v Violations) Err(kind error, code string) error {
+	if len(v) == 0 {
+		return nil
+	}
+	return v.Problem(kind, code)
+}
+
+// Problem returns an error of kind with code that lists the violations in its "errors" member.
+func (v Violations) Problem(kind error, code string) *aperr.Error {
+	details := make([]string, 0, len(v))
+	for _, violation := range v {
+		if violation.Pointer == "" {
+			details = append(details, violation.Detail)
+			continue
+		}
+		details = append(details, violation.Pointer+" "+violation.Detail)
+	}
+	return aperr.New(kind, code, strings.Join(details, "; ")).With("errors", []Violation(v))
+}
+
+// Pointer returns the JSON pointer made of the reference tokens, e.g. Pointer("items", 2, "quantity") returns
+// /items/2/quantity.
+func Pointer(tokens ...any) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		b.WriteByte('/')
+		s := fmt.Sprint(token)
+		s = strings.ReplaceAll(s, "~", "~0")
+		s = strings.ReplaceAll(s, "/", "~1")
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+// FromJSON returns the violations of a request body that cannot be decoded by encoding/json.
+// It returns nil if err is not a JSON decoding error.
+func FromJSON(err error) Violations {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		var tokens []any
+		if typeErr.Field != "" {
+			for _, token := range strings.Split(typeErr.Field, ".") {
+				tokens = append(tokens, token)
+			}
+		}
+		return Violations{{
+			Pointer: Pointer(tokens...),
+			Code:    CodeInvalidType,
+			Detail:  "must be " + jsonType(typeErr.Type),
+		}}
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return Violations{{
+			Code:   CodeInvalidJSON,
+			Detail: "malformed JSON at offset " + strconv.FormatInt(syntaxErr.Offset, 10),
+		}}
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return Violations{{Code: CodeInvalidJSON, Detail: "unexpected end of JSON"}}
+	}
+	if errors.Is(err, io.EOF) {
+		return Violations{{Code: CodeInvalidJSON, Detail: "request body is empty"}}
+	}
+	return nil
+}
+
+// jsonType returns the JSON type that decodes into t.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	default:
+		return "a " + t.String()
+	}
+}
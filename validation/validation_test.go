@@ -0,0 +1,88 @@
+package validation_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	aperr "github.com/y7ls8i/kart/error"
+	"github.com/y7ls8i/kart/validation"
+)
+
+func TestPointer(t *testing.T) {
+	assert.Equal(t, "", validation.Pointer())
+	assert.Equal(t, "/items/2/quantity", validation.Pointer("items", 2, "quantity"))
+	assert.Equal(t, "/a~1b/m~0n", validation.Pointer("a/b", "m~n"))
+}
+
+func TestViolations(t *testing.T) {
+	var v validation.Violations
+	require.NoError(t, v.Err(aperr.ErrUnprocessableEntity, aperr.CodeValidationFailed))
+
+	v.Add("/items/0/quantity", aperr.CodeInvalidQuantity, "must be positive")
+	v.Add("/couponCode", aperr.CodeCouponNotFound, "coupon not found")
+
+	err := v.Err(aperr.ErrUnprocessableEntity, aperr.CodeValidationFailed)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, aperr.ErrUnprocessableEntity))
+	assert.Equal(t, "unprocessable entity: /items/0/quantity must be positive; /couponCode coupon not found", err.Error())
+
+	var apErr *aperr.Error
+	require.True(t, errors.As(err, &apErr))
+	assert.Equal(t, aperr.CodeValidationFailed, apErr.Code)
+	assert.Equal(t, []validation.Violation(v), apErr.Extensions["errors"])
+}
+
+func TestFromJSON(t *testing.T) {
+	type item struct {
+		ProductID string `json:"productId"`
+		Quantity  int    `json:"quantity"`
+	}
+	type request struct {
+		Items []item `json:"items"`
+	}
+
+	testCases := []struct {
+		name     string
+		body     string
+		expected validation.Violations
+	}{
+		{
+			name:     "field type",
+			body:     `{"items":[{"quantity":1},{"quantity":"2"}]}`,
+			expected: validation.Violations{{Pointer: "/items/1/quantity", Code: validation.CodeInvalidType, Detail: "must be a number"}},
+		},
+		{
+			name:     "array type",
+			body:     `{"items":{}}`,
+			expected: validation.Violations{{Pointer: "/items", Code: validation.CodeInvalidType, Detail: "must be an array"}},
+		},
+		{
+			name:     "root type",
+			body:     `"notjson"`,
+			expected: validation.Violations{{Pointer: "", Code: validation.CodeInvalidType, Detail: "must be an object"}},
+		},
+		{
+			name:     "syntax",
+			body:     `{"items":[}`,
+			expected: validation.Violations{{Pointer: "", Code: validation.CodeInvalidJSON, Detail: "malformed JSON at offset 11"}},
+		},
+		{
+			name:     "truncated",
+			body:     `{"items":`,
+			expected: validation.Violations{{Pointer: "", Code: validation.CodeInvalidJSON, Detail: "malformed JSON at offset 9"}},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			var req request
+			err := json.Unmarshal([]byte(test.body), &req)
+			require.Error(t, err)
+			assert.Equal(t, test.expected, validation.FromJSON(err))
+		})
+	}
+
+	assert.Nil(t, validation.FromJSON(errors.New("other")))
+}